@@ -0,0 +1,178 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package clients
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrModelOverloaded is matched (with errors.Is) by errors of requests that OpenAI rejected because the model is
+// currently overloaded with other requests.
+var ErrModelOverloaded = errors.New("model is currently overloaded")
+
+// ErrModelUnavailable is matched (with errors.Is) by errors of requests that OpenAI rejected because the model
+// doesn't exist (anymore), e.g. because it was deprecated, or the account has no access to it. Retrying with the same
+// model is pointless.
+var ErrModelUnavailable = errors.New("model is not available")
+
+// ErrDNS is matched (with errors.Is) by errors of requests that failed because the host of the API could not be
+// resolved. These failures are usually transient, for example during DNS churn in Kubernetes.
+var ErrDNS = errors.New("DNS resolution failed")
+
+// ErrRateLimited is matched (with errors.Is) by errors of requests that OpenAI rejected with 429 Too Many Requests
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrMissingAPIKey is matched (with errors.Is) by errors of requests that were not sent because no API key is
+// configured, neither for the module nor in the request headers
+var ErrMissingAPIKey = errors.New("missing API key")
+
+// ErrQuotaExhausted is matched (with errors.Is) by errors of requests that OpenAI rejected because the quota of the
+// account is used up. Retrying is pointless until the billing of the account is fixed.
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// ErrMalformedResponse is matched (with errors.Is) by errors of requests whose response body is not valid JSON, e.g.
+// a truncated body or an HTML error page of a proxy. The error contains the start of the body. Such responses are
+// usually transient.
+var ErrMalformedResponse = errors.New("malformed response")
+
+// malformedSnippetLength is the maximum number of bytes of a malformed response body that are added to its error
+const malformedSnippetLength = 200
+
+// malformedResponseError returns the error of a response whose body could not be decoded
+func malformedResponseError(err error, status int, body []byte) error {
+	snippet := body
+	if len(snippet) > malformedSnippetLength {
+		snippet = snippet[:malformedSnippetLength]
+	}
+	return &classifiedError{
+		err:   errors.Wrapf(err, "unmarshal response body with status %d: %q", status, snippet),
+		class: ErrMalformedResponse,
+	}
+}
+
+// ErrResponseCountMismatch is matched (with errors.Is) by errors of inputs for which the response of OpenAI contains
+// no embedding, e.g. because a partial response has fewer embeddings than there were inputs in the request
+var ErrResponseCountMismatch = errors.New("response has no embedding for the input")
+
+// ProviderError is an error that OpenAI reported in the JSON body of a response, either for the whole request or
+// for a single input. HTTPStatus is the status of the response, which is 200 for errors of single inputs of an
+// otherwise successful request. Callers can branch on the Code, e.g. "context_length_exceeded" or "invalid_api_key".
+type ProviderError struct {
+	Type       string
+	Code       string
+	Message    string
+	HTTPStatus int
+}
+
+func (e *ProviderError) Error() string {
+	return e.Message
+}
+
+// Retryable returns whether the request might succeed if it is sent again later, which is the case for server
+// errors and rate limits, but not for an exhausted quota or other client errors
+func (e *ProviderError) Retryable() bool {
+	if e.Code == "insufficient_quota" || e.Type == "insufficient_quota" {
+		return false
+	}
+	return e.HTTPStatus == http.StatusTooManyRequests || e.HTTPStatus >= http.StatusInternalServerError
+}
+
+// AuthFailure returns whether OpenAI rejected the credentials of the request, so all further requests with the same
+// credentials fail as well
+func (e *ProviderError) AuthFailure() bool {
+	return e.HTTPStatus == http.StatusUnauthorized || e.HTTPStatus == http.StatusForbidden
+}
+
+// classifiedError keeps the message of err, but additionally matches class with errors.Is
+type classifiedError struct {
+	err   error
+	class error
+	// retryAfter is the wait that the Retry-After header of the response asked for, 0 if there was none
+	retryAfter time.Duration
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.class}
+}
+
+func (e *classifiedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// RetryAfter returns how long OpenAI asked to wait before the request is sent again, see the Retry-After header,
+// and false if the response of the failed request didn't ask for a specific wait.
+func RetryAfter(err error) (time.Duration, bool) {
+	var withRetryAfter interface{ RetryAfter() time.Duration }
+	if errors.As(err, &withRetryAfter) && withRetryAfter.RetryAfter() > 0 {
+		return withRetryAfter.RetryAfter(), true
+	}
+	return 0, false
+}
+
+// RequestIDHeader is the header in which OpenAI returns the ID of a request, which OpenAI support needs to look into it
+const RequestIDHeader = "X-Request-Id"
+
+// RequestIDError is the error of a request together with the ID that OpenAI returned for it, see RequestIDHeader
+type RequestIDError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestIDError) Error() string {
+	return e.Err.Error() + " (request ID: " + e.RequestID + ")"
+}
+
+func (e *RequestIDError) Unwrap() error {
+	return e.Err
+}
+
+// RequestID returns the ID of the request that failed with err, and false if OpenAI didn't return one
+func RequestID(err error) (string, bool) {
+	var withRequestID *RequestIDError
+	if errors.As(err, &withRequestID) {
+		return withRequestID.RequestID, true
+	}
+	return "", false
+}
+
+// WithRequestID adds the request ID to err, err is returned as is if either of them is empty
+func WithRequestID(err error, requestID string) error {
+	if err == nil || requestID == "" {
+		return err
+	}
+	return &RequestIDError{RequestID: requestID, Err: err}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
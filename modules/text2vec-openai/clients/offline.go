@@ -0,0 +1,111 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// offlineRateLimit is reported for every offline request, it is high enough that batches never wait for it
+const offlineRateLimit = 1_000_000_000
+
+// offline is a vectorizer that never calls OpenAI. Every input is hashed into a deterministic unit vector, so the
+// same input always has the same vector and different inputs have different vectors, but the vectors carry no
+// meaning. It is meant for tests and offline development only.
+type offline struct {
+	dimensions int
+}
+
+// NewOffline returns a client that hashes inputs into vectors with the given number of dimensions instead of calling
+// OpenAI. The dimensions setting of a class takes precedence.
+func NewOffline(dimensions int, logger logrus.FieldLogger) *offline {
+	logger.WithField("action", "text2vec_openai_offline").WithField("dimensions", dimensions).
+		Warn("offline mode is enabled, all vectors are deterministic hashes of the input and not OpenAI embeddings")
+	return &offline{dimensions: dimensions}
+}
+
+func (o *offline) Vectorize(ctx context.Context, input []string,
+	config ent.VectorizationConfig,
+) (*ent.VectorizationResult, *ent.RateLimits, error) {
+	res, err := o.VectorizeQuery(ctx, input, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, &ent.RateLimits{
+		LimitRequests: offlineRateLimit, RemainingRequests: offlineRateLimit,
+		LimitTokens: offlineRateLimit, RemainingTokens: offlineRateLimit,
+	}, nil
+}
+
+func (o *offline) VectorizeQuery(ctx context.Context, input []string,
+	config ent.VectorizationConfig,
+) (*ent.VectorizationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dimensions := o.dimensions
+	if config.Dimensions != nil {
+		dimensions = int(*config.Dimensions)
+	}
+	vectors := make([][]float32, len(input))
+	for i := range input {
+		vectors[i] = hashVector(input[i], dimensions)
+	}
+	return &ent.VectorizationResult{
+		Text:       input,
+		Dimensions: dimensions,
+		Vector:     vectors,
+		Errors:     make([]error, len(input)),
+		Model:      "offline",
+	}, nil
+}
+
+func (o *offline) MetaInfo() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"name":              "OpenAI Module (offline)",
+		"documentationHref": "https://platform.openai.com/docs/guides/embeddings/what-are-embeddings",
+	}, nil
+}
+
+// hashVector derives a unit vector from the SHA-256 hashes of text and a block counter. Every hash yields eight
+// dimensions with values in [-1, 1) before normalization.
+func hashVector(text string, dimensions int) []float32 {
+	vector := make([]float32, dimensions)
+	var block [sha256.Size]byte
+	var norm float64
+	for i := range vector {
+		if i%8 == 0 {
+			h := sha256.New()
+			h.Write(binary.BigEndian.AppendUint32(nil, uint32(i/8)))
+			h.Write([]byte(text))
+			h.Sum(block[:0])
+		}
+		value := float64(binary.BigEndian.Uint32(block[(i%8)*4:]))/math.MaxUint32*2 - 1
+		vector[i] = float32(value)
+		norm += value * value
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector
+}
@@ -13,12 +13,20 @@ package clients
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -31,24 +39,93 @@ import (
 )
 
 type embeddingsRequest struct {
-	Input      []string `json:"input"`
-	Model      string   `json:"model,omitempty"`
-	Dimensions *int64   `json:"dimensions,omitempty"`
+	Input          []string `json:"input"`
+	Model          string   `json:"model,omitempty"`
+	Dimensions     *int64   `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
 }
 
 type embedding struct {
 	Object string          `json:"object"`
+	Model  string          `json:"model,omitempty"`
 	Data   []embeddingData `json:"data,omitempty"`
+	Usage  *usage          `json:"usage,omitempty"`
 	Error  *openAIApiError `json:"error,omitempty"`
 }
 
+type usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
 type embeddingData struct {
 	Object    string          `json:"object"`
-	Index     int             `json:"index"`
-	Embedding []float32       `json:"embedding"`
+	Index     *int            `json:"index"`
+	Embedding embeddingVector `json:"embedding"`
 	Error     *openAIApiError `json:"error,omitempty"`
 }
 
+// embeddingVector decodes an embedding in either of its encodings, an array of floats or a base64 string (see
+// ent.VectorizationConfig.EncodingFormat). The shape of the response decides, as proxies and OpenAI compatible servers
+// might return floats although base64 was requested.
+type embeddingVector []float32
+
+func (e *embeddingVector) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*[]float32)(e))
+	}
+	vector, err := decodeBase64Embedding(data)
+	*e = vector
+	return err
+}
+
+// highPrecisionEmbedding decodes the vectors of a response without rounding them to float32, see
+// ent.VectorizationConfig.HighPrecision
+type highPrecisionEmbedding struct {
+	Data []struct {
+		Index     *int                `json:"index"`
+		Embedding highPrecisionVector `json:"embedding"`
+	} `json:"data,omitempty"`
+}
+
+// highPrecisionVector is an embeddingVector in float64. Base64 embeddings are float32 and only converted.
+type highPrecisionVector []float64
+
+func (e *highPrecisionVector) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*[]float64)(e))
+	}
+	vector, err := decodeBase64Embedding(data)
+	if err != nil {
+		return err
+	}
+	*e = make([]float64, len(vector))
+	for i := range vector {
+		(*e)[i] = float64(vector[i])
+	}
+	return nil
+}
+
+// decodeBase64Embedding decodes the JSON string of a base64 embedding, the little-endian bytes of its float32 values
+func decodeBase64Embedding(data []byte) ([]float32, error) {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode base64 embedding")
+	}
+	if len(raw)%4 != 0 {
+		return nil, errors.Errorf("base64 embedding has %d bytes, which are no float32 values", len(raw))
+	}
+	vector := make([]float32, len(raw)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return vector, nil
+}
+
 type openAIApiError struct {
 	Message string     `json:"message"`
 	Type    string     `json:"type"`
@@ -80,17 +157,26 @@ func (c *openAICode) UnmarshalJSON(data []byte) (err error) {
 	return nil
 }
 
-func buildUrl(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+// defaultAzureAPIVersion is the api-version of Azure OpenAI requests if the class doesn't set apiVersion
+const defaultAzureAPIVersion = "2022-12-01"
+
+// the placeholders of the endpointPath of a class, which are replaced by the deployment ID and the model of the
+// request, e.g. "/openai/deployments/{deploymentId}/embeddings". They are matched regardless of their case.
+const (
+	EndpointPathDeploymentID = "{deploymentid}"
+	EndpointPathModel        = "{model}"
+)
+
+var endpointPathPlaceholders = regexp.MustCompile("(?i)" + regexp.QuoteMeta(EndpointPathDeploymentID) + "|" +
+	regexp.QuoteMeta(EndpointPathModel))
+
+func buildUrl(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 	if isAzure {
-		host := baseURL
-		if host == "" || host == "https://api.openai.com" {
-			// Fall back to old assumption
-			host = "https://" + resourceName + ".openai.azure.com"
+		path, err := url.JoinPath(azureHost(baseURL, resourceName), "openai/deployments", deploymentID, "embeddings")
+		if err != nil {
+			return "", err
 		}
-
-		path := "openai/deployments/" + deploymentID + "/embeddings"
-		queryParam := "api-version=2022-12-01"
-		return fmt.Sprintf("%s/%s?%s", host, path, queryParam), nil
+		return withAPIVersion(path, apiVersion), nil
 	}
 
 	host := baseURL
@@ -98,12 +184,46 @@ func buildUrl(baseURL, resourceName, deploymentID string, isAzure bool) (string,
 	return url.JoinPath(host, path)
 }
 
+// buildTemplateUrl joins the host with the endpointPath template of the class instead of the path of the OpenAI or
+// Azure API, for OpenAI compatible servers that serve embeddings elsewhere. Azure requests keep the api-version.
+func buildTemplateUrl(baseURL, pathTemplate, resourceName, deploymentID, model, apiVersion string, isAzure bool) (string, error) {
+	path := endpointPathPlaceholders.ReplaceAllStringFunc(pathTemplate, func(placeholder string) string {
+		if strings.EqualFold(placeholder, EndpointPathDeploymentID) {
+			return url.PathEscape(deploymentID)
+		}
+		return url.PathEscape(model)
+	})
+	if !isAzure {
+		return url.JoinPath(baseURL, path)
+	}
+	joined, err := url.JoinPath(azureHost(baseURL, resourceName), path)
+	if err != nil {
+		return "", err
+	}
+	return withAPIVersion(joined, apiVersion), nil
+}
+
+func azureHost(baseURL, resourceName string) string {
+	if baseURL == "" || baseURL == "https://api.openai.com" {
+		// Fall back to old assumption
+		return "https://" + resourceName + ".openai.azure.com"
+	}
+	return baseURL
+}
+
+func withAPIVersion(path, apiVersion string) string {
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+	return path + "?" + url.Values{"api-version": {apiVersion}}.Encode()
+}
+
 type vectorizer struct {
 	openAIApiKey       string
 	openAIOrganization string
 	azureApiKey        string
 	httpClient         *http.Client
-	buildUrlFn         func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error)
+	buildUrlFn         func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error)
 	logger             logrus.FieldLogger
 }
 
@@ -134,12 +254,17 @@ func (v *vectorizer) VectorizeQuery(ctx context.Context, input []string,
 }
 
 func (v *vectorizer) vectorize(ctx context.Context, input []string, model string, config ent.VectorizationConfig) (*ent.VectorizationResult, *ent.RateLimits, error) {
-	body, err := json.Marshal(v.getEmbeddingsRequest(input, model, config.IsAzure, config.Dimensions))
+	body, err := json.Marshal(v.getEmbeddingsRequest(input, model, config))
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "marshal body")
 	}
+	if config.CompressRequests {
+		if body, err = gzipBody(body); err != nil {
+			return nil, nil, errors.Wrap(err, "compress body")
+		}
+	}
 
-	endpoint, err := v.buildURL(ctx, config)
+	endpoint, err := v.buildURL(ctx, config, model)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "join OpenAI API host and path")
 	}
@@ -154,57 +279,199 @@ func (v *vectorizer) vectorize(ctx context.Context, input []string, model string
 		return nil, nil, errors.Wrap(err, "API Key")
 	}
 	req.Header.Add(v.getApiKeyHeaderAndValue(apiKey, config.IsAzure))
-	if openAIOrganization := v.getOpenAIOrganization(ctx); openAIOrganization != "" {
+	if openAIOrganization := v.getOpenAIOrganization(ctx, config); openAIOrganization != "" {
 		req.Header.Add("OpenAI-Organization", openAIOrganization)
 	}
+	if openAIProject := v.getOpenAIProject(ctx, config); openAIProject != "" {
+		req.Header.Add("OpenAI-Project", openAIProject)
+	}
+	if jobID := ent.JobIDFromContext(ctx); jobID != "" {
+		req.Header.Add(ent.JobIDHeader, jobID)
+	}
 	req.Header.Add("Content-Type", "application/json")
+	if config.CompressRequests {
+		req.Header.Add("Content-Encoding", "gzip")
+	}
 
 	res, err := v.httpClient.Do(req)
 	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return nil, nil, &classifiedError{err: errors.Wrap(err, "send POST request"), class: ErrDNS}
+		}
 		return nil, nil, errors.Wrap(err, "send POST request")
 	}
 	defer res.Body.Close()
 
-	bodyBytes, err := io.ReadAll(res.Body)
+	bodyBytes, err := readBody(res)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "read response body")
 	}
 
 	var resBody embedding
 	if err := json.Unmarshal(bodyBytes, &resBody); err != nil {
-		return nil, nil, errors.Wrap(err, "unmarshal response body")
+		return nil, nil, WithRequestID(malformedResponseError(err, res.StatusCode, bodyBytes), res.Header.Get(RequestIDHeader))
 	}
 
+	requestID := res.Header.Get(RequestIDHeader)
 	if res.StatusCode != 200 || resBody.Error != nil {
-		return nil, nil, v.getError(res.StatusCode, resBody.Error, config.IsAzure)
+		err := v.getError(res.StatusCode, resBody.Error, config.IsAzure)
+		var classified *classifiedError
+		if errors.As(err, &classified) && errors.Is(err, ErrRateLimited) {
+			classified.retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, nil, WithRequestID(err, requestID)
 	}
 	rateLimit := ent.GetRateLimitsFromHeader(res.Header)
 
-	texts := make([]string, len(resBody.Data))
-	embeddings := make([][]float32, len(resBody.Data))
-	openAIerror := make([]error, len(resBody.Data))
+	// a successful response can still contain errors for individual inputs. Every item carries the index of the
+	// input it belongs to, which is used to map both embeddings and errors back to the inputs, see inputIndices
+	indices := make([]*int, len(resBody.Data))
 	for i := range resBody.Data {
-		texts[i] = resBody.Data[i].Object
-		embeddings[i] = resBody.Data[i].Embedding
+		indices[i] = resBody.Data[i].Index
+	}
+	itemInputs, err := inputIndices(indices, len(input))
+	if err != nil {
+		return nil, nil, WithRequestID(&classifiedError{err: errors.Wrap(err, "map embeddings to inputs"), class: ErrMalformedResponse},
+			requestID)
+	}
+
+	texts := make([]string, len(input))
+	embeddings := make([][]float32, len(input))
+	openAIerror := make([]error, len(input))
+	answered := make([]bool, len(input))
+	dimensions := 0
+	for i := range resBody.Data {
+		index := itemInputs[i]
+		if index >= len(input) {
+			// more items than inputs, none of which can be matched to an input
+			continue
+		}
+		answered[index] = true
+		texts[index] = resBody.Data[i].Object
+		embeddings[index] = resBody.Data[i].Embedding
 		if resBody.Data[i].Error != nil {
-			openAIerror[i] = v.getError(res.StatusCode, resBody.Data[i].Error, config.IsAzure)
+			openAIerror[index] = WithRequestID(v.getError(res.StatusCode, resBody.Data[i].Error, config.IsAzure), requestID)
+		} else if dimensions == 0 {
+			dimensions = len(resBody.Data[i].Embedding)
+		}
+	}
+
+	// inputs without an item in a partial response fail instead of being shifted onto the embeddings of other inputs
+	for i := range answered {
+		if !answered[i] {
+			openAIerror[i] = WithRequestID(fmt.Errorf("%w: got %d embeddings for %d inputs", ErrResponseCountMismatch,
+				len(resBody.Data), len(input)), requestID)
+		}
+	}
+
+	tokens := 0
+	if resBody.Usage != nil {
+		tokens = resBody.Usage.TotalTokens
+	}
+
+	var highPrecision [][]float64
+	if config.HighPrecision {
+		if highPrecision, err = highPrecisionEmbeddings(bodyBytes, itemInputs, len(input)); err != nil {
+			return nil, nil, WithRequestID(malformedResponseError(err, res.StatusCode, bodyBytes), requestID)
 		}
 	}
 
 	return &ent.VectorizationResult{
-		Text:       texts,
-		Dimensions: len(resBody.Data[0].Embedding),
-		Vector:     embeddings,
-		Errors:     openAIerror,
+		Text:          texts,
+		Dimensions:    dimensions,
+		Vector:        embeddings,
+		VectorFloat64: highPrecision,
+		Errors:        openAIerror,
+		Model:         resBody.Model,
+		Tokens:        tokens,
+		RequestID:     requestID,
 	}, rateLimit, nil
 }
 
-func (v *vectorizer) buildURL(ctx context.Context, config ent.VectorizationConfig) (string, error) {
+// highPrecisionEmbeddings decodes the vectors of the response body in float64, mapped to their inputs with the
+// itemInputs of the float32 vectors
+func highPrecisionEmbeddings(body []byte, itemInputs []int, inputs int) ([][]float64, error) {
+	var resBody highPrecisionEmbedding
+	if err := json.Unmarshal(body, &resBody); err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float64, inputs)
+	for i := range resBody.Data {
+		if i < len(itemInputs) && itemInputs[i] < inputs {
+			embeddings[itemInputs[i]] = resBody.Data[i].Embedding
+		}
+	}
+	return embeddings, nil
+}
+
+// inputIndices returns the input every item of the response belongs to, given the indices of the items. Only if no
+// item has an index, as returned by some OpenAI compatible servers, the items belong to the inputs at their positions.
+// Otherwise every item needs its own index of an input, as items could overwrite each other.
+func inputIndices(indices []*int, inputs int) ([]int, error) {
+	itemInputs := make([]int, len(indices))
+	indexed := false
+	for i := range indices {
+		itemInputs[i] = i
+		indexed = indexed || indices[i] != nil
+	}
+	if !indexed {
+		return itemInputs, nil
+	}
+
+	items := make(map[int]int, len(indices))
+	for i, index := range indices {
+		switch {
+		case index == nil:
+			return nil, fmt.Errorf("item %d has no index", i)
+		case *index < 0 || *index >= inputs:
+			return nil, fmt.Errorf("item %d has index %d for %d inputs", i, *index, inputs)
+		}
+		if item, ok := items[*index]; ok {
+			return nil, fmt.Errorf("items %d and %d have the same index %d", item, i, *index)
+		}
+		items[*index] = i
+		itemInputs[i] = *index
+	}
+	return itemInputs, nil
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readBody reads the body of the response. The transport only decodes gzip-encoded responses if it asked for them
+// itself, all other gzip-encoded responses are decoded here.
+func readBody(res *http.Response) ([]byte, error) {
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return io.ReadAll(res.Body)
+	}
+	r, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// buildURL returns the endpoint of requests for the given model, see EndpointPath of ent.VectorizationConfig
+func (v *vectorizer) buildURL(ctx context.Context, config ent.VectorizationConfig, model string) (string, error) {
 	baseURL, resourceName, deploymentID, isAzure := config.BaseURL, config.ResourceName, config.DeploymentID, config.IsAzure
 	if headerBaseURL := v.getValueFromContext(ctx, "X-Openai-Baseurl"); headerBaseURL != "" {
 		baseURL = headerBaseURL
 	}
-	return v.buildUrlFn(baseURL, resourceName, deploymentID, isAzure)
+	if config.EndpointPath != "" {
+		return buildTemplateUrl(baseURL, config.EndpointPath, resourceName, deploymentID, model, config.APIVersion, isAzure)
+	}
+	return v.buildUrlFn(baseURL, resourceName, deploymentID, config.APIVersion, isAzure)
 }
 
 func (v *vectorizer) getError(statusCode int, resBodyError *openAIApiError, isAzure bool) error {
@@ -213,16 +480,40 @@ func (v *vectorizer) getError(statusCode int, resBodyError *openAIApiError, isAz
 		endpoint = "Azure OpenAI API"
 	}
 	if resBodyError != nil {
-		return fmt.Errorf("connection to: %s failed with status: %d error: %v", endpoint, statusCode, resBodyError.Message)
+		provider := &ProviderError{
+			Type:       resBodyError.Type,
+			Code:       resBodyError.Code.String(),
+			Message:    resBodyError.Message,
+			HTTPStatus: statusCode,
+		}
+		err := fmt.Errorf("connection to: %s failed with status: %d error: %w", endpoint, statusCode, provider)
+		if statusCode == http.StatusServiceUnavailable && strings.Contains(strings.ToLower(resBodyError.Message), "overloaded") {
+			return &classifiedError{err: err, class: ErrModelOverloaded}
+		}
+		// OpenAI reports deprecated models with the same code as models that don't exist
+		if statusCode == http.StatusNotFound && resBodyError.Code == "model_not_found" {
+			return &classifiedError{err: err, class: ErrModelUnavailable}
+		}
+		if resBodyError.Code == "insufficient_quota" || resBodyError.Type == "insufficient_quota" {
+			return &classifiedError{err: err, class: ErrQuotaExhausted}
+		}
+		if statusCode == http.StatusTooManyRequests {
+			return &classifiedError{err: err, class: ErrRateLimited}
+		}
+		return err
+	}
+	err := fmt.Errorf("connection to: %s failed with status: %d", endpoint, statusCode)
+	if statusCode == http.StatusTooManyRequests {
+		return &classifiedError{err: err, class: ErrRateLimited}
 	}
-	return fmt.Errorf("connection to: %s failed with status: %d", endpoint, statusCode)
+	return err
 }
 
-func (v *vectorizer) getEmbeddingsRequest(input []string, model string, isAzure bool, dimensions *int64) embeddingsRequest {
-	if isAzure {
+func (v *vectorizer) getEmbeddingsRequest(input []string, model string, config ent.VectorizationConfig) embeddingsRequest {
+	if config.IsAzure {
 		return embeddingsRequest{Input: input}
 	}
-	return embeddingsRequest{Input: input, Model: model, Dimensions: dimensions}
+	return embeddingsRequest{Input: input, Model: model, Dimensions: config.Dimensions, EncodingFormat: config.EncodingFormat}
 }
 
 func (v *vectorizer) getApiKeyHeaderAndValue(apiKey string, isAzure bool) (string, string) {
@@ -232,26 +523,36 @@ func (v *vectorizer) getApiKeyHeaderAndValue(apiKey string, isAzure bool) (strin
 	return "Authorization", fmt.Sprintf("Bearer %s", apiKey)
 }
 
-func (v *vectorizer) getOpenAIOrganization(ctx context.Context) string {
+func (v *vectorizer) getOpenAIOrganization(ctx context.Context, config ent.VectorizationConfig) string {
 	if value := v.getValueFromContext(ctx, "X-Openai-Organization"); value != "" {
 		return value
 	}
+	if config.Organization != "" {
+		return config.Organization
+	}
 	return v.openAIOrganization
 }
 
+func (v *vectorizer) getOpenAIProject(ctx context.Context, config ent.VectorizationConfig) string {
+	if value := v.getValueFromContext(ctx, "X-Openai-Project"); value != "" {
+		return value
+	}
+	return config.Project
+}
+
 func (v *vectorizer) getApiKey(ctx context.Context, isAzure bool) (string, error) {
 	var apiKey, envVar string
 
 	if isAzure {
 		apiKey = "X-Azure-Api-Key"
 		envVar = "AZURE_APIKEY"
-		if len(v.azureApiKey) > 0 {
+		if strings.TrimSpace(v.azureApiKey) != "" {
 			return v.azureApiKey, nil
 		}
 	} else {
 		apiKey = "X-Openai-Api-Key"
 		envVar = "OPENAI_APIKEY"
-		if len(v.openAIApiKey) > 0 {
+		if strings.TrimSpace(v.openAIApiKey) != "" {
 			return v.openAIApiKey, nil
 		}
 	}
@@ -259,11 +560,27 @@ func (v *vectorizer) getApiKey(ctx context.Context, isAzure bool) (string, error
 	return v.getApiKeyFromContext(ctx, apiKey, envVar)
 }
 
+// AccountKey identifies the account whose rate limits apply to requests with the given context and config. It is a
+// hash of the API key, the organization, the project and the endpoint, so the API key itself doesn't leave the client.
+func (v *vectorizer) AccountKey(ctx context.Context, config ent.VectorizationConfig) string {
+	apiKey, _ := v.getApiKey(ctx, config.IsAzure)
+	endpoint, _ := v.buildURL(ctx, config, v.getModelString(config.Type, config.Model, "document", config.ModelVersion))
+	h := sha256.New()
+	for _, part := range []string{apiKey, v.getOpenAIOrganization(ctx, config), v.getOpenAIProject(ctx, config), endpoint} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (v *vectorizer) getApiKeyFromContext(ctx context.Context, apiKey, envVar string) (string, error) {
-	if apiKeyValue := v.getValueFromContext(ctx, apiKey); apiKeyValue != "" {
+	if apiKeyValue := v.getValueFromContext(ctx, apiKey); strings.TrimSpace(apiKeyValue) != "" {
 		return apiKeyValue, nil
 	}
-	return "", fmt.Errorf("no api key found neither in request header: %s nor in environment variable under %s", apiKey, envVar)
+	return "", &classifiedError{
+		err:   fmt.Errorf("no api key found neither in request header: %s nor in environment variable under %s", apiKey, envVar),
+		class: ErrMissingAPIKey,
+	}
 }
 
 func (v *vectorizer) getValueFromContext(ctx context.Context, key string) string {
@@ -12,11 +12,19 @@
 package clients
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -39,7 +47,7 @@ func TestBuildUrlFn(t *testing.T) {
 			BaseURL:      "https://api.openai.com",
 			IsAzure:      false,
 		}
-		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.IsAzure)
+		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.APIVersion, config.IsAzure)
 		assert.Nil(t, err)
 		assert.Equal(t, "https://api.openai.com/v1/embeddings", url)
 	})
@@ -53,7 +61,7 @@ func TestBuildUrlFn(t *testing.T) {
 			BaseURL:      "",
 			IsAzure:      true,
 		}
-		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.IsAzure)
+		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.APIVersion, config.IsAzure)
 		assert.Nil(t, err)
 		assert.Equal(t, "https://resourceID.openai.azure.com/openai/deployments/deploymentID/embeddings?api-version=2022-12-01", url)
 	})
@@ -68,7 +76,7 @@ func TestBuildUrlFn(t *testing.T) {
 			BaseURL:      "https://foobar.some.proxy",
 			IsAzure:      true,
 		}
-		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.IsAzure)
+		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.APIVersion, config.IsAzure)
 		assert.Nil(t, err)
 		assert.Equal(t, "https://foobar.some.proxy/openai/deployments/deploymentID/embeddings?api-version=2022-12-01", url)
 	})
@@ -83,10 +91,73 @@ func TestBuildUrlFn(t *testing.T) {
 			BaseURL:      "https://foobar.some.proxy",
 			IsAzure:      false,
 		}
-		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.IsAzure)
+		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.APIVersion, config.IsAzure)
 		assert.Nil(t, err)
 		assert.Equal(t, "https://foobar.some.proxy/v1/embeddings", url)
 	})
+
+	t.Run("buildUrlFn returns Azure client with api version behind a proxy path", func(t *testing.T) {
+		config := ent.VectorizationConfig{
+			DeploymentID: "deploymentID",
+			BaseURL:      "https://foobar.some.proxy/azure/",
+			IsAzure:      true,
+			APIVersion:   "2024-02-01",
+		}
+		url, err := buildUrl(config.BaseURL, config.ResourceName, config.DeploymentID, config.APIVersion, config.IsAzure)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://foobar.some.proxy/azure/openai/deployments/deploymentID/embeddings?api-version=2024-02-01", url)
+	})
+
+	t.Run("endpointPath replaces the path", func(t *testing.T) {
+		c := New("", "", "", 0, nullLogger())
+		tests := []struct {
+			name   string
+			config ent.VectorizationConfig
+			want   string
+		}{
+			{
+				name:   "without version prefix",
+				config: ent.VectorizationConfig{BaseURL: "http://localhost:8080", EndpointPath: "/embeddings"},
+				want:   "http://localhost:8080/embeddings",
+			},
+			{
+				name:   "with the model",
+				config: ent.VectorizationConfig{BaseURL: "http://localhost:8080/api/", EndpointPath: "/models/{model}/embed"},
+				want:   "http://localhost:8080/api/models/text-embedding-3-small/embed",
+			},
+			{
+				name: "with the deployment",
+				config: ent.VectorizationConfig{
+					BaseURL: "http://localhost:8080", DeploymentID: "my deployment",
+					EndpointPath: "/openai/deployments/{deploymentid}/embeddings",
+				},
+				want: "http://localhost:8080/openai/deployments/my%20deployment/embeddings",
+			},
+			{
+				name: "with a mixed-case path",
+				config: ent.VectorizationConfig{
+					BaseURL: "http://localhost:8080", DeploymentID: "MyDeployment",
+					EndpointPath: "/OpenAI/Deployments/{deploymentId}/Embed/{Model}",
+				},
+				want: "http://localhost:8080/OpenAI/Deployments/MyDeployment/Embed/text-embedding-3-small",
+			},
+			{
+				name: "of Azure",
+				config: ent.VectorizationConfig{
+					ResourceName: "resourceID", DeploymentID: "deploymentID", IsAzure: true, APIVersion: "2024-02-01",
+					EndpointPath: "/deployments/{deploymentid}/embeddings",
+				},
+				want: "https://resourceID.openai.azure.com/deployments/deploymentID/embeddings?api-version=2024-02-01",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				url, err := c.buildURL(context.Background(), tt.config, "text-embedding-3-small")
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, url)
+			})
+		}
+	})
 }
 
 func TestClient(t *testing.T) {
@@ -95,7 +166,7 @@ func TestClient(t *testing.T) {
 		defer server.Close()
 
 		c := New("apiKey", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -104,6 +175,8 @@ func TestClient(t *testing.T) {
 			Vector:     [][]float32{{0.1, 0.2, 0.3}},
 			Dimensions: 3,
 			Errors:     []error{nil},
+			Model:      "text-embedding-ada-002",
+			Tokens:     4,
 		}
 		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
 			ent.VectorizationConfig{
@@ -115,11 +188,50 @@ func TestClient(t *testing.T) {
 		assert.Equal(t, expected, res)
 	})
 
+	t.Run("when the response doesn't report usage", func(t *testing.T) {
+		server := httptest.NewServer(&fakeHandler{t: t, withoutUsage: true})
+		defer server.Close()
+
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{
+				Type:  "text",
+				Model: "ada",
+			})
+
+		require.Nil(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.2, 0.3}}, res.Vector)
+		assert.Equal(t, 0, res.Tokens)
+	})
+
+	t.Run("when high precision vectors are requested", func(t *testing.T) {
+		server := httptest.NewServer(&fakeHandler{t: t})
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+
+		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada", HighPrecision: true})
+
+		require.Nil(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.2, 0.3}}, res.Vector)
+		// decoded from the response, not converted from the float32 vector
+		assert.Equal(t, [][]float64{{0.1, 0.2, 0.3}}, res.VectorFloat64)
+
+		res, _, err = c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada"})
+		require.Nil(t, err)
+		assert.Nil(t, res.VectorFloat64)
+	})
+
 	t.Run("when the context is expired", func(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{t: t})
 		defer server.Close()
 		c := New("apiKey", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -132,6 +244,101 @@ func TestClient(t *testing.T) {
 		assert.Contains(t, err.Error(), "context deadline exceeded")
 	})
 
+	t.Run("when the rate limit is exceeded", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate limit reached for requests", "type": "requests"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrRateLimited)
+		assert.EqualError(t, err, "connection to: OpenAI API failed with status: 429 error: Rate limit reached for requests")
+		_, ok := RetryAfter(err)
+		assert.False(t, ok)
+	})
+
+	t.Run("when the rate limit is exceeded with a Retry-After header", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate limit reached for requests", "type": "requests"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrRateLimited)
+		retryAfter, ok := RetryAfter(err)
+		require.True(t, ok)
+		assert.Equal(t, 2*time.Second, retryAfter)
+	})
+
+	t.Run("when the quota is exhausted", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "You exceeded your current quota", "type": "insufficient_quota", "code": "insufficient_quota"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrQuotaExhausted)
+		assert.NotErrorIs(t, err, ErrRateLimited)
+		assert.Contains(t, err.Error(), "You exceeded your current quota")
+	})
+
+	t.Run("when the model is not available", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"message": "The model 'text-embedding-4' does not exist", "type": "invalid_request_error", "code": "model_not_found"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrModelUnavailable)
+		assert.Contains(t, err.Error(), "does not exist")
+	})
+
+	t.Run("when the error message mentions a deprecation", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "The parameter 'user' is deprecated", "type": "invalid_request_error", "code": "invalid_value"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.NotErrorIs(t, err, ErrModelUnavailable)
+	})
+
 	t.Run("when the server returns an error", func(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{
 			t:           t,
@@ -139,7 +346,7 @@ func TestClient(t *testing.T) {
 		})
 		defer server.Close()
 		c := New("apiKey", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -148,13 +355,103 @@ func TestClient(t *testing.T) {
 
 		require.NotNil(t, err)
 		assert.EqualError(t, err, "connection to: OpenAI API failed with status: 500 error: nope, not gonna happen")
+		assert.NotErrorIs(t, err, ErrModelOverloaded)
+		assert.NotErrorIs(t, err, ErrModelUnavailable)
+	})
+
+	t.Run("request IDs of failed requests", func(t *testing.T) {
+		fake := &fakeHandler{t: t, serverError: errors.Errorf("nope, not gonna happen")}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-request-id", "req-123")
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.NotNil(t, err)
+		assert.EqualError(t, err, "connection to: OpenAI API failed with status: 500 error: nope, not gonna happen (request ID: req-123)")
+		requestID, ok := RequestID(err)
+		assert.True(t, ok)
+		assert.Equal(t, "req-123", requestID)
+
+		// successful responses report their request ID with the result
+		fake.serverError = nil
+		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.Equal(t, "req-123", res.RequestID)
+
+		_, ok = RequestID(errors.New("without request ID"))
+		assert.False(t, ok)
+	})
+
+	t.Run("when the model is overloaded", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": {"message": "That model is currently overloaded with other requests.", "type": "server_error"}}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{})
+
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrModelOverloaded)
+		assert.EqualError(t, err, "connection to: OpenAI API failed with status: 503 error: That model is currently overloaded with other requests.")
+	})
+
+	t.Run("when the host cannot be resolved", func(t *testing.T) {
+		server := httptest.NewServer(&fakeHandler{t: t})
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+		// the resolver fails for the first request only
+		lookups := 0
+		dialer := &net.Dialer{}
+		c.httpClient = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				lookups++
+				if lookups == 1 {
+					return nil, &net.DNSError{Err: "no such host", Name: "api.openai.com", IsTemporary: true}
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrDNS)
+
+		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.2, 0.3}}, res.Vector)
+	})
+
+	t.Run("when the connection fails", func(t *testing.T) {
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return "http://127.0.0.1:1", nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.NotNil(t, err)
+		assert.NotErrorIs(t, err, ErrDNS)
 	})
 
 	t.Run("when OpenAI key is passed using X-Openai-Api-Key header", func(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{t: t})
 		defer server.Close()
 		c := New("", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -166,6 +463,8 @@ func TestClient(t *testing.T) {
 			Vector:     [][]float32{{0.1, 0.2, 0.3}},
 			Dimensions: 3,
 			Errors:     []error{nil},
+			Model:      "text-embedding-ada-002",
+			Tokens:     4,
 		}
 		res, _, err := c.Vectorize(ctxWithValue, []string{"This is my text"},
 			ent.VectorizationConfig{
@@ -181,7 +480,7 @@ func TestClient(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{t: t})
 		defer server.Close()
 		c := New("", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -200,7 +499,7 @@ func TestClient(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{t: t})
 		defer server.Close()
 		c := New("", "", "", 0, nullLogger())
-		c.buildUrlFn = func(baseURL, resourceName, deploymentID string, isAzure bool) (string, error) {
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
 			return server.URL, nil
 		}
 
@@ -219,6 +518,238 @@ func TestClient(t *testing.T) {
 			"nor in environment variable under OPENAI_APIKEY")
 	})
 
+	t.Run("when the API key is missing no request is sent", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+		defer server.Close()
+
+		for _, key := range []string{"", "  "} {
+			c := New(key, "", key, 0, nullLogger())
+			c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+				return server.URL, nil
+			}
+
+			_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+			assert.ErrorIs(t, err, ErrMissingAPIKey)
+			_, err = c.VectorizeQuery(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+			assert.ErrorIs(t, err, ErrMissingAPIKey)
+			_, _, err = c.Vectorize(context.Background(), []string{"This is my text"},
+				ent.VectorizationConfig{IsAzure: true, ResourceName: "resource", DeploymentID: "deployment"})
+			assert.ErrorIs(t, err, ErrMissingAPIKey)
+		}
+		assert.Equal(t, 0, requests)
+	})
+
+	t.Run("organization and project headers", func(t *testing.T) {
+		var header http.Header
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Clone()
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		newClient := func(organization string) *vectorizer {
+			c := New("apiKey", organization, "", 0, nullLogger())
+			c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+				return server.URL, nil
+			}
+			return c
+		}
+
+		_, _, err := newClient("").Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.NotContains(t, header, "Openai-Organization")
+		assert.NotContains(t, header, "Openai-Project")
+
+		config := ent.VectorizationConfig{Organization: "org-class", Project: "proj-class"}
+		_, _, err = newClient("org-module").Vectorize(context.Background(), []string{"This is my text"}, config)
+		require.Nil(t, err)
+		assert.Equal(t, "org-class", header.Get("OpenAI-Organization"))
+		assert.Equal(t, "proj-class", header.Get("OpenAI-Project"))
+
+		ctx := context.WithValue(context.Background(), "X-Openai-Organization", []string{"org-request"})
+		ctx = context.WithValue(ctx, "X-Openai-Project", []string{"proj-request"})
+		_, _, err = newClient("org-module").Vectorize(ctx, []string{"This is my text"}, config)
+		require.Nil(t, err)
+		assert.Equal(t, "org-request", header.Get("OpenAI-Organization"))
+		assert.Equal(t, "proj-request", header.Get("OpenAI-Project"))
+
+		_, _, err = newClient("org-module").Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.Equal(t, "org-module", header.Get("OpenAI-Organization"))
+		assert.NotContains(t, header, "Openai-Project")
+	})
+
+	t.Run("standard and Azure request shapes", func(t *testing.T) {
+		var request *http.Request
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request = r.Clone(context.Background())
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "azureKey", 0, nullLogger())
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL + "/proxy"})
+		require.Nil(t, err)
+		assert.Equal(t, "/proxy/v1/embeddings", request.URL.Path)
+		assert.Empty(t, request.URL.RawQuery)
+		assert.Equal(t, "Bearer apiKey", request.Header.Get("Authorization"))
+		assert.NotContains(t, request.Header, "Api-Key")
+
+		config := ent.VectorizationConfig{
+			BaseURL:      server.URL + "/proxy",
+			DeploymentID: "deployment",
+			IsAzure:      true,
+			APIVersion:   "2024-02-01",
+		}
+		_, _, err = c.Vectorize(context.Background(), []string{"This is my text"}, config)
+		require.Nil(t, err)
+		assert.Equal(t, "/proxy/openai/deployments/deployment/embeddings", request.URL.Path)
+		assert.Equal(t, "2024-02-01", request.URL.Query().Get("api-version"))
+		assert.Equal(t, "azureKey", request.Header.Get("api-key"))
+		assert.NotContains(t, request.Header, "Authorization")
+	})
+
+	t.Run("dimensions parameter", func(t *testing.T) {
+		var body map[string]interface{}
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			body = nil
+			require.NoError(t, json.Unmarshal(raw, &body))
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+
+		dimensions := int64(256)
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "text-embedding-3-large", Dimensions: &dimensions})
+		require.Nil(t, err)
+		assert.Equal(t, float64(256), body["dimensions"])
+
+		_, _, err = c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada"})
+		require.Nil(t, err)
+		assert.NotContains(t, body, "dimensions")
+	})
+
+	t.Run("base64 embeddings", func(t *testing.T) {
+		var body map[string]interface{}
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			body = nil
+			require.NoError(t, json.Unmarshal(raw, &body))
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "azureKey", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		floats, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada"})
+		require.Nil(t, err)
+		assert.NotContains(t, body, "encoding_format")
+
+		for _, ignored := range []bool{false, true} {
+			fake.ignoreEncodingFormat = ignored
+			res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+				ent.VectorizationConfig{BaseURL: server.URL, Model: "ada", EncodingFormat: "base64", HighPrecision: true})
+			require.Nil(t, err)
+			assert.Equal(t, "base64", body["encoding_format"])
+			assert.Equal(t, floats.Vector, res.Vector)
+			assert.Equal(t, 3, res.Dimensions)
+			require.Len(t, res.VectorFloat64, 1)
+			assert.InDeltaSlice(t, []float64{0.1, 0.2, 0.3}, res.VectorFloat64[0], 1e-7)
+		}
+
+		_, _, err = c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{IsAzure: true, ResourceName: "resource", DeploymentID: "deployment", EncodingFormat: "base64"})
+		require.Nil(t, err)
+		assert.NotContains(t, body, "encoding_format")
+	})
+
+	t.Run("when a base64 embedding is broken", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"object": "list", "data": [{"object": "embedding", "index": 0, "embedding": "AAAA/w"}]}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada", EncodingFormat: "base64"})
+		require.ErrorIs(t, err, ErrMalformedResponse)
+	})
+
+	t.Run("compressed requests", func(t *testing.T) {
+		var encodings []string
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				body, err := gzip.NewReader(r.Body)
+				require.NoError(t, err)
+				r.Body = body
+			}
+			// the response is compressed no matter what the request asked for
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			fake.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, w: gz}, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+
+		for _, compress := range []bool{true, false} {
+			res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+				ent.VectorizationConfig{BaseURL: server.URL, Model: "ada", CompressRequests: compress})
+			require.Nil(t, err)
+			assert.Equal(t, [][]float32{{0.1, 0.2, 0.3}}, res.Vector)
+		}
+		assert.Equal(t, []string{"gzip", ""}, encodings)
+
+		// responses that the transport doesn't decode itself are decoded as well
+		c.httpClient.Transport = &http.Transport{DisableCompression: true}
+		res, _, err := c.Vectorize(context.Background(), []string{"This is my text"},
+			ent.VectorizationConfig{BaseURL: server.URL, Model: "ada", CompressRequests: true})
+		require.Nil(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.2, 0.3}}, res.Vector)
+	})
+
+	t.Run("job ID header", func(t *testing.T) {
+		var header http.Header
+		fake := &fakeHandler{t: t}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Clone()
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.NotContains(t, header, ent.JobIDHeader)
+
+		ctx := ent.ContextWithJobID(context.Background(), "import-42")
+		_, _, err = c.Vectorize(ctx, []string{"This is my text"}, ent.VectorizationConfig{})
+		require.Nil(t, err)
+		assert.Equal(t, "import-42", header.Get(ent.JobIDHeader))
+	})
+
 	t.Run("when X-OpenAI-BaseURL header is passed", func(t *testing.T) {
 		server := httptest.NewServer(&fakeHandler{t: t})
 		defer server.Close()
@@ -233,19 +764,259 @@ func TestClient(t *testing.T) {
 		ctxWithValue := context.WithValue(context.Background(),
 			"X-Openai-Baseurl", []string{"http://base-url-passed-in-header.com"})
 
-		buildURL, err := c.buildURL(ctxWithValue, config)
+		buildURL, err := c.buildURL(ctxWithValue, config, "text-embedding-ada-002")
 		require.NoError(t, err)
 		assert.Equal(t, "http://base-url-passed-in-header.com/v1/embeddings", buildURL)
 
-		buildURL, err = c.buildURL(context.TODO(), config)
+		buildURL, err = c.buildURL(context.TODO(), config, "text-embedding-ada-002")
 		require.NoError(t, err)
 		assert.Equal(t, "http://default-url.com/v1/embeddings", buildURL)
 	})
+
+	t.Run("when the response contains errors for some inputs", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// items are deliberately not in input order
+			w.Write([]byte(`{"object": "list", "data": [
+				{"object": "embedding", "index": 2, "embedding": [0.3, 0.3]},
+				{"object": "embedding", "index": 1, "error": {"message": "input is invalid", "type": "invalid_request_error"}},
+				{"object": "embedding", "index": 0, "embedding": [0.1, 0.1]}
+			]}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		res, _, err := c.Vectorize(context.Background(), []string{"first", "second", "third"},
+			ent.VectorizationConfig{Type: "text", Model: "ada"})
+
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.1}, nil, {0.3, 0.3}}, res.Vector)
+		assert.Equal(t, 2, res.Dimensions)
+		require.Len(t, res.Errors, 3)
+		assert.NoError(t, res.Errors[0])
+		assert.EqualError(t, res.Errors[1], "connection to: OpenAI API failed with status: 200 error: input is invalid")
+		var provider *ProviderError
+		require.ErrorAs(t, res.Errors[1], &provider)
+		assert.Equal(t, ProviderError{Type: "invalid_request_error", Message: "input is invalid", HTTPStatus: 200}, *provider)
+		assert.NoError(t, res.Errors[2])
+	})
+
+	t.Run("when the response is not JSON", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(RequestIDHeader, "req_123")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html><body>Bad Gateway</body></html>" + strings.Repeat(" ", 500) + "end"))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		_, _, err := c.Vectorize(context.Background(), []string{"first"}, ent.VectorizationConfig{Type: "text", Model: "ada"})
+
+		require.ErrorIs(t, err, ErrMalformedResponse)
+		assert.Contains(t, err.Error(), "unmarshal response body with status 502")
+		assert.Contains(t, err.Error(), "Bad Gateway")
+		// only the start of the body is part of the error
+		assert.NotContains(t, err.Error(), "end")
+		requestID, ok := RequestID(err)
+		require.True(t, ok)
+		assert.Equal(t, "req_123", requestID)
+	})
+
+	t.Run("when the embeddings have no index", func(t *testing.T) {
+		// some OpenAI compatible servers leave out the index, the embeddings are in input order then
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"object": "list", "data": [
+				{"object": "embedding", "embedding": [0.1, 0.1]},
+				{"object": "embedding", "embedding": [0.2, 0.2]},
+				{"object": "embedding", "embedding": [0.3, 0.3]}
+			]}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		res, _, err := c.Vectorize(context.Background(), []string{"first", "second", "third"},
+			ent.VectorizationConfig{Type: "text", Model: "ada", HighPrecision: true})
+
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.1}, {0.2, 0.2}, {0.3, 0.3}}, res.Vector)
+		assert.Equal(t, [][]float64{{0.1, 0.1}, {0.2, 0.2}, {0.3, 0.3}}, res.VectorFloat64)
+		require.Len(t, res.Errors, 3)
+		for i := range res.Errors {
+			assert.NoError(t, res.Errors[i])
+		}
+	})
+
+	t.Run("when only some embeddings have an index", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			data     string
+			expected string
+		}{
+			{
+				name:     "missing index",
+				data:     `{"object": "embedding", "index": 1, "embedding": [0.2, 0.2]}, {"object": "embedding", "embedding": [0.1, 0.1]}`,
+				expected: "item 1 has no index",
+			},
+			{
+				name:     "duplicate index",
+				data:     `{"object": "embedding", "index": 1, "embedding": [0.2, 0.2]}, {"object": "embedding", "index": 1, "embedding": [0.1, 0.1]}`,
+				expected: "items 0 and 1 have the same index 1",
+			},
+			{
+				name:     "index out of range",
+				data:     `{"object": "embedding", "index": 0, "embedding": [0.1, 0.1]}, {"object": "embedding", "index": 2, "embedding": [0.2, 0.2]}`,
+				expected: "item 1 has index 2 for 2 inputs",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set(RequestIDHeader, "req_123")
+					w.Write([]byte(`{"object": "list", "data": [` + tt.data + `]}`))
+				}))
+				defer server.Close()
+				c := New("apiKey", "", "", 0, nullLogger())
+				c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+					return server.URL, nil
+				}
+
+				_, _, err := c.Vectorize(context.Background(), []string{"first", "second"},
+					ent.VectorizationConfig{Type: "text", Model: "ada", HighPrecision: true})
+
+				require.Error(t, err)
+				assert.ErrorIs(t, err, ErrMalformedResponse)
+				assert.Contains(t, err.Error(), tt.expected)
+				requestID, ok := RequestID(err)
+				require.True(t, ok)
+				assert.Equal(t, "req_123", requestID)
+			})
+		}
+	})
+
+	t.Run("when the response has fewer embeddings than inputs", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"object": "list", "data": [
+				{"object": "embedding", "index": 0, "embedding": [0.1, 0.1]},
+				{"object": "embedding", "index": 2, "embedding": [0.3, 0.3]}
+			]}`))
+		}))
+		defer server.Close()
+		c := New("apiKey", "", "", 0, nullLogger())
+		c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+			return server.URL, nil
+		}
+
+		res, _, err := c.Vectorize(context.Background(), []string{"first", "second", "third", "fourth"},
+			ent.VectorizationConfig{Type: "text", Model: "ada"})
+
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.1}, nil, {0.3, 0.3}, nil}, res.Vector)
+		require.Len(t, res.Errors, 4)
+		assert.NoError(t, res.Errors[0])
+		assert.ErrorIs(t, res.Errors[1], ErrResponseCountMismatch)
+		assert.EqualError(t, res.Errors[1], "response has no embedding for the input: got 2 embeddings for 4 inputs")
+		assert.NoError(t, res.Errors[2])
+		assert.ErrorIs(t, res.Errors[3], ErrResponseCountMismatch)
+	})
+}
+
+func TestProviderError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		want        ProviderError
+		retryable   bool
+		authFailure bool
+	}{
+		{
+			name:   "context length exceeded",
+			status: http.StatusBadRequest,
+			body:   `{"error": {"message": "too many tokens", "type": "invalid_request_error", "param": "input", "code": "context_length_exceeded"}}`,
+			want:   ProviderError{Type: "invalid_request_error", Code: "context_length_exceeded", Message: "too many tokens", HTTPStatus: 400},
+		},
+		{
+			name:        "invalid API key",
+			status:      http.StatusUnauthorized,
+			body:        `{"error": {"message": "incorrect API key", "type": "invalid_request_error", "code": "invalid_api_key"}}`,
+			want:        ProviderError{Type: "invalid_request_error", Code: "invalid_api_key", Message: "incorrect API key", HTTPStatus: 401},
+			authFailure: true,
+		},
+		{
+			name:        "unsupported region",
+			status:      http.StatusForbidden,
+			body:        `{"error": {"message": "country not supported", "type": "request_forbidden", "code": "unsupported_country_region_territory"}}`,
+			want:        ProviderError{Type: "request_forbidden", Code: "unsupported_country_region_territory", Message: "country not supported", HTTPStatus: 403},
+			authFailure: true,
+		},
+		{
+			name:      "server error",
+			status:    http.StatusInternalServerError,
+			body:      `{"error": {"message": "the server had an error", "type": "server_error", "code": null}}`,
+			want:      ProviderError{Type: "server_error", Message: "the server had an error", HTTPStatus: 500},
+			retryable: true,
+		},
+		{
+			name:      "numeric code",
+			status:    http.StatusBadGateway,
+			body:      `{"error": {"message": "bad gateway", "type": "server_error", "code": 502}}`,
+			want:      ProviderError{Type: "server_error", Code: "502", Message: "bad gateway", HTTPStatus: 502},
+			retryable: true,
+		},
+		{
+			name:      "rate limit",
+			status:    http.StatusTooManyRequests,
+			body:      `{"error": {"message": "slow down", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			want:      ProviderError{Type: "requests", Code: "rate_limit_exceeded", Message: "slow down", HTTPStatus: 429},
+			retryable: true,
+		},
+		{
+			name:   "insufficient quota",
+			status: http.StatusTooManyRequests,
+			body:   `{"error": {"message": "quota exceeded", "type": "insufficient_quota", "code": "insufficient_quota"}}`,
+			want:   ProviderError{Type: "insufficient_quota", Code: "insufficient_quota", Message: "quota exceeded", HTTPStatus: 429},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			c := New("apiKey", "", "", 0, nullLogger())
+			c.buildUrlFn = func(baseURL, resourceName, deploymentID, apiVersion string, isAzure bool) (string, error) {
+				return server.URL, nil
+			}
+
+			_, _, err := c.Vectorize(context.Background(), []string{"text"}, ent.VectorizationConfig{Type: "text", Model: "ada"})
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("failed with status: %d error: %s", tt.status, tt.want.Message))
+			var provider *ProviderError
+			require.ErrorAs(t, err, &provider)
+			assert.Equal(t, tt.want, *provider)
+			assert.Equal(t, tt.retryable, provider.Retryable())
+			assert.Equal(t, tt.authFailure, provider.AuthFailure())
+		})
+	}
 }
 
 type fakeHandler struct {
 	t           *testing.T
 	serverError error
+	// withoutUsage omits the usage from responses like some OpenAI compatible providers do
+	withoutUsage bool
+	// ignoreEncodingFormat returns floats even if base64 embeddings are requested, like some proxies do
+	ignoreEncodingFormat bool
 }
 
 func (f *fakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -283,9 +1054,21 @@ func (f *fakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"index":     0,
 		"embedding": []float32{0.1, 0.2, 0.3},
 	}
+	if b["encoding_format"] == "base64" && !f.ignoreEncodingFormat {
+		raw := make([]byte, 0, 12)
+		for _, value := range []float32{0.1, 0.2, 0.3} {
+			raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(value))
+		}
+		embeddingData["embedding"] = base64.StdEncoding.EncodeToString(raw)
+	}
 	embedding := map[string]interface{}{
 		"object": "list",
+		"model":  "text-embedding-ada-002",
 		"data":   []interface{}{embeddingData},
+		"usage":  map[string]interface{}{"prompt_tokens": 4, "total_tokens": 4},
+	}
+	if f.withoutUsage {
+		delete(embedding, "usage")
 	}
 
 	outBytes, err := json.Marshal(embedding)
@@ -294,6 +1077,15 @@ func (f *fakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(outBytes)
 }
 
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	return g.w.Write(b)
+}
+
 func nullLogger() logrus.FieldLogger {
 	l, _ := test.NewNullLogger()
 	return l
@@ -502,3 +1294,35 @@ func TestOpenAIApiErrorDecode(t *testing.T) {
 		}
 	})
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 1500*time.Millisecond, parseRetryAfter("1.5", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter("-1", now))
+}
+
+func TestAccountKey(t *testing.T) {
+	withKey := func(key string) context.Context {
+		return context.WithValue(context.Background(), "X-Openai-Api-Key", []string{key})
+	}
+	c := New("", "", "", 0, nullLogger())
+
+	first := c.AccountKey(withKey("first-key"), ent.VectorizationConfig{})
+	assert.Len(t, first, 64)
+	assert.NotContains(t, first, "first-key")
+	assert.Equal(t, first, c.AccountKey(withKey("first-key"), ent.VectorizationConfig{}))
+	assert.NotEqual(t, first, c.AccountKey(withKey("second-key"), ent.VectorizationConfig{}))
+	assert.NotEqual(t, first, c.AccountKey(withKey("first-key"), ent.VectorizationConfig{BaseURL: "https://example.com"}))
+	assert.NotEqual(t, first, c.AccountKey(withKey("first-key"), ent.VectorizationConfig{Project: "proj"}))
+
+	t.Run("the API key of the module takes precedence", func(t *testing.T) {
+		c := New("module-key", "", "", 0, nullLogger())
+		assert.Equal(t, c.AccountKey(withKey("first-key"), ent.VectorizationConfig{}),
+			c.AccountKey(withKey("second-key"), ent.VectorizationConfig{}))
+	})
+}
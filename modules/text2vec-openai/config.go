@@ -42,7 +42,18 @@ func (m *OpenAIModule) ValidateClass(ctx context.Context,
 	class *models.Class, cfg moduletools.ClassConfig,
 ) error {
 	settings := vectorizer.NewClassSettings(cfg)
-	return settings.Validate(class)
+	if err := settings.Validate(class); err != nil {
+		return err
+	}
+
+	if conflicting := settings.ConflictingProperties(); len(conflicting) > 0 && m.logger != nil {
+		m.logger.WithField("action", "validate_class").
+			WithField("class", class.Class).
+			WithField("properties", conflicting).
+			Warnf("properties are part of both properties and excludeProperties, %q list takes precedence",
+				settings.PropertyListPrecedence())
+	}
+	return nil
 }
 
 var _ = modulecapabilities.ClassConfigurator(New())
@@ -0,0 +1,34 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package ent
+
+import "context"
+
+type contextKey int
+
+const jobIDKey contextKey = 0
+
+// JobIDHeader is the request header that carries the job ID of ContextWithJobID to the provider. OpenAI logs it
+// with the request, so requests can be looked up by it on their side as well.
+const JobIDHeader = "X-Client-Request-Id"
+
+// ContextWithJobID tags all requests to the provider made with the returned context with the ID of the import or job
+// they belong to
+func ContextWithJobID(ctx context.Context, jobID string) context.Context {
+	return context.WithValue(ctx, jobIDKey, jobID)
+}
+
+// JobIDFromContext returns the ID set with ContextWithJobID, "" otherwise
+func JobIDFromContext(ctx context.Context) string {
+	jobID, _ := ctx.Value(jobIDKey).(string)
+	return jobID
+}
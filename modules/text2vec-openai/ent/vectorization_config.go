@@ -17,4 +17,19 @@ type VectorizationConfig struct {
 	DeploymentID                            string `json:"deploymentId"`
 	IsAzure                                 bool
 	Dimensions                              *int64
+	// Organization and Project are sent as the OpenAI-Organization and OpenAI-Project headers if they are set
+	Organization, Project string
+	// APIVersion is the api-version of Azure OpenAI requests, the client picks its default if it is empty
+	APIVersion string
+	// EndpointPath replaces the path of the OpenAI or Azure API, see clients.EndpointPathDeploymentID. "" keeps the
+	// path of the API.
+	EndpointPath string
+	// EncodingFormat is sent as the encoding_format of OpenAI requests unless it is empty, e.g. "base64" for smaller
+	// responses that are faster to decode. Azure requests and the decoding of responses are not affected.
+	EncodingFormat string
+	// HighPrecision asks the client for the vectors in the full precision of the response as well, see
+	// VectorizationResult.VectorFloat64
+	HighPrecision bool
+	// CompressRequests gzip-encodes the bodies of requests, which not every proxy supports
+	CompressRequests bool
 }
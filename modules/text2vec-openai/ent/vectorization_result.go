@@ -12,6 +12,7 @@
 package ent
 
 import (
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -29,7 +30,15 @@ type VectorizationResult struct {
 	Text       []string
 	Dimensions int
 	Vector     [][]float32
-	Errors     []error
+	// VectorFloat64 holds the vectors in the precision of the response, it is only set for configs with HighPrecision
+	VectorFloat64 [][]float64
+	Errors        []error
+	// Model is the model that the provider reports to have used, e.g. a specific snapshot of the requested model
+	Model string
+	// Tokens is the number of tokens that the provider reports for the request, 0 if it doesn't report them
+	Tokens int
+	// RequestID is the ID that the provider returned for the request, "" if it doesn't return one
+	RequestID string
 }
 
 func GetRateLimitsFromHeader(header http.Header) *RateLimits {
@@ -46,11 +55,17 @@ func GetRateLimitsFromHeader(header http.Header) *RateLimits {
 		LimitTokens:       getHeaderInt(header, "x-ratelimit-limit-tokens"),
 		RemainingRequests: getHeaderInt(header, "x-ratelimit-remaining-requests"),
 		RemainingTokens:   getHeaderInt(header, "x-ratelimit-remaining-tokens"),
-		ResetRequests:     int(requestsReset.Seconds()),
-		ResetTokens:       int(tokensReset.Seconds()),
+		ResetRequests:     resetSeconds(requestsReset),
+		ResetTokens:       resetSeconds(tokensReset),
 	}
 }
 
+// resetSeconds rounds a reset duration up to full seconds, so that resets below a second, e.g. "120ms", are not
+// mistaken for an immediate reset
+func resetSeconds(reset time.Duration) int {
+	return int(math.Ceil(reset.Seconds()))
+}
+
 func getHeaderInt(header http.Header, key string) int {
 	value := header.Get(key)
 	if value == "" {
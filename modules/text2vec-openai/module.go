@@ -15,6 +15,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -107,9 +108,25 @@ func (m *OpenAIModule) initVectorizer(ctx context.Context, timeout time.Duration
 	openAIOrganization := os.Getenv("OPENAI_ORGANIZATION")
 	azureApiKey := os.Getenv("AZURE_APIKEY")
 
-	client := clients.New(openAIApiKey, openAIOrganization, azureApiKey, timeout, logger)
+	var client interface {
+		vectorizer.Client
+		metaProvider
+	} = clients.New(openAIApiKey, openAIOrganization, azureApiKey, timeout, logger)
+	// offline mode is meant for tests and development without access to OpenAI and needs to be enabled explicitly
+	if offlineDimensions := os.Getenv("OPENAI_OFFLINE_DIMENSIONS"); offlineDimensions != "" {
+		dimensions, err := strconv.Atoi(offlineDimensions)
+		if err != nil || dimensions <= 0 {
+			return errors.Errorf("OPENAI_OFFLINE_DIMENSIONS needs to be a positive number, got: %q", offlineDimensions)
+		}
+		client = clients.NewOffline(dimensions, logger)
+	}
 
-	m.vectorizer = vectorizer.New(client, OpenAITimeout, m.logger)
+	m.vectorizer = vectorizer.New(client, OpenAITimeout, m.logger,
+		// an overloaded model needs considerably longer to recover than a single failed request
+		vectorizer.WithOverloadRetries(vectorizer.RetryConfig{MaxRetries: 3, BaseBackoff: 5 * time.Second, MaxBackoff: 20 * time.Second}),
+		vectorizer.WithDNSRetries(vectorizer.RetryConfig{MaxRetries: 3, BaseBackoff: 250 * time.Millisecond, MaxBackoff: time.Second}),
+		vectorizer.WithRateLimitRetries(vectorizer.RetryConfig{MaxRetries: 3, BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}),
+	)
 	m.metaProvider = client
 
 	return nil
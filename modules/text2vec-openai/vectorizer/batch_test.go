@@ -14,14 +14,21 @@ package vectorizer
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-openapi/strfmt"
+	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
 )
 
 func TestBatch(t *testing.T) {
@@ -64,12 +71,12 @@ func TestBatch(t *testing.T) {
 			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}}, // set limit
 			{Class: "Car", Properties: map[string]interface{}{"test": "long long long long, long, long, long, long"}},
 			{Class: "Car", Properties: map[string]interface{}{"test": "short"}},
-		}, skip: []bool{false, false, false}, wantErrors: map[int]error{1: fmt.Errorf("text too long for vectorization")}},
+		}, skip: []bool{false, false, false}, wantErrors: map[int]error{1: ErrTextTooLong}},
 		{name: "token too long, last item in batch", objects: []*models.Object{
 			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}}, // set limit
 			{Class: "Car", Properties: map[string]interface{}{"test": "short"}},
 			{Class: "Car", Properties: map[string]interface{}{"test": "long long long long, long, long, long, long"}},
-		}, skip: []bool{false, false, false}, wantErrors: map[int]error{2: fmt.Errorf("text too long for vectorization")}},
+		}, skip: []bool{false, false, false}, wantErrors: map[int]error{2: ErrTextTooLong}},
 		{name: "skip last item", objects: []*models.Object{
 			{Class: "Car", Properties: map[string]interface{}{"test": "fir test object"}}, // set limit
 			{Class: "Car", Properties: map[string]interface{}{"test": "first object first batch"}},
@@ -102,7 +109,7 @@ func TestBatch(t *testing.T) {
 
 			for i := range tt.objects {
 				if tt.wantErrors[i] != nil {
-					require.Equal(t, tt.wantErrors[i], errs[i])
+					require.EqualError(t, errs[i], tt.wantErrors[i].Error())
 				} else if tt.skip[i] {
 					require.Nil(t, vecs[i])
 				} else {
@@ -178,6 +185,87 @@ func TestBatchTimeouts(t *testing.T) {
 	}
 }
 
+func TestBatchCancelledDuringRateLimitWait(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	cancelled := fmt.Errorf("context deadline exceeded or cancelled")
+
+	cases := []struct {
+		name    string
+		objects []*models.Object
+	}{
+		{name: "tokens", objects: []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 10"}}, // the next object waits for the token refresh
+			{Class: "Car", Properties: map[string]interface{}{"test": "long long long long long long long long long long"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "pending pending pending pending"}},
+		}},
+		{name: "requests", objects: []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 10"}},  // the next two objects need separate requests
+			{Class: "Car", Properties: map[string]interface{}{"test": "requests 0"}}, // waits for the request limit to reset
+			{Class: "Car", Properties: map[string]interface{}{"test": "pending pending pending pending"}},
+		}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			// the batch time is long enough to wait for the tokens of the second object to refresh, which takes ~40s
+			v := New(&fakeBatchClient{}, 2*time.Minute, logger)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			start := time.Now()
+			time.AfterFunc(200*time.Millisecond, cancel)
+			_, errs := v.ObjectBatch(ctx, tt.objects, make([]bool, len(tt.objects)), cfg)
+
+			// the waits take at least a second, the batch ends right after the cancellation instead
+			assert.Less(t, time.Since(start), 250*time.Millisecond)
+			assert.Equal(t, cancelled, errs[2])
+			if tt.name == "tokens" {
+				assert.Equal(t, cancelled, errs[1])
+			}
+		})
+	}
+}
+
+func TestBatchMaxBatchDuration(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := make([]*models.Object, 6)
+	for i := range objects {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("object %d", i)}}
+	}
+	skip := make([]bool, len(objects))
+
+	// every object is a separate request that takes 100ms, so the batch takes longer than its budget
+	client := &fakeBatchClient{latency: 100 * time.Millisecond}
+	v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1), WithMaxBatchDuration(250*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	start := time.Now()
+	vecs, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+	assert.NotNil(t, vecs[0])
+	assert.NotEmpty(t, errs)
+	for i, err := range errs {
+		assert.ErrorIs(t, err, ErrBatchTimeBudgetExceeded, i)
+		assert.Nil(t, vecs[i])
+	}
+	require.NoError(t, ctx.Err())
+
+	t.Run("the context deadline is not a time budget", func(t *testing.T) {
+		v := New(&fakeBatchClient{latency: 100 * time.Millisecond}, 40*time.Second, logger, WithMaxObjectsPerRequest(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+
+		_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+		assert.NotEmpty(t, errs)
+		for _, err := range errs {
+			assert.NotErrorIs(t, err, ErrBatchTimeBudgetExceeded)
+		}
+	})
+}
+
 func TestBatchRequestLimit(t *testing.T) {
 	client := &fakeBatchClient{defaultResetRate: 1}
 	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
@@ -198,8 +286,2186 @@ func TestBatchRequestLimit(t *testing.T) {
 			_, errs := v.ObjectBatch(context.Background(), []*models.Object{
 				{Class: "Car", Properties: map[string]interface{}{"test": "requests 0"}},                               // wait for the rate limit to reset
 				{Class: "Car", Properties: map[string]interface{}{"test": "requests 0" + thirtyTokens + thirtyTokens}}, // fill up default limit of 100 tokens
-			}, []bool{false, false, false, false}, cfg)
+			}, []bool{false, false}, cfg)
+			require.Len(t, errs, tt.expectedErrors)
+		})
+	}
+}
+
+func TestBatchMaxInputAge(t *testing.T) {
+	client := &fakeBatchClient{}
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+
+	v := New(client, 40*time.Second, logger, WithMaxInputAge(50*time.Millisecond))
+
+	// the first batch blocks the worker, so that the second one waits in the queue for longer than the max age
+	blocker := make(chan map[int]error)
+	go func() {
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "wait 200"}},
+		}, []bool{false}, cfg)
+		blocker <- errs
+	}()
+	require.Eventually(t, func() bool { return len(client.requests()) == 1 }, time.Second, time.Millisecond)
+
+	vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}, []bool{false, true, false}, cfg)
+
+	require.Len(t, <-blocker, 0)
+	require.Len(t, errs, 2)
+	require.ErrorIs(t, errs[0], ErrStale)
+	require.ErrorIs(t, errs[2], ErrStale)
+	for i := range vecs {
+		require.Nil(t, vecs[i])
+	}
+
+	// once the queue is empty again batches are processed normally
+	vecs, errs = v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+	}, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+	require.NotNil(t, vecs[0])
+}
+
+func TestBatchPartialSuccess(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error first failure"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error second failure"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fifth"}},
+	}
+	skip := []bool{false, false, false, false, false}
+
+	t.Run("per item errors are mapped to their objects", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 2)
+		require.EqualError(t, errs[1], "first failure")
+		require.EqualError(t, errs[3], "second failure")
+		for _, i := range []int{0, 2, 4} {
+			require.NotNil(t, vecs[i])
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithAllOrNothingSubBatches())
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		// the first object is sent on its own to discover the rate limits, all others share one request
+		require.NotNil(t, vecs[0])
+		require.Len(t, errs, 4)
+		for i := 1; i < len(objects); i++ {
+			require.EqualError(t, errs[i], "first failure")
+			require.Nil(t, vecs[i])
+		}
+	})
+}
+
+func TestBatchPriority(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	// every object uses more than half of the default token limit of 100, so each one is sent in its own request
+	fiftyTokens := strings.Repeat(" ab", 50)
+	lowPriorityObjects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first request"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "wait 150 first" + fiftyTokens}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "wait 150 second" + fiftyTokens}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "wait 150 third" + fiftyTokens}},
+	}
+	urgentObjects := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "urgent"}}}
+	normalObjects := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "normal"}}}
+	highPriorityCtx := ContextWithBatchPriority(context.Background(), BatchPriorityHigh)
+
+	vectorize := func(v *Vectorizer, ctx context.Context, objects []*models.Object, wg *sync.WaitGroup) {
+		defer wg.Done()
+		vecs, errs := v.ObjectBatch(ctx, objects, make([]bool, len(objects)), cfg)
+		assert.Len(t, errs, 0)
+		for i := range vecs {
+			assert.NotNil(t, vecs[i])
+		}
+	}
+	// returns the first word of the input of every request in the order they were sent
+	requestOrder := func(client *fakeBatchClient) []string {
+		var order []string
+		for _, input := range client.requests() {
+			fields := strings.Fields(input[0])
+			if fields[0] == "wait" {
+				order = append(order, fields[2])
+			} else {
+				order = append(order, fields[0])
+			}
+		}
+		return order
+	}
+
+	t.Run("high priority batch preempts a running batch", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithPreemption())
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+
+		go vectorize(v, context.Background(), lowPriorityObjects, wg)
+		time.Sleep(100 * time.Millisecond) // low priority batch is in its first slow request
+		go vectorize(v, highPriorityCtx, urgentObjects, wg)
+		wg.Wait()
+
+		// the running request is not interrupted, but the rest of the batch waits for the high priority batch
+		require.Equal(t, []string{"first", "first", "urgent", "second", "third"}, requestOrder(client))
+	})
+
+	t.Run("without preemption a running batch finishes first", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+
+		go vectorize(v, context.Background(), lowPriorityObjects, wg)
+		time.Sleep(100 * time.Millisecond)
+		go vectorize(v, highPriorityCtx, urgentObjects, wg)
+		wg.Wait()
+
+		require.Equal(t, []string{"first", "first", "second", "third", "urgent"}, requestOrder(client))
+	})
+
+	t.Run("high priority batches are dequeued first", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		wg := &sync.WaitGroup{}
+		wg.Add(3)
+		blocker := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "wait 300 blocker"}}}
+
+		go vectorize(v, context.Background(), blocker, wg)
+		time.Sleep(100 * time.Millisecond)
+		go vectorize(v, context.Background(), normalObjects, wg)
+		time.Sleep(100 * time.Millisecond)
+		go vectorize(v, highPriorityCtx, urgentObjects, wg)
+		wg.Wait()
+
+		require.Equal(t, []string{"blocker", "urgent", "normal"}, requestOrder(client))
+	})
+}
+
+func TestBatchOverloaded(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	skip := []bool{false, false}
+	retries := RetryConfig{MaxRetries: 2, BaseBackoff: 100 * time.Millisecond}
+
+	t.Run("overloads are not retried by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 1"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[0], clients.ErrModelOverloaded)
+		require.NotNil(t, vecs[1])
+		require.Len(t, client.requests(), 2)
+	})
+
+	t.Run("overloads are retried with the overload backoff", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithOverloadRetries(retries))
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 2"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		start := time.Now()
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		require.NotNil(t, vecs[0])
+		require.NotNil(t, vecs[1])
+		// 100ms before the first and 200ms before the second retry
+		require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+		require.Len(t, client.requests(), 4)
+	})
+
+	t.Run("server errors are retried with the overload backoff", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithOverloadRetries(retries))
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "server error 2"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		require.NotNil(t, vecs[0])
+		require.NotNil(t, vecs[1])
+		require.Len(t, client.requests(), 4)
+	})
+
+	t.Run("overloads fail once the retries are used up", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithOverloadRetries(retries))
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 5"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[0], clients.ErrModelOverloaded)
+		require.NotNil(t, vecs[1])
+		require.Len(t, client.requests(), 4)
+	})
+
+	t.Run("overloads are not retried beyond the batch time", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 50*time.Millisecond, logger, WithOverloadRetries(retries))
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 1"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.ErrorIs(t, errs[0], clients.ErrModelOverloaded)
+		require.Len(t, client.requests(), 2)
+	})
+}
+
+func TestBatchSmallBatchFastPath(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+
+	t.Run("same results as the queued path", func(t *testing.T) {
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "long text that exceeds the token limit"}},
+		}
+		skip := []bool{true, false, false, false, false}
+
+		queuedClient := &fakeBatchClient{}
+		queued := New(queuedClient, 40*time.Second, logger)
+		fastClient := &fakeBatchClient{}
+		fast := New(fastClient, 40*time.Second, logger, WithSmallBatchFastPath(len(objects)))
+
+		for i := 0; i < 2; i++ {
+			queuedVecs, queuedErrs := queued.ObjectBatch(context.Background(), objects, skip, cfg)
+			fastVecs, fastErrs := fast.ObjectBatch(context.Background(), objects, skip, cfg)
+
+			assert.Equal(t, queuedVecs, fastVecs)
+			assert.Equal(t, queuedErrs, fastErrs)
+		}
+		assert.Equal(t, queuedClient.requests(), fastClient.requests())
+	})
+
+	t.Run("small batches wait for a busy worker", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithSmallBatchFastPath(1))
+
+		// warm up the rate limits, so the long batch below is sent in a single request
+		v.ObjectBatch(context.Background(), []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "first"}}}, []bool{false}, cfg)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.ObjectBatch(context.Background(), []*models.Object{
+				{Class: "Car", Properties: map[string]interface{}{"test": "wait 200"}},
+				{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+			}, []bool{false, false}, cfg)
+		}()
+		require.Eventually(t, func() bool { return len(client.requests()) == 2 }, time.Second, time.Millisecond)
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "small"}}}, []bool{false}, cfg)
+		wg.Wait()
+
+		require.Len(t, errs, 0)
+		requests := client.requests()
+		require.Len(t, requests, 3)
+		assert.Equal(t, []string{"small"}, requests[2])
+	})
+}
+
+func BenchmarkObjectBatchSingleObject(b *testing.B) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "queued"},
+		{name: "fast path", opts: []Option{WithSmallBatchFastPath(1)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			v := New(&fakeBatchClient{}, 40*time.Second, logger, bm.opts...)
+			// only dispatching is measured, tokenizing the input is the same for both paths
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				wg := &sync.WaitGroup{}
+				wg.Add(1)
+				v.dispatch(batchJob{
+					ctx: context.Background(), wg: wg, errs: map[int]error{}, cfg: cfg,
+					texts: []string{"text"}, tokens: []int{1}, vecs: make([][]float32, 1), skipObject: []bool{false},
+					startTime: time.Now(),
+				}, 1)
+			}
+		})
+	}
+}
+
+func TestBatchDNSFailures(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "dns 1"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fourth"}},
+	}
+	skip := []bool{false, false, false, false}
+
+	t.Run("sub-batch recovers after a DNS failure", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithDNSRetries(RetryConfig{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond}))
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		for i := range vecs {
+			require.NotNil(t, vecs[i])
+		}
+		// the first object discovers the rate limits, the rest is one sub-batch that is sent twice
+		requests := client.requests()
+		require.Len(t, requests, 3)
+		assert.Equal(t, requests[1], requests[2])
+	})
+
+	t.Run("DNS failures are not retried by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 3)
+		for i := 1; i < len(objects); i++ {
+			require.ErrorIs(t, errs[i], clients.ErrDNS)
+		}
+	})
+
+	t.Run("DNS retries do not apply to overloads", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithDNSRetries(RetryConfig{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond}))
+
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 1"}},
+		}, []bool{false}, cfg)
+
+		require.ErrorIs(t, errs[0], clients.ErrModelOverloaded)
+	})
+}
+
+func TestBatchMalformedResponses(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "malformed 1"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := []bool{false, false, false}
+
+	t.Run("sub-batch recovers after a malformed response", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger,
+			WithMalformedResponseRetries(RetryConfig{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond}))
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		for i := range vecs {
+			require.NotNil(t, vecs[i])
+		}
+		requests := client.requests()
+		require.Len(t, requests, 3)
+		assert.Equal(t, requests[1], requests[2])
+	})
+
+	t.Run("only the objects of the request fail after the last retry", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1),
+			WithMalformedResponseRetries(RetryConfig{MaxRetries: 1, BaseBackoff: time.Millisecond}))
+
+		vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "malformed 5"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+		}, skip, cfg)
+
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[1], clients.ErrMalformedResponse)
+		assert.Contains(t, errs[1].Error(), "Bad Gateway")
+		require.NotNil(t, vecs[0])
+		require.NotNil(t, vecs[2])
+	})
+}
+
+func TestBatchLatestVersionCheck(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", ID: "4b5cd5b8-c1f4-4b9e-8d2b-6f1f1e0b1001", LastUpdateTimeUnix: 2, Properties: map[string]interface{}{"test": "current"}},
+		{Class: "Car", ID: "4b5cd5b8-c1f4-4b9e-8d2b-6f1f1e0b1002", LastUpdateTimeUnix: 1, Properties: map[string]interface{}{"test": "stale"}},
+		{Class: "Car", ID: "4b5cd5b8-c1f4-4b9e-8d2b-6f1f1e0b1003", LastUpdateTimeUnix: 1, Properties: map[string]interface{}{"test": "unknown"}},
+		{Class: "Car", ID: "4b5cd5b8-c1f4-4b9e-8d2b-6f1f1e0b1004", LastUpdateTimeUnix: 1, Properties: map[string]interface{}{"test": "skipped"}},
+	}
+	skip := []bool{false, false, false, true}
+	latest := map[strfmt.UUID]int64{objects[0].ID: 2, objects[1].ID: 3, objects[3].ID: 3}
+
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithLatestVersionCheck(func(ctx context.Context, object *models.Object) (int64, bool) {
+		version, ok := latest[object.ID]
+		return version, ok
+	}))
+
+	vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+	require.Len(t, errs, 1)
+	require.Equal(t, ErrSuperseded, errs[1])
+	require.Nil(t, vecs[1])
+	require.NotNil(t, vecs[0])
+	require.NotNil(t, vecs[2])
+	require.Nil(t, vecs[3])
+	for _, request := range client.requests() {
+		require.NotContains(t, request, "stale")
+	}
+	// the skip list of the caller is not modified
+	require.Equal(t, []bool{false, false, false, true}, skip)
+}
+
+func TestBatchDimensionMismatch(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+		"vectorizeClassName": false, "model": "text-embedding-3-small", "dimensions": 512,
+	}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "dimensions 512"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "dimensions 1536"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "dimensions 100"}},
+	}
+	skip := []bool{false, false, false}
+
+	t.Run("fail by default", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 2)
+		require.Len(t, vecs[0], 512)
+		require.ErrorIs(t, errs[1], ErrDimensionMismatch)
+		require.Nil(t, vecs[1])
+		require.ErrorIs(t, errs[2], ErrDimensionMismatch)
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithDimensionMismatch(DimensionMismatchTruncate))
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 1)
+		require.Len(t, vecs[0], 512)
+		require.Len(t, vecs[1], 512)
+		// the truncated vector is normalized again
+		for _, f := range vecs[1] {
+			require.InDelta(t, 1/math.Sqrt(512), f, 1e-6)
+		}
+		require.ErrorIs(t, errs[2], ErrDimensionMismatch)
+	})
+
+	t.Run("out of range dimensions fail before any request", func(t *testing.T) {
+		cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+			"vectorizeClassName": false, "model": "text-embedding-3-small", "dimensions": 2048,
+		}}
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, []bool{false, true, false}, cfg)
+
+		require.Len(t, errs, 2)
+		expected := "wrong dimensions setting for text-embedding-3-small model, dimensions need to be between 1 and 1536, got: 2048"
+		assert.EqualError(t, errs[0], expected)
+		assert.EqualError(t, errs[2], expected)
+		assert.Nil(t, vecs[0])
+		_, _, err := v.Object(context.Background(), objects[0], cfg)
+		assert.EqualError(t, err, expected)
+		assert.Empty(t, client.requests())
+	})
+}
+
+func TestBatchMixedDimensions(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "dimensions 3"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "dimensions 3 skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error broken"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "last"}},
+	}
+	v := New(&fakeBatchClient{}, 40*time.Second, logger)
+
+	vecs, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false, true, false, false}, cfg)
+
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[1], ErrMixedDimensions)
+	assert.EqualError(t, errs[1], "vector dimensions differ from the other vectors of the batch: got 3 dimensions, expected 4")
+	assert.Nil(t, vecs[1])
+	assert.EqualError(t, errs[3], "broken")
+	assert.Len(t, vecs[0], 4)
+	assert.Len(t, vecs[4], 4)
+
+	t.Run("ties go to the first vector", func(t *testing.T) {
+		vecs, errs := v.ObjectBatch(context.Background(), objects[:2], []bool{false, false}, cfg)
+
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[1], ErrMixedDimensions)
+		assert.Len(t, vecs[0], 4)
+	})
+}
+
+func TestBatchQueryBatchTime(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	thirtyTokens := "ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab ab"
+	logger, _ := test.NewNullLogger()
+	v := New(&fakeBatchClient{defaultResetRate: 1}, 2*time.Second, logger, WithQueryBatchTime(100*time.Millisecond))
+
+	cases := []struct {
+		name           string
+		kind           CallKind
+		expectedErrors int
+	}{
+		// waiting for the rate limit to reset does not fit into the query batch time
+		{name: "query", kind: CallKindQuery, expectedErrors: 1},
+		{name: "import", kind: CallKindImport, expectedErrors: 0},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := v.ObjectBatch(ContextWithCallKind(context.Background(), tt.kind), []*models.Object{
+				{Class: "Car", Properties: map[string]interface{}{"test": "requests 0"}},
+				{Class: "Car", Properties: map[string]interface{}{"test": "requests 0" + thirtyTokens + thirtyTokens}},
+			}, []bool{false, false}, cfg)
 			require.Len(t, errs, tt.expectedErrors)
 		})
 	}
+
+	t.Run("calls are import calls by default", func(t *testing.T) {
+		assert.Equal(t, CallKindImport, CallKindFromContext(context.Background()))
+		assert.Equal(t, 2*time.Second, v.batchTime(context.Background()))
+		assert.Equal(t, 100*time.Millisecond, v.batchTime(ContextWithCallKind(context.Background(), CallKindQuery)))
+	})
+}
+
+func TestBatchMissingAPIKey(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger)
+
+	vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "missing api key"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}, []bool{false, false, true}, cfg)
+
+	// the batch fails after the first request
+	require.Len(t, client.requests(), 1)
+	require.Len(t, errs, 2)
+	for i := 0; i < 2; i++ {
+		require.ErrorIs(t, errs[i], clients.ErrMissingAPIKey)
+		require.Nil(t, vecs[i])
+	}
+}
+
+func TestBatchAuthFailure(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithOverloadRetries(RetryConfig{MaxRetries: 2, BaseBackoff: time.Millisecond}))
+
+	vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "invalid api key"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}, []bool{false, false}, cfg)
+
+	// auth failures are neither retried nor is the rest of the batch sent
+	require.Len(t, client.requests(), 1)
+	require.Len(t, errs, 2)
+	for i := 0; i < 2; i++ {
+		var provider *clients.ProviderError
+		require.ErrorAs(t, errs[i], &provider)
+		require.Equal(t, "invalid_api_key", provider.Code)
+		require.Nil(t, vecs[i])
+	}
+}
+
+func TestBatchCircuitBreaker(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1),
+		WithOverloadRetries(RetryConfig{MaxRetries: 0}), WithCircuitBreaker(2, 100*time.Millisecond, 0))
+
+	objects := make([]*models.Object, 6)
+	for i := range objects {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("server error 100 %d", i)}}
+	}
+	_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+	// the breaker opens after the second failed request and the rest of the batch fails without being sent
+	require.Len(t, client.requests(), 2)
+	require.Len(t, errs, len(objects))
+	for i := 2; i < len(objects); i++ {
+		require.ErrorIs(t, errs[i], ErrCircuitOpen)
+	}
+
+	fine := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "fine"}}}
+	// within the cooldown further batches fail fast as well
+	_, errs = v.ObjectBatch(context.Background(), fine, []bool{false}, cfg)
+	require.ErrorIs(t, errs[0], ErrCircuitOpen)
+	require.Len(t, client.requests(), 2)
+
+	// a failed probe opens the breaker for another cooldown
+	time.Sleep(100 * time.Millisecond)
+	_, errs = v.ObjectBatch(context.Background(), objects[:1], []bool{false}, cfg)
+	require.Len(t, client.requests(), 3)
+	_, errs = v.ObjectBatch(context.Background(), fine, []bool{false}, cfg)
+	require.ErrorIs(t, errs[0], ErrCircuitOpen)
+	require.Len(t, client.requests(), 3)
+
+	// a successful probe closes it
+	time.Sleep(100 * time.Millisecond)
+	vecs, errs := v.ObjectBatch(context.Background(), fine, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+	require.NotNil(t, vecs[0])
+	_, errs = v.ObjectBatch(context.Background(), objects[:1], []bool{false}, cfg)
+	require.NotErrorIs(t, errs[0], ErrCircuitOpen)
+	require.Len(t, client.requests(), 5)
+}
+
+func TestBatchCircuitBreakerProbeSize(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithOverloadRetries(RetryConfig{MaxRetries: 0}),
+		WithCircuitBreaker(1, 50*time.Millisecond, 2))
+	batch := func(texts ...string) map[int]error {
+		objects := make([]*models.Object, len(texts))
+		for i := range texts {
+			objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+		}
+		_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+		return errs
+	}
+
+	// the first request of the vectorizer only probes the rate limits
+	require.Len(t, batch("first"), 0)
+	require.Len(t, batch("server error 100 first", "a"), 2)
+	require.Len(t, client.requests(), 2)
+
+	// the probe after the cooldown fails, the rest of the request is not sent
+	time.Sleep(50 * time.Millisecond)
+	errs := batch("server error 100 second", "a", "b")
+	require.Len(t, errs, 3)
+	assert.ErrorIs(t, errs[2], ErrCircuitOpen)
+	require.Len(t, client.requests(), 3)
+	assert.Equal(t, []string{"server error 100 second", "a"}, client.requests()[2])
+
+	// the probe succeeds and the rest follows in one request
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, batch("a", "b", "c", "d", "e"), 0)
+	require.Len(t, client.requests(), 5)
+	assert.Equal(t, []string{"a", "b"}, client.requests()[3])
+	assert.Equal(t, []string{"c", "d", "e"}, client.requests()[4])
+
+	// without an open breaker requests are not limited
+	require.Len(t, batch("a", "b", "c"), 0)
+	require.Len(t, client.requests(), 6)
+	assert.Len(t, client.requests()[5], 3)
+}
+
+func TestBatchRetryOnTotalFailure(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+
+	t.Run("the whole batch is retried once", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithBatchRetry(50*time.Millisecond))
+
+		start := time.Now()
+		vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 2"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 2"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		}, []bool{false, false, true}, cfg)
+
+		require.Len(t, errs, 0)
+		require.NotNil(t, vecs[0])
+		require.NotNil(t, vecs[1])
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("at most once", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithBatchRetry(10*time.Millisecond))
+
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "overloaded 2"}},
+		}, []bool{false}, cfg)
+
+		require.ErrorIs(t, errs[0], clients.ErrModelOverloaded)
+		require.Len(t, client.requests(), 2)
+	})
+
+	t.Run("partial and non-retryable failures are not retried", func(t *testing.T) {
+		for _, texts := range [][]string{{"overloaded 1", "second"}, {"error something"}} {
+			client := &fakeBatchClient{}
+			v := New(client, 40*time.Second, logger, WithBatchRetry(10*time.Millisecond))
+			objects := make([]*models.Object, len(texts))
+			for i := range texts {
+				objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+			}
+
+			_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+			require.Len(t, errs, 1)
+			require.Len(t, client.requests(), len(texts))
+		}
+	})
+}
+
+func TestMaxInFlightTokens(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	tke, err := tokenEncoder(DefaultOpenAIModel)
+	require.NoError(t, err)
+	countTokens := func(text string) int { return clients.GetTokensCount(DefaultOpenAIModel, text, tke) }
+
+	text := "wait 30 some text with a few tokens"
+	tokens := countTokens(text)
+	maxTokens := 2*tokens + tokens/2
+	client := &fakeBatchClient{countTokens: countTokens}
+	v := New(client, 40*time.Second, logger, WithMaxInFlightTokens(int64(maxTokens)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := v.Object(context.Background(), &models.Object{Class: "Car", Properties: map[string]interface{}{"test": text}}, cfg)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": text}},
+			{Class: "Car", Properties: map[string]interface{}{"test": text}},
+			{Class: "Car", Properties: map[string]interface{}{"test": text}},
+		}, []bool{false, false, false}, cfg)
+		assert.Len(t, errs, 0)
+	}()
+	wg.Wait()
+
+	client.Lock()
+	defer client.Unlock()
+	assert.LessOrEqual(t, client.maxInFlightTokens, maxTokens)
+	// small requests still run concurrently
+	assert.Greater(t, client.maxInFlightTokens, tokens)
+	assert.Equal(t, 0, client.inFlightTokens)
+}
+
+func TestBatchNilObject(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger)
+
+	skip := []bool{false, false, false}
+	vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		nil,
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}, skip, cfg)
+
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[1], ErrNilObject)
+	assert.Nil(t, vecs[1])
+	assert.NotNil(t, vecs[0])
+	assert.NotNil(t, vecs[2])
+	assert.Equal(t, []bool{false, false, false}, skip)
+	for _, request := range client.requests() {
+		assert.NotContains(t, request, "")
+	}
+}
+
+func TestBatchArguments(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+
+	t.Run("empty batch", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		for _, objects := range [][]*models.Object{nil, {}} {
+			vecs, errs := v.ObjectBatch(context.Background(), objects, nil, cfg)
+			require.NotNil(t, vecs)
+			require.NotNil(t, errs)
+			assert.Len(t, vecs, 0)
+			assert.Len(t, errs, 0)
+		}
+		assert.Empty(t, client.requests())
+		// the limiter still waits for the first request
+		assert.Equal(t, RateLimitStatus{}, v.RateLimitStatus(context.Background(), cfg))
+		assert.True(t, v.existingLane(context.Background(), cfg).workerState.firstRequest)
+		tokens, requests := v.Usage()
+		assert.Zero(t, tokens)
+		assert.Zero(t, requests)
+	})
+
+	t.Run("skip list of a different length", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		objects := []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		}
+
+		for _, skip := range [][]bool{nil, {false}, {false, false, false}} {
+			vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+			require.Len(t, vecs, 2)
+			require.Len(t, errs, 2)
+			assert.Nil(t, vecs[0])
+			assert.ErrorIs(t, errs[0], ErrSkipObjectMismatch)
+			assert.ErrorIs(t, errs[1], ErrSkipObjectMismatch)
+
+			assert.Len(t, v.ValidateBatch(context.Background(), objects, skip, cfg), 2)
+			for result := range v.ObjectBatchStream(context.Background(), objects, skip, cfg) {
+				assert.ErrorIs(t, result.Err, ErrSkipObjectMismatch)
+			}
+		}
+		assert.EqualError(t, checkSkipObject(objects, []bool{false}),
+			"skip list does not match the objects: got 1 entries for 2 objects")
+		assert.Empty(t, client.requests())
+	})
+}
+
+func TestBatchImportBudget(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger)
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}
+
+	ctx := ContextWithImportBudget(context.Background(), NewImportBudget(200*time.Millisecond))
+	_, errs := v.ObjectBatch(ctx, objects, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+	requestCount := len(client.requests())
+
+	require.Eventually(t, ImportBudgetFromContext(ctx).Exhausted, time.Second, 10*time.Millisecond)
+	start := time.Now()
+	vecs, errs := v.ObjectBatch(ctx, objects, []bool{false, true}, cfg)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrImportTimeBudgetExceeded)
+	assert.Nil(t, vecs[0])
+	assert.Len(t, client.requests(), requestCount)
+
+	// calls of other imports are not affected
+	_, errs = v.ObjectBatch(context.Background(), objects, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+	assert.Greater(t, len(client.requests()), requestCount)
+}
+
+func TestBatchAssemblyPrefetch(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := make([]*models.Object, 50)
+	skip := make([]bool, len(objects))
+	for i := range objects {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("object %d", i)}}
+		skip[i] = i%7 == 3
+	}
+	objects[11] = nil
+	objects[22].Properties = map[string]interface{}{"test": "error something"}
+
+	// prefetching must not change requests or results
+	var requests [][][]string
+	var results [][]BatchResult
+	for _, opts := range [][]Option{nil, {WithAssemblyPrefetch()}} {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, opts...)
+		results = append(results, v.ObjectBatchResults(context.Background(), objects, skip, cfg))
+		requests = append(requests, client.requests())
+	}
+	assert.Equal(t, requests[0], requests[1])
+	for i := range objects {
+		assert.Equal(t, results[0][i].Vector, results[1][i].Vector)
+		assert.Equal(t, results[0][i].Err, results[1][i].Err)
+	}
+	assert.ErrorIs(t, results[1][11].Err, ErrNilObject)
+	assert.EqualError(t, results[1][22].Err, "something")
+}
+
+func BenchmarkObjectBatchAssemblyPrefetch(b *testing.B) {
+	cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := make([]*models.Object, 500)
+	for i := range objects {
+		properties := map[string]interface{}{}
+		for j := 0; j < 10; j++ {
+			properties[fmt.Sprintf("property%d", j)] = fmt.Sprintf("the value of property %d of object number %d", j, i)
+		}
+		objects[i] = &models.Object{Class: "Car", Properties: properties}
+	}
+	skip := make([]bool, len(objects))
+
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "without prefetch"},
+		{name: "with prefetch", opts: []Option{WithAssemblyPrefetch()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			// large objects and large requests make assembling the inputs a considerable part of the batch time
+			client := &fakeBatchClient{latency: 5 * time.Millisecond, remainingTokens: 5000}
+			v := New(client, 40*time.Second, logger, bm.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+				require.Len(b, errs, 0)
+			}
+		})
+	}
+}
+
+func TestBatchQuotaExhausted(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithBatchRetry(10*time.Millisecond),
+		WithOverloadRetries(RetryConfig{MaxRetries: 3, BaseBackoff: time.Millisecond}))
+
+	// the first request fails
+	_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "insufficient quota"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}, []bool{false, false}, cfg)
+	require.Len(t, errs, 2)
+	require.Len(t, client.requests(), 1)
+
+	// a later request fails
+	_, errs = v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+	}, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+	requestCount := len(client.requests())
+
+	objects := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "insufficient quota"}}}
+	for i := 0; i < 20; i++ {
+		objects = append(objects, &models.Object{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("object %d", i)}})
+	}
+	skip := make([]bool, len(objects))
+	skip[5] = true
+	_, errs = v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+	// neither the request nor the batch are retried and the rest of the batch is not sent
+	require.Len(t, errs, len(objects)-1)
+	for i := range errs {
+		require.ErrorIs(t, errs[i], clients.ErrQuotaExhausted)
+	}
+	assert.Len(t, client.requests(), requestCount+1)
+}
+
+func TestBatchMaxInputFraction(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	long := strings.Repeat("word ", 30)
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": long}},
+	}
+	tke, err := tokenEncoder(DefaultOpenAIModel)
+	require.NoError(t, err)
+
+	// ada-002 has a context window of 8191 tokens
+	classConfig := map[string]interface{}{"vectorizeClassName": false, "maxInputFraction": 0.002}
+	settings := NewClassSettings(&fakeClassConfig{classConfig: classConfig})
+	require.Equal(t, 8191, settings.ContextWindow())
+	require.Equal(t, 16, settings.InputTokenCap())
+
+	for _, opts := range [][]Option{nil, {WithAssemblyPrefetch()}} {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, opts...)
+		vecs, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false}, &fakeClassConfig{classConfig: classConfig})
+
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[1], ErrInputTooLong)
+		assert.NotNil(t, vecs[0])
+		assert.Equal(t, [][]string{{"first"}}, client.requests())
+	}
+
+	t.Run("truncate", func(t *testing.T) {
+		classConfig := map[string]interface{}{"vectorizeClassName": false, "maxInputFraction": 0.002, "inputTruncation": "truncate"}
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false}, &fakeClassConfig{classConfig: classConfig})
+
+		require.Len(t, errs, 0)
+		requests := client.requests()
+		require.Len(t, requests, 2)
+		assert.True(t, strings.HasPrefix(long, requests[1][0]))
+		assert.Len(t, tke.Encode(requests[1][0], nil, nil), 16)
+	})
+}
+
+func TestBatchTruncateInput(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	long := "first " + strings.Repeat("word ", 9000) + "last"
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "short"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": long}},
+	}
+	tke, err := tokenEncoder("ada")
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode   string
+		prefix string
+		suffix string
+	}{
+		{mode: TruncateInputHead, prefix: "first word", suffix: "word word"},
+		{mode: TruncateInputTail, prefix: " word", suffix: "word last"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			classConfig := map[string]interface{}{"vectorizeClassName": false, "truncateInput": tt.mode}
+			client := &fakeBatchClient{remainingTokens: 20000}
+			v := New(client, 40*time.Second, logger)
+			results := v.ObjectBatchResults(context.Background(), objects, []bool{false, false}, &fakeClassConfig{classConfig: classConfig})
+
+			require.NoError(t, results[0].Err)
+			require.NoError(t, results[1].Err)
+			requests := client.requests()
+			require.Len(t, requests, 2)
+			truncated := requests[1][0]
+			assert.True(t, strings.HasPrefix(truncated, tt.prefix))
+			assert.True(t, strings.HasSuffix(truncated, tt.suffix))
+			// the encoding and the overhead of the input fill the context window completely
+			assert.Equal(t, 8191-3, len(tke.Encode(truncated, nil, nil)))
+			assert.Equal(t, 8191, results[1].Tokens)
+		})
+	}
+
+	t.Run(TruncateInputNone, func(t *testing.T) {
+		classConfig := map[string]interface{}{"vectorizeClassName": false}
+		client := &fakeBatchClient{remainingTokens: 20000}
+		v := New(client, 40*time.Second, logger)
+		_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false}, &fakeClassConfig{classConfig: classConfig})
+
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[1], ErrTextTooLong)
+		assert.Equal(t, [][]string{{"short"}}, client.requests())
+	})
+}
+
+func TestBatchOrganizationAndProject(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "first"}}}
+
+	client := &fakeBatchClient{}
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"organization": "org-1", "project": "proj-1"}}
+	_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+	assert.Equal(t, "org-1", client.lastConfig.Organization)
+	assert.Equal(t, "proj-1", client.lastConfig.Project)
+
+	t.Run("mixed-case IDs are kept", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"organization": "org-AbC123", "project": "proj_XyZ789"}}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, "org-AbC123", client.lastConfig.Organization)
+		assert.Equal(t, "proj_XyZ789", client.lastConfig.Project)
+	})
+
+	t.Run("unset by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false}, &fakeClassConfig{})
+		require.Len(t, errs, 0)
+		assert.Empty(t, client.lastConfig.Organization)
+		assert.Empty(t, client.lastConfig.Project)
+	})
+}
+
+func TestBatchAzureConfig(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": "first"}}}
+
+	client := &fakeBatchClient{}
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{
+		"baseURL": "https://proxy.example.com/azure", "deploymentId": "embeddings", "isAzure": true, "apiVersion": "2024-02-01",
+	}}
+	_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+	assert.True(t, client.lastConfig.IsAzure)
+	assert.Equal(t, "https://proxy.example.com/azure", client.lastConfig.BaseURL)
+	assert.Equal(t, "embeddings", client.lastConfig.DeploymentID)
+	assert.Equal(t, "2024-02-01", client.lastConfig.APIVersion)
+
+	t.Run("standard OpenAI by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false}, &fakeClassConfig{})
+		require.Len(t, errs, 0)
+		assert.False(t, client.lastConfig.IsAzure)
+		assert.Equal(t, DefaultBaseURL, client.lastConfig.BaseURL)
+		assert.Empty(t, client.lastConfig.APIVersion)
+	})
+}
+
+func TestBatchRateLimitStatus(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "baseURL": "https://first"}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}
+
+	v := New(&fakeBatchClient{}, 40*time.Second, logger, WithRateLimitLanes())
+	assert.Equal(t, RateLimitStatus{}, v.RateLimitStatus(context.Background(), cfg))
+
+	start := time.Now()
+	_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+
+	status := v.RateLimitStatus(context.Background(), cfg)
+	assert.Equal(t, 100, status.RemainingTokens)
+	assert.Equal(t, 100, status.RemainingRequests)
+	// the fake client reports that the token limit resets within 60 seconds
+	assert.WithinDuration(t, start.Add(60*time.Second), status.NextAvailable, 5*time.Second)
+
+	other := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "baseURL": "https://second"}}
+	assert.Equal(t, RateLimitStatus{}, v.RateLimitStatus(context.Background(), other))
+}
+
+func TestBatchRateLimitResetInterval(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	// more than the 10 tokens that remain after the first batch, but less than the limit of 20 tokens
+	long := []*models.Object{{Class: "Car", Properties: map[string]interface{}{"test": strings.Repeat("long ", 14)}}}
+
+	run := func(t *testing.T, resetRate int) (time.Duration, map[int]error) {
+		client := &fakeBatchClient{defaultResetRate: resetRate}
+		v := New(client, 2*time.Second, logger)
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 10"}},
+		}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+
+		// the token limit refills while the vectorizer is idle
+		time.Sleep(1100 * time.Millisecond)
+		start := time.Now()
+		_, errs = v.ObjectBatch(context.Background(), long, []bool{false}, cfg)
+		return time.Since(start), errs
+	}
+
+	t.Run("short reset interval", func(t *testing.T) {
+		took, errs := run(t, 1)
+		require.Len(t, errs, 0)
+		// the limit was reset completely before the batch, so it doesn't wait for a refill
+		assert.Less(t, took, 500*time.Millisecond)
+	})
+
+	t.Run("minute reset interval", func(t *testing.T) {
+		// the missing tokens only refill within more than half a minute, which doesn't fit into the batch time
+		_, errs := run(t, 60)
+		require.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "Cannot wait for token refresh")
+	})
+}
+
+func TestBatchRateLimitHeaders(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := make([]bool, len(objects))
+
+	t.Run("the remaining tokens and requests of the server are adopted", func(t *testing.T) {
+		client := &fakeBatchClient{rateLimitHeaders: map[string]string{
+			"x-ratelimit-remaining-tokens":   "37",
+			"x-ratelimit-remaining-requests": "12",
+		}}
+		v := New(client, 40*time.Second, logger)
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 0)
+
+		status := v.RateLimitStatus(context.Background(), cfg)
+		assert.Equal(t, 37, status.RemainingTokens)
+		assert.Equal(t, 12, status.RemainingRequests)
+	})
+
+	t.Run("missing limit headers keep the known limits", func(t *testing.T) {
+		client := &fakeBatchClient{rateLimitHeaders: map[string]string{
+			"x-ratelimit-limit-tokens":   "",
+			"x-ratelimit-limit-requests": "",
+			"x-ratelimit-reset-tokens":   "",
+		}}
+		v := New(client, 40*time.Second, logger, WithModelLimits(map[string]ModelLimits{
+			"ada": {TokensPerMinute: 1000, RequestsPerMinute: 10},
+		}))
+
+		// without the known token limit all objects would be too long
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 0)
+		for i := range objects {
+			assert.NotNil(t, vecs[i])
+		}
+
+		status := v.RateLimitStatus(context.Background(), cfg)
+		assert.Equal(t, 100, status.RemainingTokens)
+		// the reset of the seeded token limit is kept as well
+		assert.WithinDuration(t, time.Now().Add(60*time.Second), status.NextAvailable, 5*time.Second)
+	})
+
+	t.Run("resets below a second are rounded up", func(t *testing.T) {
+		client := &fakeBatchClient{rateLimitHeaders: map[string]string{
+			"x-ratelimit-remaining-tokens":   "200",
+			"x-ratelimit-remaining-requests": "0",
+			"x-ratelimit-reset-requests":     "120ms",
+		}}
+		v := New(client, 40*time.Second, logger)
+
+		_, errs := v.ObjectBatch(context.Background(), objects[:1], skip[:1], cfg)
+		require.Len(t, errs, 0)
+
+		status := v.RateLimitStatus(context.Background(), cfg)
+		assert.WithinDuration(t, time.Now().Add(time.Second), status.NextAvailable, 200*time.Millisecond)
+	})
+}
+
+func TestBatchJobID(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	// the second object doesn't fit into the remaining 5 tokens and has to wait for the token limit
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "long long long"}},
+	}
+
+	logger, hook := test.NewNullLogger()
+	client := &fakeBatchClient{defaultResetRate: 1}
+	v := New(client, 40*time.Second, logger)
+	_, errs := v.ObjectBatch(ContextWithJobID(context.Background(), "import-42"), objects, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+
+	assert.Equal(t, "import-42", client.lastJobID)
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, "text2vec_openai_rate_limit_wait", hook.LastEntry().Data["action"])
+	assert.Equal(t, "import-42", hook.LastEntry().Data["job_id"])
+
+	t.Run("without job ID", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		client := &fakeBatchClient{defaultResetRate: 1}
+		v := New(client, 40*time.Second, logger)
+		_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false}, cfg)
+		require.Len(t, errs, 0)
+
+		assert.Empty(t, client.lastJobID)
+		require.NotNil(t, hook.LastEntry())
+		assert.NotContains(t, hook.LastEntry().Data, "job_id")
+	})
+}
+
+func TestBatchResponseCountMismatch(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fourth"}},
+	}
+
+	// the seeded limits skip the first request with a single object, so all objects end up in the same request
+	client := &fakeBatchClient{missingVectors: 2}
+	v := New(client, 40*time.Second, logger, WithModelLimits(DefaultModelLimits))
+	vecs, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+	require.Equal(t, [][]string{{"first", "second", "third", "fourth"}}, client.requests())
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[2], clients.ErrResponseCountMismatch)
+	assert.ErrorIs(t, errs[3], clients.ErrResponseCountMismatch)
+	assert.Equal(t, []float32{0, 1, 2, 3}, vecs[0])
+	assert.Equal(t, []float32{0, 1, 2, 3}, vecs[1])
+	assert.Nil(t, vecs[2])
+	assert.Nil(t, vecs[3])
+}
+
+func TestBatchMinRequestInterval(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+
+	// the first request has a single object to discover the rate limits, the others follow in a second request
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithMinRequestInterval(200*time.Millisecond))
+	_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+	require.Len(t, errs, 0)
+	require.Equal(t, [][]string{{"first"}, {"second", "third"}}, client.requests())
+	assert.GreaterOrEqual(t, client.requestTimes[1].Sub(client.requestTimes[0]), 200*time.Millisecond)
+
+	t.Run("the interval does not fit into the batch time", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 100*time.Millisecond, logger, WithMinRequestInterval(time.Second))
+		vecs, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+		assert.NotNil(t, vecs[0])
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[1], errRequestIntervalTimeout)
+		assert.ErrorIs(t, errs[2], errRequestIntervalTimeout)
+		assert.Equal(t, [][]string{{"first"}}, client.requests())
+	})
+}
+
+func TestBatchSplitLogging(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "tokens 25"}}, // set limit so next 3 objects are one batch
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object second batch"}}, // rate is 100 again
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object second batch"}},
+	}
+	splits := func(hook *test.Hook) []logrus.Fields {
+		var fields []logrus.Fields
+		for _, entry := range hook.AllEntries() {
+			if entry.Data["action"] == "text2vec_openai_batch_split" {
+				assert.Equal(t, logrus.DebugLevel, entry.Level)
+				fields = append(fields, entry.Data)
+			}
+		}
+		return fields
+	}
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	v := New(&fakeBatchClient{}, 40*time.Second, logger)
+	_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+	require.Len(t, errs, 0)
+
+	logged := splits(hook)
+	require.Len(t, logged, 2)
+	assert.Equal(t, splitLimitTokens, logged[0]["limit"])
+	assert.Equal(t, 1, logged[0]["first_index"])
+	assert.Equal(t, 3, logged[0]["last_index"])
+	assert.Equal(t, 3, logged[0]["objects"])
+	assert.Equal(t, 25, logged[0]["remaining_tokens"])
+	assert.Greater(t, logged[0]["tokens"], 0)
+	assert.Equal(t, time.Duration(0), logged[0]["wait"])
+	assert.Equal(t, splitLimitEnd, logged[1]["limit"])
+	assert.Equal(t, 4, logged[1]["first_index"])
+	assert.Equal(t, 5, logged[1]["last_index"])
+
+	t.Run("nothing is logged above debug level", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+		_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+		require.Len(t, errs, 0)
+		assert.Empty(t, splits(hook))
+	})
+}
+
+func TestBatchTokenBudget(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "tokens 25"}}, // 25 tokens remaining, the limit is 50
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third object"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fourth object"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fifth object"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "sixth object"}},
+	}
+	skip := make([]bool, len(objects))
+	requestSizes := func(client *fakeBatchClient) []int {
+		var sizes []int
+		for _, request := range client.requests() {
+			sizes = append(sizes, len(request))
+		}
+		return sizes
+	}
+
+	logger, hook := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+	require.Len(t, errs, 0)
+	withoutBudget := requestSizes(client)
+	require.Greater(t, len(withoutBudget), 2)
+
+	client = &fakeBatchClient{}
+	ctx := ContextWithTokenBudget(context.Background(), 45)
+	_, errs = New(client, 40*time.Second, logger).ObjectBatch(ctx, objects, skip, cfg)
+	require.Len(t, errs, 0)
+	assert.Equal(t, []int{1, 6}, requestSizes(client))
+	assert.Nil(t, hook.LastEntry())
+
+	t.Run("clamped to the token limit", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		ctx := ContextWithTokenBudget(context.Background(), 1000)
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(ctx, objects, skip, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, []int{1, 6}, requestSizes(client))
+		require.NotNil(t, hook.LastEntry())
+		assert.Equal(t, "text2vec_openai_token_budget", hook.LastEntry().Data["action"])
+		assert.Equal(t, 50, hook.LastEntry().Data["limit"])
+	})
+
+	t.Run("lower than the remaining tokens", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		ctx := ContextWithTokenBudget(context.Background(), 1)
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(ctx, objects, skip, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, withoutBudget, requestSizes(client))
+	})
+}
+
+func TestBatchDedupeInputs(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	texts := []string{"boilerplate", "first", "boilerplate", "error broken", "second", "boilerplate", "error broken"}
+	objects := make([]*models.Object, len(texts))
+	for i, text := range texts {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": text}}
+	}
+	skip := make([]bool, len(objects))
+
+	client := &fakeBatchClient{echoVectors: true}
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "dedupeInputs": true}}
+	results := New(client, 40*time.Second, logger).ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+	var sent []string
+	for _, request := range client.requests() {
+		sent = append(sent, request...)
+	}
+	assert.ElementsMatch(t, []string{"boilerplate", "first", "error broken", "second"}, sent)
+	for i, text := range texts {
+		if text == "error broken" {
+			assert.EqualError(t, results[i].Err, "broken")
+			continue
+		}
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, echoVector(text), results[i].Vector, text)
+	}
+	// only the first of the duplicates is vectorized and costs tokens
+	assert.Greater(t, results[0].Tokens, 0)
+	assert.Zero(t, results[2].Tokens)
+	assert.Zero(t, results[5].Tokens)
+	assert.Equal(t, make([]bool, len(objects)), skip)
+
+	t.Run("duplicates are vectorized by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 2)
+		sent := 0
+		for _, request := range client.requests() {
+			sent += len(request)
+		}
+		assert.Equal(t, len(objects), sent)
+	})
+}
+
+func TestBatchRequestIDs(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error broken"}},
+	}
+
+	client := &fakeBatchClient{requestID: "req-123"}
+	_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false, false}, cfg)
+
+	require.Len(t, errs, 1)
+	requestID, ok := clients.RequestID(errs[1])
+	require.True(t, ok)
+	assert.Equal(t, "req-123", requestID)
+	assert.EqualError(t, errs[1], "broken (request ID: req-123)")
+
+	var logged []interface{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["action"] == "text2vec_openai_request" {
+			logged = append(logged, entry.Data["request_id"])
+		}
+	}
+	assert.Equal(t, []interface{}{"req-123", "req-123"}, logged)
+}
+
+func TestBatchOfflineMode(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	client := clients.NewOffline(64, logger)
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+	}
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+
+	v := New(client, 40*time.Second, logger)
+	vecs, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false, false}, cfg)
+	require.Len(t, errs, 0)
+	for i := range vecs {
+		assert.Len(t, vecs[i], 64)
+	}
+	assert.Equal(t, vecs[0], vecs[2])
+	assert.NotEqual(t, vecs[0], vecs[1])
+
+	// a new vectorizer produces the same vectors, also for single objects
+	vecsAgain, errs := New(clients.NewOffline(64, logger), 40*time.Second, logger).ObjectBatch(context.Background(), objects, []bool{false, false, false}, cfg)
+	require.Len(t, errs, 0)
+	assert.Equal(t, vecs, vecsAgain)
+	vec, _, err := v.Object(context.Background(), objects[1], cfg)
+	require.NoError(t, err)
+	assert.Equal(t, vecs[1], vec)
+
+	t.Run("dimensions setting", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{
+			"vectorizeClassName": false, "model": "text-embedding-3-small", "dimensions": 512,
+		}}
+		vecs, errs := v.ObjectBatch(context.Background(), objects[:1], []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		assert.Len(t, vecs[0], 512)
+	})
+}
+
+func TestBatchVectorsMatchObjectIndices(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	texts := []string{
+		"tokens 13", // first request, lowers the rate limit so the next objects need separate requests
+		"skipped first",
+		"first text",
+		"error broken",
+		"requests 0 second text", // waits for the request limit to reset
+		"skipped second",
+		"overloaded 1 third text",
+		"ratelimited 1 fourth text",
+		"error also broken",
+		"fifth text long long long long long long", // doesn't fit into the remaining tokens and waits for the reset
+		"sixth text",
+	}
+	skip := make([]bool, len(texts))
+	objects := make([]*models.Object, len(texts))
+	for i, text := range texts {
+		skip[i] = strings.HasPrefix(text, "skipped ")
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": text}}
+	}
+	retries := RetryConfig{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond}
+
+	client := &fakeBatchClient{defaultResetRate: 1, echoVectors: true}
+	v := New(client, 10*time.Second, logger, WithOverloadRetries(retries), WithRateLimitRetries(retries))
+	vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+	require.Len(t, vecs, len(objects))
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[3], "broken")
+	assert.EqualError(t, errs[8], "also broken")
+	for i, text := range texts {
+		if _, failed := errs[i]; skip[i] || failed {
+			assert.Nil(t, vecs[i], text)
+			continue
+		}
+		assert.Equal(t, echoVector(text), vecs[i], text)
+	}
+	// the objects were spread over several requests
+	assert.Greater(t, len(client.requests()), 3)
+}
+
+func TestBatchRateLimitRetries(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "ratelimited 2"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := []bool{false, false, false}
+	retries := RetryConfig{MaxRetries: 2, BaseBackoff: 10 * time.Millisecond}
+
+	t.Run("recovers after backoff", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithRateLimitRetries(retries))
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		for i := range vecs {
+			require.NotNil(t, vecs[i])
+		}
+		// the first object discovers the rate limits, the rest is one sub-batch that is sent three times
+		requests := client.requests()
+		require.Len(t, requests, 4)
+		assert.Equal(t, requests[1], requests[3])
+	})
+
+	t.Run("fails once retries are exhausted", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithRateLimitRetries(RetryConfig{MaxRetries: 1, BaseBackoff: 10 * time.Millisecond}))
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[1], clients.ErrRateLimited)
+		assert.ErrorIs(t, errs[2], clients.ErrRateLimited)
+	})
+
+	t.Run("not retried by default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 2)
+		assert.Len(t, client.requests(), 2)
+	})
+
+	t.Run("Retry-After takes precedence over the backoff", func(t *testing.T) {
+		client := &fakeBatchClient{retryAfter: 200 * time.Millisecond}
+		v := New(client, 40*time.Second, logger, WithRateLimitRetries(RetryConfig{MaxRetries: 2, BaseBackoff: time.Millisecond}))
+
+		start := time.Now()
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("retries stop at the context deadline", func(t *testing.T) {
+		client := &fakeBatchClient{retryAfter: time.Minute}
+		v := New(client, 40*time.Second, logger, WithRateLimitRetries(retries))
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[1], clients.ErrRateLimited)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestBatchModelLimits(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := []bool{false, false, false}
+
+	t.Run("seeded limits replace the first request", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithModelLimits(DefaultModelLimits))
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		assert.Equal(t, [][]string{{"first", "second", "third"}}, client.requests())
+		assert.Empty(t, hook.AllEntries())
+	})
+
+	t.Run("seeded limits bound the first requests", func(t *testing.T) {
+		logger, _ := test.NewNullLogger()
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithModelLimits(map[string]ModelLimits{
+			DefaultOpenAIModel: {TokensPerMinute: 10, RequestsPerMinute: 100},
+		}))
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		// every object has 4 tokens and at most 95% of the 10 seeded tokens are used for a request
+		requests := client.requests()
+		require.GreaterOrEqual(t, len(requests), 2)
+		assert.Equal(t, []string{"first", "second"}, requests[0])
+	})
+
+	t.Run("unknown models use conservative limits", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithModelLimits(DefaultModelLimits))
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "model": "babbage"}}
+
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		assert.Len(t, client.requests(), 1)
+		require.Len(t, hook.AllEntries(), 1)
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, "babbage", hook.LastEntry().Data["model"])
+	})
+
+	t.Run("seeded limits are kept without rate limit headers", func(t *testing.T) {
+		logger, _ := test.NewNullLogger()
+		client := &fakeBatchClient{withoutRateLimits: true}
+		v := New(client, 40*time.Second, logger, WithModelLimits(DefaultModelLimits))
+
+		for i := 0; i < 2; i++ {
+			_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+			require.Len(t, errs, 0)
+		}
+		assert.Len(t, client.requests(), 2)
+	})
+
+	t.Run("fallback limits are not kept without rate limit headers", func(t *testing.T) {
+		logger, _ := test.NewNullLogger()
+		client := &fakeBatchClient{withoutRateLimits: true}
+		v := New(client, 40*time.Second, logger, WithModelLimits(DefaultModelLimits))
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "model": "babbage"}}
+
+		v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		// like after a first request, the limits are the ones the response reported
+		v.lane.workerLock.Lock()
+		defer v.lane.workerLock.Unlock()
+		assert.Equal(t, ent.RateLimits{}, *v.lane.workerState.rateLimit)
+	})
+}
+
+func TestBatchMaxObjectsPerRequest(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	// the token budget of 100 fits all objects into a single request
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "set limit"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object second batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object second batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object third batch"}},
+	}
+	skip := []bool{false, false, false, true, false, false, false}
+
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(2))
+	vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+	require.Len(t, errs, 0)
+	for i := range objects {
+		if skip[i] {
+			assert.Nil(t, vecs[i])
+		} else {
+			assert.NotNil(t, vecs[i])
+		}
+	}
+	assert.Equal(t, [][]string{
+		{"set limit"},
+		{"first object first batch", "second object first batch"},
+		{"first object second batch", "second object second batch"},
+		{"first object third batch"},
+	}, client.requests())
+
+	t.Run("default", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		assert.Len(t, client.requests(), 2)
+	})
+}
+
+func TestBatchWithoutRateLimit(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	// together the objects have more tokens than the 100 remaining tokens of the fake
+	objects := make([]*models.Object, 5)
+	for i := range objects {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": strings.Repeat(fmt.Sprintf("word%d ", i), 30)}}
+	}
+	skip := make([]bool, len(objects))
+
+	client := &fakeBatchClient{}
+	_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+	require.Len(t, errs, 0)
+	require.Greater(t, len(client.requests()), 2)
+
+	client = &fakeBatchClient{}
+	vecs, errs := New(client, 40*time.Second, logger, WithoutRateLimit()).ObjectBatch(context.Background(), objects, skip, cfg)
+	require.Len(t, errs, 0)
+	for i := range objects {
+		assert.NotNil(t, vecs[i])
+	}
+	assert.Len(t, client.requests(), 1)
+
+	t.Run("requests are limited to the max objects", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithoutRateLimit(), WithMaxObjectsPerRequest(2))
+
+		_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, true, false, false, false}, cfg)
+
+		require.Len(t, errs, 0)
+		require.Len(t, client.requests(), 2)
+		assert.Len(t, client.requests()[0], 2)
+		assert.Len(t, client.requests()[1], 2)
+	})
+
+	t.Run("objects before a last object that isn't sent", func(t *testing.T) {
+		tests := []struct {
+			name string
+			last *models.Object
+			skip bool
+		}{
+			{name: "skipped", last: objects[2], skip: true},
+			{name: "nil", last: nil},
+			{name: "empty", last: &models.Object{Class: "Car", Properties: map[string]interface{}{"test": ""}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				client := &fakeBatchClient{}
+				v := New(client, 40*time.Second, logger, WithoutRateLimit())
+
+				vecs, _ := v.ObjectBatch(context.Background(), []*models.Object{objects[0], objects[1], tt.last},
+					[]bool{false, false, tt.skip}, cfg)
+
+				require.Len(t, client.requests(), 1)
+				assert.Len(t, client.requests()[0], 2)
+				assert.NotNil(t, vecs[0])
+				assert.NotNil(t, vecs[1])
+				assert.Nil(t, vecs[2])
+			})
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		vecs, errs := New(client, 40*time.Second, logger, WithoutRateLimit()).ObjectBatch(ctx, objects, skip, cfg)
+
+		require.Len(t, errs, len(objects))
+		for i := range objects {
+			assert.Nil(t, vecs[i])
+		}
+		assert.Len(t, client.requests(), 0)
+	})
+}
+
+func TestBatchTextTooLong(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}}, // set limit to 10 tokens
+		{Class: "Car", Properties: map[string]interface{}{"test": "long long long long, long, long, long, long"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "short"}},
+	}
+
+	v := New(&fakeBatchClient{}, 40*time.Second, logger)
+	_, errs := v.ObjectBatch(context.Background(), objects, []bool{false, false, false}, cfg)
+
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[1], ErrTextTooLong)
+	assert.EqualError(t, errs[1], "text too long for vectorization")
+	var tooLong *TextTooLongError
+	require.ErrorAs(t, errs[1], &tooLong)
+	assert.Equal(t, 10, tooLong.Limit)
+	assert.Greater(t, tooLong.Tokens, tooLong.Limit)
+}
+
+func TestValidateBatch(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+		"vectorizeClassName": false, "maxInputFraction": 0.001, "vectorizeEmptyObjects": true,
+	}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "short"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "long long long long long long long long long long"}},
+		nil,
+		{},
+		{Class: "Car", Properties: map[string]interface{}{"test": "huge"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}
+	skipObject := []bool{false, false, false, false, false, true}
+	counter := func(text string, model string) int {
+		if text == "huge" {
+			return 100000
+		}
+		return len(text)
+	}
+
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithTokenCounter(counter))
+	errs := v.ValidateBatch(context.Background(), objects, skipObject, cfg)
+
+	require.Len(t, errs, 4)
+	assert.ErrorIs(t, errs[1], ErrInputTooLong)
+	assert.ErrorIs(t, errs[2], ErrNilObject)
+	assert.ErrorIs(t, errs[3], ErrEmptyInput)
+	var tooLong *TextTooLongError
+	require.ErrorAs(t, errs[4], &tooLong)
+	assert.Equal(t, 8191, tooLong.Limit)
+	assert.Empty(t, client.requests())
+
+	t.Run("same errors as ObjectBatch", func(t *testing.T) {
+		_, batchErrs := v.ObjectBatch(context.Background(), objects, skipObject, cfg)
+		assert.Equal(t, errs, batchErrs)
+		assert.Equal(t, [][]string{{"short"}}, client.requests())
+	})
+}
+
+func TestBatchEmptyObjects(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": ""}},
+		{Class: "Car", Properties: map[string]interface{}{"test": " \n "}},
+		// objects without properties fall back to the class name
+		{Class: "Car"},
+	}
+	skipObject := make([]bool, len(objects))
+
+	for _, opts := range [][]Option{nil, {WithAssemblyPrefetch()}} {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, opts...)
+		results := v.ObjectBatchResults(context.Background(), objects, skipObject, cfg)
+
+		for i := range results {
+			require.NoError(t, results[i].Err)
+		}
+		assert.NotNil(t, results[0].Vector)
+		assert.Nil(t, results[1].Vector)
+		assert.Nil(t, results[2].Vector)
+		assert.NotNil(t, results[3].Vector)
+		assert.Equal(t, [][]string{{"first"}, {"car"}}, client.requests())
+		assert.Empty(t, v.ValidateBatch(context.Background(), objects, skipObject, cfg))
+
+		t.Run("vectorizeEmptyObjects", func(t *testing.T) {
+			cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "vectorizeEmptyObjects": true}}
+			_, errs := v.ObjectBatch(context.Background(), objects, skipObject, cfg)
+
+			require.Len(t, errs, 2)
+			assert.ErrorIs(t, errs[1], ErrEmptyInput)
+			assert.ErrorIs(t, errs[2], ErrEmptyInput)
+			assert.Equal(t, errs, v.ValidateBatch(context.Background(), objects, skipObject, cfg))
+		})
+	}
+}
+
+func TestBatchTokenCounter(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "set limit"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	var countedModels []string
+	counter := func(text string, model string) int {
+		countedModels = append(countedModels, model)
+		return 40
+	}
+
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithTokenCounter(counter))
+	results := v.ObjectBatchResults(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+	for i := range results {
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, 40, results[i].Tokens)
+	}
+	// only two inputs of 40 tokens fit into the remaining 100 tokens
+	assert.Equal(t, [][]string{{"set limit"}, {"first", "second"}, {"third"}}, client.requests())
+	assert.Equal(t, []string{DefaultOpenAIModel, DefaultOpenAIModel, DefaultOpenAIModel, DefaultOpenAIModel}, countedModels)
+}
+
+func TestBatchRequestTimeout(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "hang 1"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := make([]bool, len(objects))
+
+	t.Run("only the hung request fails", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1),
+			WithRequestTimeout(100*time.Millisecond, RetryConfig{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		vecs, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+		assert.Less(t, time.Since(start), time.Second)
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[1], ErrRequestTimeout)
+		assert.NotNil(t, vecs[0])
+		assert.NotNil(t, vecs[2])
+		assert.Len(t, client.requests(), 3)
+	})
+
+	t.Run("hung requests are retried", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1),
+			WithRequestTimeout(100*time.Millisecond, RetryConfig{MaxRetries: 1, BaseBackoff: time.Millisecond}))
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, 0)
+		for i := range objects {
+			assert.NotNil(t, vecs[i])
+		}
+		assert.Equal(t, [][]string{{"first"}, {"hang 1"}, {"hang 1"}, {"third"}}, client.requests())
+	})
+}
+
+func TestBatchDeadlineGrace(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "slow 400"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := []bool{false, false, false, false}
+	deadlineErr := fmt.Errorf("context deadline exceeded or cancelled")
+
+	t.Run("in-flight requests finish within the grace period", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(2), WithDeadlineGrace(time.Second))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		vecs, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+		// the request with the slow object was sent before the deadline, the last object only afterwards
+		require.Len(t, errs, 1)
+		assert.Equal(t, deadlineErr, errs[3])
+		for i := 0; i < 3; i++ {
+			assert.NotNil(t, vecs[i])
+		}
+		assert.Len(t, client.requests(), 2)
+	})
+
+	t.Run("in-flight requests are cancelled without grace period", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithMaxObjectsPerRequest(2))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		vecs, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+		require.Len(t, errs, 3)
+		assert.ErrorIs(t, errs[1], context.DeadlineExceeded)
+		assert.ErrorIs(t, errs[2], context.DeadlineExceeded)
+		assert.NotNil(t, vecs[0])
+	})
+
+	t.Run("cancelling the context cancels in-flight requests", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithMaxObjectsPerRequest(2), WithDeadlineGrace(time.Second))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+
+		require.Len(t, errs, 3)
+		assert.ErrorIs(t, errs[1], context.Canceled)
+		assert.Less(t, time.Since(start), 400*time.Millisecond)
+	})
+}
+
+func TestBatchRateLimitLanes(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	newConfig := func(baseURL string) *fakeClassConfig {
+		return &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "baseURL": baseURL}}
+	}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "wait 300"}},
+	}
+
+	// runs one batch per config concurrently and returns when each of them finished relative to the start
+	run := func(v *Vectorizer, configs ...*fakeClassConfig) []time.Duration {
+		start := time.Now()
+		finished := make([]time.Duration, len(configs))
+		wg := sync.WaitGroup{}
+		for i := range configs {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs := v.ObjectBatch(context.Background(), objects, []bool{false}, configs[i])
+				assert.Len(t, errs, 0)
+				finished[i] = time.Since(start)
+			}()
+		}
+		wg.Wait()
+		return finished
+	}
+
+	t.Run("batches of different accounts overlap", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithRateLimitLanes())
+		finished := run(v, newConfig("https://first.example.com"), newConfig("https://second.example.com"))
+		for i := range finished {
+			assert.Less(t, finished[i], 550*time.Millisecond)
+		}
+	})
+
+	t.Run("batches of the same account serialize", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithRateLimitLanes())
+		finished := run(v, newConfig("https://first.example.com"), newConfig("https://first.example.com"))
+		assert.GreaterOrEqual(t, max(finished[0], finished[1]), 600*time.Millisecond)
+	})
+
+	t.Run("batches serialize without lanes", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+		finished := run(v, newConfig("https://first.example.com"), newConfig("https://second.example.com"))
+		assert.GreaterOrEqual(t, max(finished[0], finished[1]), 600*time.Millisecond)
+	})
 }
@@ -0,0 +1,90 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BatchStats summarizes a single batch call, see WithOnBatchComplete
+type BatchStats struct {
+	// Objects is the number of objects of the batch, which are either vectorized, skipped or errored
+	Objects    int
+	Vectorized int
+	// Skipped counts the objects that were skipped by the caller or had nothing to vectorize
+	Skipped int
+	Errored int
+	// Tokens is the sum of the tokens of the results of all objects
+	Tokens int
+	// Requests is the number of requests that were sent to OpenAI, including retries
+	Requests int
+	// WaitTime is the time the batch spent waiting for rate limits and before retries
+	WaitTime time.Duration
+	// Duration is the wall-clock duration of the batch call
+	Duration time.Duration
+}
+
+// batchCounters collects the stats of a batch call while its requests are sent
+type batchCounters struct {
+	start    time.Time
+	stats    BatchStats
+	requests atomic.Int64
+	wait     atomic.Int64
+}
+
+// contextWithBatchCounters returns a context whose batch jobs report to the returned counters
+func contextWithBatchCounters(ctx context.Context, objects int) (context.Context, *batchCounters) {
+	counters := &batchCounters{start: time.Now(), stats: BatchStats{Objects: objects}}
+	return context.WithValue(ctx, batchCountersKey, counters), counters
+}
+
+// batchCountersFromContext returns the counters of the batch call of ctx, nil without WithOnBatchComplete
+func batchCountersFromContext(ctx context.Context) *batchCounters {
+	counters, _ := ctx.Value(batchCountersKey).(*batchCounters)
+	return counters
+}
+
+func (c *batchCounters) observeRequest() {
+	if c != nil {
+		c.requests.Add(1)
+	}
+}
+
+func (c *batchCounters) observeWait(d time.Duration) {
+	if c != nil {
+		c.wait.Add(int64(d))
+	}
+}
+
+// observeResult counts the final result of an object of the batch
+func (c *batchCounters) observeResult(result BatchResult, skipped bool) {
+	switch {
+	case result.Err != nil:
+		c.stats.Errored++
+	case !skipped && (result.Vector != nil || len(result.NamedVectors) > 0):
+		c.stats.Vectorized++
+	default:
+		c.stats.Skipped++
+	}
+	c.stats.Tokens += result.Tokens
+}
+
+// finish returns the stats once all results are observed
+func (c *batchCounters) finish() BatchStats {
+	stats := c.stats
+	stats.Requests = int(c.requests.Load())
+	stats.WaitTime = time.Duration(c.wait.Load())
+	stats.Duration = time.Since(c.start)
+	return stats
+}
@@ -0,0 +1,88 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestBatchStats(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "tokens 25"}}, // set limit so next 3 objects are one batch
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object first batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "first object second batch"}}, // rate is 100 again
+		{Class: "Car", Properties: map[string]interface{}{"test": "second object second batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third object second batch"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fourth object second batch"}},
+	}
+	skip := []bool{false, true, false, false, false, true, false, false}
+
+	var stats []BatchStats
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithOnBatchComplete(func(s BatchStats) { stats = append(stats, s) }))
+
+	results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+	require.Len(t, stats, 1)
+	tokens := 0
+	for i := range results {
+		tokens += results[i].Tokens
+	}
+	assert.Equal(t, 8, stats[0].Objects)
+	assert.Equal(t, 5, stats[0].Vectorized)
+	assert.Equal(t, 2, stats[0].Skipped)
+	assert.Equal(t, 1, stats[0].Errored)
+	assert.Equal(t, 35, stats[0].Tokens)
+	assert.Equal(t, tokens, stats[0].Tokens)
+	assert.Equal(t, 3, stats[0].Requests)
+	assert.Len(t, client.requests(), 3)
+	assert.Zero(t, stats[0].WaitTime)
+	assert.Greater(t, stats[0].Duration, time.Duration(0))
+
+	t.Run("streamed batches with retries", func(t *testing.T) {
+		var stats []BatchStats
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger,
+			WithRateLimitRetries(RetryConfig{MaxRetries: 1, BaseBackoff: 20 * time.Millisecond}),
+			WithOnBatchComplete(func(s BatchStats) { stats = append(stats, s) }))
+
+		received := 0
+		for range v.ObjectBatchStream(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "ratelimited 1"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		}, []bool{false, false, true}, cfg) {
+			received++
+		}
+
+		assert.Equal(t, 3, received)
+		require.Len(t, stats, 1)
+		assert.Equal(t, 3, stats[0].Objects)
+		assert.Equal(t, 2, stats[0].Vectorized)
+		assert.Equal(t, 1, stats[0].Skipped)
+		assert.Equal(t, 0, stats[0].Errored)
+		assert.Equal(t, 3, stats[0].Requests)
+		assert.Equal(t, 20*time.Millisecond, stats[0].WaitTime)
+	})
+}
@@ -0,0 +1,85 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreaker fails requests to the vectorizer right away after too many consecutive requests failed, see
+// WithCircuitBreaker. It is shared by all batches of the vectorizer.
+type circuitBreaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	// probeSize is the maximum number of inputs of the probe request
+	probeSize int
+	// failures is the number of consecutive failed requests
+	failures  int
+	open      bool
+	openUntil time.Time
+	// probing is set while the single request that may close an open breaker is in flight
+	probing bool
+}
+
+// allow returns ErrCircuitOpen if no request may be sent. Once the cooldown of an open breaker has passed, a single
+// probe request is allowed, for which allow returns the maximum number of inputs of the probe. It returns 0 if the
+// number of inputs is not limited.
+func (b *circuitBreaker) allow() (int, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	if !b.open {
+		return 0, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return 0, b.openError()
+	}
+	b.probing = true
+	return b.probeSize, nil
+}
+
+// record records the outcome of a request that was allowed and returns ErrCircuitOpen if the breaker opened with
+// it. Requests whose failure says nothing about the health of the provider, e.g. because their batch was cancelled,
+// are ignored.
+func (b *circuitBreaker) record(err error, ignore bool) error {
+	if b == nil {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	probe := b.probing
+	b.probing = false
+	switch {
+	case ignore:
+		return nil
+	case err == nil:
+		b.failures = 0
+		b.open = false
+		return nil
+	}
+	b.failures++
+	if b.failures < b.threshold && !probe {
+		return nil
+	}
+	b.open = true
+	b.openUntil = time.Now().Add(b.cooldown)
+	return b.openError()
+}
+
+func (b *circuitBreaker) openError() error {
+	return fmt.Errorf("%w after %d consecutive failed requests", ErrCircuitOpen, b.failures)
+}
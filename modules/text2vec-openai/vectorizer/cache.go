@@ -0,0 +1,218 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// ExternalCache is a cache of vectors that is provided by the caller, see WithExternalCache. It needs to be safe for
+// concurrent use.
+type ExternalCache interface {
+	// Lookup returns the vector that was stored for the key before, if any
+	Lookup(key string) ([]float32, bool)
+	// Store is called with the vector of every input that was vectorized
+	Store(key string, vector []float32)
+}
+
+// vectorLookup is a cache that batches consult before vectorizing their inputs, see Vectorizer.vectorLookups
+type vectorLookup interface {
+	get(key string) ([]float32, bool)
+	add(key string, vector []float32)
+}
+
+// externalCache adapts an ExternalCache to a vectorLookup
+type externalCache struct {
+	cache ExternalCache
+}
+
+func (c externalCache) get(key string) ([]float32, bool) {
+	return c.cache.Lookup(key)
+}
+
+func (c externalCache) add(key string, vector []float32) {
+	c.cache.Store(key, vector)
+}
+
+// vectorCache is a LRU cache of vectors by vectorizer input. If compression is enabled the vectors are stored as
+// int8 with one scale factor per vector, which needs a quarter of the memory of float32 vectors. The decompressed
+// values are off by at most half the scale factor (max(|v|)/254). If maxAge is set, entries expire maxAge after they
+// were added.
+type vectorCache struct {
+	sync.Mutex
+	capacity int
+	compress bool
+	maxAge   time.Duration
+	entries  *list.List
+	items    map[string]*list.Element
+	// models is the last model reported by the provider per vectorization config, see observeModel
+	models map[string]string
+}
+
+type vectorCacheEntry struct {
+	key       string
+	vector    []float32
+	quantized []int8
+	scale     float32
+	added     time.Time
+}
+
+func newVectorCache(capacity int, compress bool, maxAge time.Duration) *vectorCache {
+	return &vectorCache{
+		capacity: capacity,
+		compress: compress,
+		maxAge:   maxAge,
+		entries:  list.New(),
+		items:    make(map[string]*list.Element, capacity),
+		models:   make(map[string]string),
+	}
+}
+
+// vectorCacheKey identifies an input. Everything that changes the vector for the same text is part of the key.
+func vectorCacheKey(conf ent.VectorizationConfig, text string) string {
+	dimensions := int64(0)
+	if conf.Dimensions != nil {
+		dimensions = *conf.Dimensions
+	}
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%d\x00%s", conf.Type, conf.Model, conf.ModelVersion,
+		conf.BaseURL, conf.ResourceName, conf.DeploymentID, dimensions, text)
+}
+
+func (c *vectorCache) get(key string) ([]float32, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*vectorCacheEntry)
+	if c.maxAge > 0 && time.Since(entry.added) > c.maxAge {
+		c.entries.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.entries.MoveToFront(elem)
+	return entry.decompress(), true
+}
+
+func (c *vectorCache) add(key string, vector []float32) {
+	entry := &vectorCacheEntry{key: key, added: time.Now()}
+	if c.compress {
+		entry.quantized, entry.scale = quantize(vector)
+	} else {
+		entry.vector = append([]float32(nil), vector...)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.entries.PushFront(entry)
+	if c.entries.Len() > c.capacity {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.items, oldest.Value.(*vectorCacheEntry).key)
+	}
+}
+
+// observeModel records the model that the provider reported for a request with the given config. If it differs
+// from the previously reported model all entries of the config are removed, as their vectors are not consistent with
+// vectors of the new model anymore.
+func (c *vectorCache) observeModel(conf ent.VectorizationConfig, model string) {
+	if model == "" {
+		return
+	}
+	prefix := vectorCacheKey(conf, "")
+
+	c.Lock()
+	defer c.Unlock()
+
+	if previous, ok := c.models[prefix]; ok && previous != model {
+		for key, elem := range c.items {
+			if strings.HasPrefix(key, prefix) {
+				c.entries.Remove(elem)
+				delete(c.items, key)
+			}
+		}
+	}
+	c.models[prefix] = model
+}
+
+// observedModel returns the last model that the provider reported for requests with the given config, see
+// observeModel
+func (c *vectorCache) observedModel(conf ent.VectorizationConfig) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	model, ok := c.models[vectorCacheKey(conf, "")]
+	return model, ok
+}
+
+// vectorBytes returns the memory used by the cached vectors, without the keys and bookkeeping
+func (c *vectorCache) vectorBytes() int {
+	c.Lock()
+	defer c.Unlock()
+
+	size := 0
+	for elem := c.entries.Front(); elem != nil; elem = elem.Next() {
+		size += elem.Value.(*vectorCacheEntry).vectorBytes()
+	}
+	return size
+}
+
+func (e *vectorCacheEntry) vectorBytes() int {
+	if e.quantized != nil {
+		return len(e.quantized) + 4
+	}
+	return 4 * len(e.vector)
+}
+
+func (e *vectorCacheEntry) decompress() []float32 {
+	if e.quantized == nil {
+		return append([]float32(nil), e.vector...)
+	}
+	vector := make([]float32, len(e.quantized))
+	for i, q := range e.quantized {
+		vector[i] = float32(q) * e.scale
+	}
+	return vector
+}
+
+// quantize maps the vector linearly to [-127, 127]
+func quantize(vector []float32) ([]int8, float32) {
+	maxAbs := float32(0)
+	for _, f := range vector {
+		if abs := float32(math.Abs(float64(f))); abs > maxAbs {
+			maxAbs = abs
+		}
+	}
+	quantized := make([]int8, len(vector))
+	if maxAbs == 0 {
+		return quantized, 0
+	}
+	scale := maxAbs / 127
+	for i, f := range vector {
+		quantized[i] = int8(math.Round(float64(f / scale)))
+	}
+	return quantized, scale
+}
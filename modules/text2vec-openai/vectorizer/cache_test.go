@@ -0,0 +1,265 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestVectorCache(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vectors := make([][]float32, 10)
+	for i := range vectors {
+		vectors[i] = make([]float32, 1536)
+		for j := range vectors[i] {
+			vectors[i][j] = r.Float32()*2 - 1
+		}
+	}
+
+	raw := newVectorCache(len(vectors), false, 0)
+	compressed := newVectorCache(len(vectors), true, 0)
+	for i := range vectors {
+		raw.add(fmt.Sprint(i), vectors[i])
+		compressed.add(fmt.Sprint(i), vectors[i])
+	}
+
+	t.Run("hits return the vectors within tolerance", func(t *testing.T) {
+		for i := range vectors {
+			vec, ok := raw.get(fmt.Sprint(i))
+			require.True(t, ok)
+			assert.Equal(t, vectors[i], vec)
+
+			vec, ok = compressed.get(fmt.Sprint(i))
+			require.True(t, ok)
+			require.Len(t, vec, len(vectors[i]))
+			for j := range vec {
+				assert.InDelta(t, vectors[i][j], vec[j], 1.0/254)
+			}
+		}
+	})
+
+	t.Run("memory per entry drops", func(t *testing.T) {
+		assert.Equal(t, len(vectors)*1536*4, raw.vectorBytes())
+		assert.Equal(t, len(vectors)*(1536+4), compressed.vectorBytes())
+	})
+
+	t.Run("least recently used entries are evicted", func(t *testing.T) {
+		c := newVectorCache(2, true, 0)
+		c.add("a", vectors[0])
+		c.add("b", vectors[1])
+		_, ok := c.get("a")
+		require.True(t, ok)
+		c.add("c", vectors[2])
+
+		_, ok = c.get("b")
+		assert.False(t, ok)
+		for _, key := range []string{"a", "c"} {
+			_, ok = c.get(key)
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("zero vectors", func(t *testing.T) {
+		c := newVectorCache(1, true, 0)
+		c.add("a", []float32{0, 0})
+		vec, ok := c.get("a")
+		require.True(t, ok)
+		assert.Equal(t, []float32{0, 0}, vec)
+	})
+}
+
+func TestBatchVectorCache(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithVectorCache(10, true))
+
+	vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+	}, []bool{false, false}, cfg)
+	require.Len(t, errs, 1)
+	require.NotNil(t, vecs[0])
+	require.Len(t, client.requests(), 2)
+
+	skip := []bool{false, false, false}
+	vecs, errs = v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}, skip, cfg)
+
+	// failed objects are not cached
+	require.Len(t, errs, 1)
+	requests := client.requests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{"error something", "second"}, requests[2])
+	for j, f := range []float32{0, 1, 2, 3} {
+		assert.InDelta(t, f, vecs[0][j], 3.0/254)
+	}
+	assert.Equal(t, []bool{false, false, false}, skip)
+}
+
+func TestBatchDedupWindow(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithDedupWindow(10, 200*time.Millisecond))
+
+	first, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "duplicate"}},
+	}, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+
+	second, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "duplicate"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+	}, []bool{false, false}, cfg)
+	require.Len(t, errs, 0)
+
+	assert.Equal(t, first[1], second[0])
+	requests := client.requests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{"second"}, requests[2])
+
+	t.Run("duplicates outside the window are vectorized again", func(t *testing.T) {
+		time.Sleep(300 * time.Millisecond)
+
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "duplicate"}},
+		}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+
+		requests := client.requests()
+		require.Len(t, requests, 4)
+		assert.Equal(t, []string{"duplicate"}, requests[3])
+	})
+}
+
+func TestBatchExternalCache(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{echoVectors: true}
+	cache := &fakeExternalCache{}
+	v := New(client, 40*time.Second, logger, WithExternalCache(cache))
+
+	texts := []string{"first", "second", "third", "fourth"}
+	objects := make([]*models.Object, len(texts))
+	for i, text := range texts {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": text}}
+	}
+	// half of the inputs are unchanged since an earlier import
+	conf := v.getVectorizationConfig(cfg)
+	cache.Store(vectorCacheKey(conf, "first"), []float32{9, 9, 9, 9})
+	cache.Store(vectorCacheKey(conf, "third"), []float32{8, 8, 8, 8})
+
+	results := v.ObjectBatchResults(context.Background(), objects, make([]bool, len(objects)), cfg)
+
+	assert.Equal(t, []float32{9, 9, 9, 9}, results[0].Vector)
+	assert.Equal(t, []float32{8, 8, 8, 8}, results[2].Vector)
+	assert.Equal(t, echoVector("second"), results[1].Vector)
+	assert.Equal(t, echoVector("fourth"), results[3].Vector)
+	for i, hit := range []bool{true, false, true, false} {
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, hit, results[i].CacheHit, texts[i])
+	}
+	var sent []string
+	for _, request := range client.requests() {
+		sent = append(sent, request...)
+	}
+	assert.Equal(t, []string{"second", "fourth"}, sent)
+
+	t.Run("vectorized inputs are stored", func(t *testing.T) {
+		assert.Equal(t, echoVector("second"), cache.vectors[vectorCacheKey(conf, "second")])
+		assert.Equal(t, echoVector("fourth"), cache.vectors[vectorCacheKey(conf, "fourth")])
+
+		results := v.ObjectBatchResults(context.Background(), objects, make([]bool, len(objects)), cfg)
+		for i := range results {
+			assert.True(t, results[i].CacheHit, texts[i])
+		}
+		assert.Len(t, client.requests(), 2)
+	})
+
+	t.Run("no cache hits without a cache", func(t *testing.T) {
+		results := New(&fakeBatchClient{}, 40*time.Second, logger).
+			ObjectBatchResults(context.Background(), objects, make([]bool, len(objects)), cfg)
+		for i := range results {
+			assert.False(t, results[i].CacheHit, texts[i])
+		}
+	})
+}
+
+func TestBatchModelCacheInvalidation(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	batch := func(v *Vectorizer, texts ...string) {
+		objects := make([]*models.Object, len(texts))
+		for i := range texts {
+			objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+		}
+		_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+		require.Len(t, errs, 0)
+	}
+
+	client := &fakeBatchClient{model: "text-embedding-ada-002-v1"}
+	v := New(client, 40*time.Second, logger, WithVectorCache(10, false), WithModelCacheInvalidation())
+
+	batch(v, "first")
+	batch(v, "first")
+	require.Len(t, client.requests(), 1)
+
+	// the first response of the new model snapshot invalidates the vectors of the old snapshot
+	client.setModel("text-embedding-ada-002-v2")
+	batch(v, "second")
+	batch(v, "first", "second")
+	requests := client.requests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{"first"}, requests[2])
+
+	t.Run("vectors of the old model are not cached with the rest of their batch", func(t *testing.T) {
+		client := &fakeBatchClient{model: "text-embedding-ada-002-v1"}
+		v := New(client, 40*time.Second, logger, WithVectorCache(10, false), WithModelCacheInvalidation(),
+			WithMaxObjectsPerRequest(1))
+		batch(v, "first")
+
+		// the response of the second request of the batch reports the new model
+		client.Lock()
+		client.modelSwitches = map[string]string{"third": "text-embedding-ada-002-v2"}
+		client.Unlock()
+		batch(v, "second", "third")
+		batch(v, "second", "third")
+		requests := client.requests()
+		require.Len(t, requests, 4)
+		assert.Equal(t, []string{"second"}, requests[3])
+	})
+
+	t.Run("cache is kept by default", func(t *testing.T) {
+		client := &fakeBatchClient{model: "text-embedding-ada-002-v1"}
+		v := New(client, 40*time.Second, logger, WithVectorCache(10, false))
+
+		batch(v, "first")
+		client.setModel("text-embedding-ada-002-v2")
+		batch(v, "second")
+		batch(v, "first")
+		require.Len(t, client.requests(), 2)
+	})
+}
@@ -14,6 +14,7 @@ package vectorizer
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -26,14 +27,141 @@ import (
 )
 
 const (
-	DefaultOpenAIDocumentType    = "text"
-	DefaultOpenAIModel           = "ada"
-	DefaultVectorizeClassName    = true
-	DefaultPropertyIndexed       = true
-	DefaultVectorizePropertyName = false
-	DefaultBaseURL               = "https://api.openai.com"
+	DefaultOpenAIDocumentType     = "text"
+	DefaultOpenAIModel            = "ada"
+	DefaultVectorizeClassName     = true
+	DefaultPropertyIndexed        = true
+	DefaultVectorizePropertyName  = false
+	DefaultBaseURL                = "https://api.openai.com"
+	DefaultPropertyNameLayout     = PropertyNameLayoutInline
+	DefaultPropertyListPrecedence = PropertyListPrecedenceDeny
+	DefaultObjectArrayMode        = ObjectArrayModeJoin
+	DefaultNonTextArrayMode       = ObjectArrayModeJoin
+	DefaultNumberFormat           = NumberFormatDecimal
+	DefaultSeparatorHandling      = SeparatorHandlingKeep
+	DefaultPropertyOrder          = PropertyOrderAlphabetical
+	DefaultInputTruncation        = InputTruncationFail
+	DefaultTruncateInput          = TruncateInputNone
+	DefaultCombineStrategy        = CombineStrategyConcat
+	DefaultPoolingWeight          = PoolingWeightEqual
+	DefaultEncodingFormat         = EncodingFormatFloat
 )
 
+// the input truncation decides what happens to objects whose input has more tokens than allowed by maxInputFraction
+const (
+	InputTruncationFail     = "fail"
+	InputTruncationTruncate = "truncate"
+)
+
+// the combine strategy decides how the property values of an object are turned into its vector
+const (
+	// CombineStrategyConcat vectorizes a single input with the values of all properties
+	CombineStrategyConcat = "concat"
+	// CombineStrategyAverage vectorizes every property as a separate input and uses the normalized mean of their
+	// vectors. The tokens of all inputs of an object count towards the rate limits.
+	CombineStrategyAverage = "average"
+)
+
+// the pooling weight decides how much the vector of every section (see sectionDelimiter and combineStrategy average)
+// contributes to the mean vector of its object
+const (
+	// PoolingWeightEqual weights all sections the same, so short sections weigh as much as long ones
+	PoolingWeightEqual = "equal"
+	// PoolingWeightByTokens weights every section by its tokens, which comes closer to the vector of a single input
+	// with all sections. OpenAI only reports the tokens of whole requests, so the estimated tokens of the sections are
+	// used. The setting is matched regardless of its case, e.g. "byTokens".
+	PoolingWeightByTokens = "bytokens"
+)
+
+// truncateInput decides what happens to objects whose input has more tokens than the context window of the model
+const (
+	// TruncateInputNone fails the object with ErrTextTooLong
+	TruncateInputNone = "none"
+	// TruncateInputHead keeps the first tokens of the input that fit into the context window
+	TruncateInputHead = "head"
+	// TruncateInputTail keeps the last tokens of the input that fit into the context window
+	TruncateInputTail = "tail"
+)
+
+// the property order decides in which order the property values of an object are added to the input
+const (
+	// PropertyOrderAlphabetical sorts the properties by name, so a new property can end up between existing ones
+	PropertyOrderAlphabetical = "alphabetical"
+	// PropertyOrderSchema uses the order in which the properties are declared in the schema. Properties that are
+	// added to the class later on are appended, so the input of existing objects stays the same.
+	PropertyOrderSchema = "schema"
+)
+
+// the separator handling decides what happens to the separator of the layout in property values, which would be
+// ambiguous with the separator that the layout puts between them. That is the newline that separates the header block
+// from the values in the header layout (see PropertyNameLayoutHeader) and the space between the values otherwise.
+const (
+	SeparatorHandlingKeep = "keep"
+	// SeparatorHandlingEscape replaces the separator with the two characters "\n" for newlines or "\s" for spaces and
+	// backslashes with "\\"
+	SeparatorHandlingEscape = "escape"
+	// SeparatorHandlingNormalize replaces newlines with spaces in the header layout and spaces with underscores
+	// otherwise
+	SeparatorHandlingNormalize = "normalize"
+)
+
+// the precedence decides whether a property that is part of both the allow-list ("properties") and the deny-list
+// ("excludeProperties") is vectorized
+const (
+	PropertyListPrecedenceDeny  = "deny"
+	PropertyListPrecedenceAllow = "allow"
+)
+
+const (
+	PropertyNameLayoutInline = "inline"
+	PropertyNameLayoutHeader = "header"
+)
+
+// the object array mode decides how the texts extracted from an array of objects (see "objectArrayPaths") are added
+// to the input
+const (
+	// ObjectArrayModeJoin joins all texts of a property into a single value, e.g. "reviews good bad"
+	ObjectArrayModeJoin = "join"
+	// ObjectArrayModeSeparate adds every text as a separate value like the entries of a text[] property, e.g.
+	// "reviews good reviews bad"
+	ObjectArrayModeSeparate = "separate"
+)
+
+// the number format decides how numbers are rendered into the input with vectorizeNonText. Booleans are always
+// rendered as "true" or "false", arrays of numbers and booleans are joined into a single value or added as separate
+// values depending on nonTextArrayMode (see ObjectArrayModeJoin).
+const (
+	// NumberFormatDecimal renders numbers as their shortest decimal string, e.g. "2024" or "0.25"
+	NumberFormatDecimal = "decimal"
+	// NumberFormatInteger rounds numbers to the nearest integer, e.g. "4" for 3.6
+	NumberFormatInteger = "integer"
+)
+
+// the encoding format decides how OpenAI encodes the embeddings of its responses. Both are decoded into the same
+// float32 vectors, whatever encoding a response actually has.
+const (
+	// EncodingFormatFloat returns embeddings as JSON arrays of floats
+	EncodingFormatFloat = "float"
+	// EncodingFormatBase64 returns embeddings as base64 strings of their float32 values, which are smaller and faster
+	// to decode for large batches. Azure deployments always return floats.
+	EncodingFormatBase64 = "base64"
+)
+
+// the placeholders of the inputTemplate, which are matched regardless of their case. The template is rendered once per
+// object up to the first property placeholder, the rest of it once per property value. For example the template
+// "{className}: {propName} {propValue}" produces "car: brand bmw model z4". Without a template the input is assembled
+// as with the template "{className} {propName} {propValue}", leaving out the class name and the property names unless
+// they are vectorized with vectorizeClassName and vectorizePropertyName.
+const (
+	InputTemplateClassName = "{classname}"
+	InputTemplatePropName  = "{propname}"
+	InputTemplatePropValue = "{propvalue}"
+)
+
+// VectorizeClassNameFallback can be used instead of true or false for vectorizeClassName. The class name is then only
+// vectorized for objects without any vectorizable property values.
+const VectorizeClassNameFallback = "fallback"
+
 const (
 	TextEmbedding3Small = "text-embedding-3-small"
 	TextEmbedding3Large = "text-embedding-3-large"
@@ -52,11 +180,48 @@ var availableV3Models = []string{
 	TextEmbedding3Large,
 }
 
-var availableV3ModelsDimensions = map[string][]int64{
-	TextEmbedding3Small: {512, TextEmbedding3SmallDefaultDimensions},
-	TextEmbedding3Large: {256, 1024, TextEmbedding3LargeDefaultDimensions},
+// maxV3ModelsDimensions are the dimensions of the full vectors of the V3 models, shorter vectors can be requested
+// with the dimensions setting
+var maxV3ModelsDimensions = map[string]int64{
+	TextEmbedding3Small: TextEmbedding3SmallDefaultDimensions,
+	TextEmbedding3Large: TextEmbedding3LargeDefaultDimensions,
 }
 
+var availablePropertyNameLayouts = []string{PropertyNameLayoutInline, PropertyNameLayoutHeader}
+
+var availablePropertyListPrecedences = []string{PropertyListPrecedenceDeny, PropertyListPrecedenceAllow}
+
+var availableObjectArrayModes = []string{ObjectArrayModeJoin, ObjectArrayModeSeparate}
+
+var availableNumberFormats = []string{NumberFormatDecimal, NumberFormatInteger}
+
+var availableInputTruncations = []string{InputTruncationFail, InputTruncationTruncate}
+
+var availableTruncateInputs = []string{TruncateInputNone, TruncateInputHead, TruncateInputTail}
+
+var availableCombineStrategies = []string{CombineStrategyConcat, CombineStrategyAverage}
+
+var availablePoolingWeights = []string{PoolingWeightEqual, PoolingWeightByTokens}
+
+var availableEncodingFormats = []string{EncodingFormatFloat, EncodingFormatBase64}
+
+// context windows of the models in tokens. The v3 models and the 002 version of ada have the same context window, all
+// models of version 001 have a smaller one.
+var (
+	modelContextWindows = map[string]int{
+		TextEmbedding3Small: 8191,
+		TextEmbedding3Large: 8191,
+	}
+	modelVersionContextWindows = map[string]int{
+		"001": 2046,
+		"002": 8191,
+	}
+)
+
+var availablePropertyOrders = []string{PropertyOrderAlphabetical, PropertyOrderSchema}
+
+var availableSeparatorHandlings = []string{SeparatorHandlingKeep, SeparatorHandlingEscape, SeparatorHandlingNormalize}
+
 var availableOpenAIModels = []string{
 	"ada",     // supports 001 and 002
 	"babbage", // only supports 001
@@ -94,19 +259,354 @@ func (cs *classSettings) BaseURL() string {
 	return cs.getProperty("baseURL", DefaultBaseURL)
 }
 
+// Organization returns the OpenAI organization that the usage of the class is attributed to, "" for the default
+// organization of the API key
+func (cs *classSettings) Organization() string {
+	return cs.getRawProperty("organization", "")
+}
+
+// Project returns the OpenAI project that the usage of the class is attributed to, "" for the default project of the
+// API key
+func (cs *classSettings) Project() string {
+	return cs.getRawProperty("project", "")
+}
+
 func (cs *classSettings) DeploymentID() string {
 	return cs.getProperty("deploymentId", "")
 }
 
+// IsAzure tells if the class uses Azure OpenAI. It can be set explicitly with isAzure, e.g. for an Azure deployment
+// behind a proxy that is only reachable through baseURL, otherwise it is derived from resourceName and deploymentId.
 func (cs *classSettings) IsAzure() bool {
+	if cs.cfg != nil {
+		if isAzure, ok := cs.cfg.Class()["isAzure"].(bool); ok {
+			return isAzure
+		}
+	}
 	return cs.ResourceName() != "" && cs.DeploymentID() != ""
 }
 
+// APIVersion returns the api-version of Azure OpenAI requests, "" for the default of the client
+func (cs *classSettings) APIVersion() string {
+	return cs.getProperty("apiVersion", "")
+}
+
+// EndpointPath returns the template of the path of requests, which replaces "/v1/embeddings" and the path
+// of Azure deployments if it is set, see clients.EndpointPathDeploymentID
+func (cs *classSettings) EndpointPath() string {
+	return cs.getRawProperty("endpointPath", "")
+}
+
+func (cs *classSettings) EncodingFormat() string {
+	return cs.getProperty("encodingFormat", DefaultEncodingFormat)
+}
+
 func (cs *classSettings) Dimensions() *int64 {
 	defaultValue := PickDefaultDimensions(cs.Model())
 	return cs.getPropertyAsInt("dimensions", defaultValue)
 }
 
+func (cs *classSettings) PropertyNameLayout() string {
+	return cs.getProperty("propertyNameLayout", DefaultPropertyNameLayout)
+}
+
+// ExcludeProperties returns the deny-list of properties that are never vectorized, unless they are also part of the
+// allow-list and the precedence is flipped with propertyListPrecedence
+func (cs *classSettings) ExcludeProperties() []string {
+	return cs.getPropertyAsStringArray("excludeProperties")
+}
+
+func (cs *classSettings) PropertyListPrecedence() string {
+	return cs.getProperty("propertyListPrecedence", DefaultPropertyListPrecedence)
+}
+
+// ConflictingProperties returns all properties that are part of both the allow-list and the deny-list
+func (cs *classSettings) ConflictingProperties() []string {
+	var conflicting []string
+	for _, excluded := range cs.ExcludeProperties() {
+		for _, allowed := range cs.Properties() {
+			if excluded == allowed {
+				conflicting = append(conflicting, excluded)
+				break
+			}
+		}
+	}
+	return conflicting
+}
+
+// ObjectArrayPaths returns the paths of the fields that are extracted from properties that are arrays of objects,
+// grouped by property. Paths have the form "reviews[].text" or "reviews[].author.name" for nested objects.
+func (cs *classSettings) ObjectArrayPaths() map[string][][]string {
+	paths := cs.getPropertyAsStringArray("objectArrayPaths")
+	if len(paths) == 0 {
+		return nil
+	}
+
+	byProperty := make(map[string][][]string, len(paths))
+	for _, path := range paths {
+		propName, fieldPath, ok := parseObjectArrayPath(path)
+		if ok {
+			byProperty[propName] = append(byProperty[propName], fieldPath)
+		}
+	}
+	return byProperty
+}
+
+func (cs *classSettings) ObjectArrayMode() string {
+	return cs.getProperty("objectArrayMode", DefaultObjectArrayMode)
+}
+
+func parseObjectArrayPath(path string) (string, []string, bool) {
+	propName, fieldPath, ok := strings.Cut(path, "[].")
+	if !ok || propName == "" {
+		return "", nil, false
+	}
+	fields := strings.Split(fieldPath, ".")
+	for _, field := range fields {
+		if field == "" {
+			return "", nil, false
+		}
+	}
+	return propName, fields, true
+}
+
+func (cs *classSettings) VectorizeClassName() bool {
+	if template := cs.InputTemplate(); template != "" {
+		return strings.Contains(template, InputTemplateClassName)
+	}
+	if cs.ClassNameFallback() {
+		return false
+	}
+	return cs.BaseClassSettings.VectorizeClassName()
+}
+
+// VectorizePropertyName returns whether the name of the property is part of the input. With an inputTemplate this
+// only depends on the template, see InputTemplatePropName.
+func (cs *classSettings) VectorizePropertyName(propName string) bool {
+	if template := cs.InputTemplate(); template != "" {
+		return strings.Contains(template, InputTemplatePropName)
+	}
+	return cs.BaseClassSettings.VectorizePropertyName(propName)
+}
+
+// InputTemplate returns the lowercased template of the input, "" if the input is assembled according to
+// vectorizeClassName and vectorizePropertyName (see InputTemplateClassName)
+func (cs *classSettings) InputTemplate() string {
+	return cs.getProperty("inputTemplate", "")
+}
+
+// ClassNameFallback returns whether the class name is only vectorized for objects without any vectorizable property
+// values, see VectorizeClassNameFallback
+func (cs *classSettings) ClassNameFallback() bool {
+	return cs.getProperty("vectorizeClassName", "") == VectorizeClassNameFallback
+}
+
+func (cs *classSettings) PropertyOrder() string {
+	return cs.getProperty("propertyOrder", DefaultPropertyOrder)
+}
+
+// SchemaPropertyNames returns the names of the properties of the class in schema order, nil if the class config
+// doesn't provide them
+func (cs *classSettings) SchemaPropertyNames() []string {
+	if names, ok := cs.cfg.(interface{ PropertyNames() []string }); ok {
+		return names.PropertyNames()
+	}
+	return nil
+}
+
+// SectionDelimiter returns the marker at which the assembled input is split into sections that are vectorized
+// separately, "" if the input is not split. Like the input the delimiter is lowercased.
+func (cs *classSettings) SectionDelimiter() string {
+	return cs.getProperty("sectionDelimiter", "")
+}
+
+func (cs *classSettings) SeparatorHandling() string {
+	return cs.getProperty("separatorHandling", DefaultSeparatorHandling)
+}
+
+// ContextWindow returns the maximum number of tokens of a single input of the model, 0 if it is not known
+func (cs *classSettings) ContextWindow() int {
+	if contextWindow, ok := modelContextWindows[cs.Model()]; ok {
+		return contextWindow
+	}
+	return modelVersionContextWindows[cs.ModelVersion()]
+}
+
+// InputTokenCap returns the maximum number of tokens of the input of a single object, which is configured with
+// maxInputFraction as a fraction of the context window of the model. 0 means there is no cap.
+func (cs *classSettings) InputTokenCap() int {
+	fraction := cs.getPropertyAsFloat("maxInputFraction", 0)
+	if fraction <= 0 {
+		return 0
+	}
+	return int(fraction * float64(cs.ContextWindow()))
+}
+
+func (cs *classSettings) InputTruncation() string {
+	return cs.getProperty("inputTruncation", DefaultInputTruncation)
+}
+
+// VectorizeEmptyObjects returns whether objects without any text to vectorize fail with ErrEmptyInput instead of
+// being skipped
+func (cs *classSettings) VectorizeEmptyObjects() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["vectorizeEmptyObjects"].(bool)
+	return value
+}
+
+// DedupeInputs returns whether objects of a batch with the same input are vectorized only once
+func (cs *classSettings) DedupeInputs() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["dedupeInputs"].(bool)
+	return value
+}
+
+// CompressRequests returns whether the bodies of requests to OpenAI are gzip-encoded, which is off by default as not
+// every proxy supports it
+func (cs *classSettings) CompressRequests() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["compressRequests"].(bool)
+	return value
+}
+
+// VectorizeNonText returns whether numbers, booleans and arrays of them are part of the input. They are left out by
+// default, see NumberFormatDecimal.
+func (cs *classSettings) VectorizeNonText() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["vectorizeNonText"].(bool)
+	return value
+}
+
+// StrictAssembly returns whether objects fail if one of their properties cannot be rendered into the input, see
+// ErrUnrenderableProperty. By default these properties are left out.
+func (cs *classSettings) StrictAssembly() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["strictAssembly"].(bool)
+	return value
+}
+
+func (cs *classSettings) NumberFormat() string {
+	return cs.getProperty("numberFormat", DefaultNumberFormat)
+}
+
+func (cs *classSettings) NonTextArrayMode() string {
+	return cs.getProperty("nonTextArrayMode", DefaultNonTextArrayMode)
+}
+
+// NormalizeInput returns whether property values are normalized before they are assembled into the input, see
+// normalizeText. It is off by default as it changes the vectors of existing inputs.
+func (cs *classSettings) NormalizeInput() bool {
+	if cs.cfg == nil {
+		return false
+	}
+	value, _ := cs.cfg.Class()["normalizeInput"].(bool)
+	return value
+}
+
+func (cs *classSettings) CombineStrategy() string {
+	return cs.getProperty("combineStrategy", DefaultCombineStrategy)
+}
+
+func (cs *classSettings) PoolingWeight() string {
+	return cs.getProperty("poolingWeight", DefaultPoolingWeight)
+}
+
+func (cs *classSettings) TruncateInput() string {
+	return cs.getProperty("truncateInput", DefaultTruncateInput)
+}
+
+// MinPropertyTokens returns the minimum number of tokens a property needs to have to be vectorized, 0 if all
+// properties are vectorized regardless of their length
+func (cs *classSettings) MinPropertyTokens() int {
+	if minTokens := cs.getPropertyAsInt("minPropertyTokens", nil); minTokens != nil {
+		return int(*minTokens)
+	}
+	return 0
+}
+
+// PropertyWeights returns how often the values of a property are repeated in the input, configured with
+// propertyWeights. Properties without a weight have a weight of 1.
+func (cs *classSettings) PropertyWeights() map[string]int {
+	if cs.cfg == nil {
+		// we would receive a nil-config on cross-class requests, such as Explore{}
+		return nil
+	}
+
+	value, ok := cs.cfg.Class()["propertyWeights"].(map[string]interface{})
+	if !ok || len(value) == 0 {
+		return nil
+	}
+	weights := make(map[string]int, len(value))
+	for propName, weight := range value {
+		if asInt, ok := positiveInt(weight); ok {
+			weights[propName] = asInt
+		}
+	}
+	return weights
+}
+
+// PropertyModels returns the models that vectorize single properties into named vectors, keyed by the property name
+// and configured with propertyModels. Model names are lowercased like the model setting.
+func (cs *classSettings) PropertyModels() map[string]string {
+	if cs.cfg == nil {
+		// we would receive a nil-config on cross-class requests, such as Explore{}
+		return nil
+	}
+
+	value, ok := cs.cfg.Class()["propertyModels"].(map[string]interface{})
+	if !ok || len(value) == 0 {
+		return nil
+	}
+	propertyModels := make(map[string]string, len(value))
+	for propName, model := range value {
+		if asString, ok := model.(string); ok && asString != "" {
+			propertyModels[propName] = strings.ToLower(asString)
+		}
+	}
+	return propertyModels
+}
+
+// FallbackModels returns the models that are tried in order if the model of the class is not available, configured
+// with fallbackModels. Model names are lowercased like the model setting.
+func (cs *classSettings) FallbackModels() []string {
+	var fallbackModels []string
+	for _, model := range cs.getPropertyAsStringArray("fallbackModels") {
+		fallbackModels = append(fallbackModels, strings.ToLower(model))
+	}
+	return fallbackModels
+}
+
+func (cs *classSettings) PropertyIndexed(propName string) bool {
+	if routed, ok := cs.cfg.(propertyModelConfig); ok && !routed.routes(propName) {
+		return false
+	}
+	for _, excluded := range cs.ExcludeProperties() {
+		if excluded != propName {
+			continue
+		}
+		if cs.PropertyListPrecedence() == PropertyListPrecedenceAllow {
+			// only an explicit allow-list entry can win over the deny-list
+			for _, allowed := range cs.Properties() {
+				if allowed == propName {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return cs.BaseClassSettings.PropertyIndexed(propName)
+}
+
 func (cs *classSettings) Validate(class *models.Class) error {
 	if cs.cfg == nil {
 		// we would receive a nil-config on cross-class requests, such as Explore{}
@@ -128,23 +628,174 @@ func (cs *classSettings) Validate(class *models.Class) error {
 		return errors.Errorf("wrong OpenAI model name, available model names are: %v", availableModels)
 	}
 
-	dimensions := cs.Dimensions()
-	if dimensions != nil {
-		if !validateOpenAISetting[string](model, availableV3Models) {
-			return errors.Errorf("dimensions setting can only be used with V3 embedding models: %v", availableV3Models)
+	if err := cs.validateDimensions(); err != nil {
+		return err
+	}
+
+	if !validateOpenAISetting[string](cs.PropertyNameLayout(), availablePropertyNameLayouts) {
+		return errors.Errorf("wrong propertyNameLayout, available layouts are: %v", availablePropertyNameLayouts)
+	}
+
+	if value, ok := cs.cfg.Class()["inputTemplate"]; ok {
+		if _, isString := value.(string); !isString {
+			return errors.Errorf("inputTemplate needs to be a string, got: %T", value)
+		}
+		if template := cs.InputTemplate(); strings.Count(template, InputTemplatePropValue) != 1 ||
+			strings.Count(template, InputTemplatePropName) > 1 {
+			return errors.New("inputTemplate needs to contain {propValue} exactly once and {propName} at most once")
+		}
+		if cs.PropertyNameLayout() == PropertyNameLayoutHeader {
+			return errors.New("inputTemplate can't be combined with propertyNameLayout header")
+		}
+	}
+
+	if value, ok := cs.cfg.Class()["endpointPath"]; ok {
+		if _, isString := value.(string); !isString {
+			return errors.Errorf("endpointPath needs to be a string, got: %T", value)
+		}
+		if path := cs.EndpointPath(); strings.Contains(path, "://") || strings.Contains(path, "?") {
+			return errors.New("endpointPath needs to be a path without host and query, the host is set with baseURL")
+		}
+	}
+
+	if err := cs.validateStringArray("excludeProperties"); err != nil {
+		return err
+	}
+
+	if !validateOpenAISetting[string](cs.PropertyListPrecedence(), availablePropertyListPrecedences) {
+		return errors.Errorf("wrong propertyListPrecedence, available precedences are: %v", availablePropertyListPrecedences)
+	}
+
+	if err := cs.validateStringArray("objectArrayPaths"); err != nil {
+		return err
+	}
+	for _, path := range cs.getPropertyAsStringArray("objectArrayPaths") {
+		if _, _, ok := parseObjectArrayPath(path); !ok {
+			return errors.Errorf("wrong objectArrayPaths value: %s, paths need to have the form property[].field", path)
+		}
+	}
+
+	if !validateOpenAISetting[string](cs.ObjectArrayMode(), availableObjectArrayModes) {
+		return errors.Errorf("wrong objectArrayMode, available modes are: %v", availableObjectArrayModes)
+	}
+	if !validateOpenAISetting[string](cs.NonTextArrayMode(), availableObjectArrayModes) {
+		return errors.Errorf("wrong nonTextArrayMode, available modes are: %v", availableObjectArrayModes)
+	}
+	if !validateOpenAISetting[string](cs.NumberFormat(), availableNumberFormats) {
+		return errors.Errorf("wrong numberFormat, available formats are: %v", availableNumberFormats)
+	}
+
+	if !validateOpenAISetting[string](cs.EncodingFormat(), availableEncodingFormats) {
+		return errors.Errorf("wrong encodingFormat, available formats are: %v", availableEncodingFormats)
+	}
+
+	if value, ok := cs.cfg.Class()["vectorizeClassName"]; ok {
+		if _, isBool := value.(bool); !isBool && !cs.ClassNameFallback() {
+			return errors.Errorf("vectorizeClassName needs to be true, false or %q", VectorizeClassNameFallback)
+		}
+	}
+
+	if !validateOpenAISetting[string](cs.PropertyOrder(), availablePropertyOrders) {
+		return errors.Errorf("wrong propertyOrder, available orders are: %v", availablePropertyOrders)
+	}
+
+	if !validateOpenAISetting[string](cs.SeparatorHandling(), availableSeparatorHandlings) {
+		return errors.Errorf("wrong separatorHandling, available options are: %v", availableSeparatorHandlings)
+	}
+
+	if value, ok := cs.cfg.Class()["sectionDelimiter"]; ok {
+		if asString, isString := value.(string); !isString || asString == "" {
+			return errors.New("sectionDelimiter needs to be a non-empty string")
+		}
+	}
+
+	if !validateOpenAISetting[string](cs.CombineStrategy(), availableCombineStrategies) {
+		return errors.Errorf("wrong combineStrategy, available options are: %v", availableCombineStrategies)
+	}
+	if cs.CombineStrategy() == CombineStrategyAverage && cs.SectionDelimiter() != "" {
+		return errors.New("sectionDelimiter can't be combined with combineStrategy average")
+	}
+	if !validateOpenAISetting[string](cs.PoolingWeight(), availablePoolingWeights) {
+		return errors.Errorf("wrong poolingWeight, available options are: %v", availablePoolingWeights)
+	}
+
+	if fraction := cs.getPropertyAsFloat("maxInputFraction", 0); fraction < 0 || fraction > 1 {
+		return errors.New("maxInputFraction needs to be between 0 and 1")
+	}
+
+	if !validateOpenAISetting[string](cs.InputTruncation(), availableInputTruncations) {
+		return errors.Errorf("wrong inputTruncation, available options are: %v", availableInputTruncations)
+	}
+
+	for _, name := range []string{
+		"vectorizeEmptyObjects", "dedupeInputs", "compressRequests", "normalizeInput", "vectorizeNonText",
+		"strictAssembly",
+	} {
+		if value, ok := cs.cfg.Class()[name]; ok {
+			if _, isBool := value.(bool); !isBool {
+				return errors.Errorf("%s needs to be a boolean, got: %T", name, value)
+			}
+		}
+	}
+	if cs.NormalizeInput() && cs.SectionDelimiter() != "" && strings.TrimSpace(cs.SectionDelimiter()) == "" {
+		return errors.New("normalizeInput can't be combined with a sectionDelimiter that only consists of whitespace")
+	}
+
+	if !validateOpenAISetting[string](cs.TruncateInput(), availableTruncateInputs) {
+		return errors.Errorf("wrong truncateInput, available options are: %v", availableTruncateInputs)
+	}
+
+	if value, ok := cs.cfg.Class()["propertyWeights"]; ok {
+		weights, isMap := value.(map[string]interface{})
+		if !isMap {
+			return errors.Errorf("propertyWeights field needs to be of object type, got: %T", value)
+		}
+		for propName, weight := range weights {
+			if _, ok := positiveInt(weight); !ok {
+				return errors.Errorf("propertyWeights value of %s needs to be a positive whole number, got: %v", propName, weight)
+			}
+		}
+	}
+
+	if value, ok := cs.cfg.Class()["propertyModels"]; ok {
+		propertyModels, isMap := value.(map[string]interface{})
+		if !isMap {
+			return errors.Errorf("propertyModels field needs to be of object type, got: %T", value)
 		}
-		availableDimensions := availableV3ModelsDimensions[model]
-		if !validateOpenAISetting[int64](*dimensions, availableDimensions) {
-			return errors.Errorf("wrong dimensions setting for %s model, available dimensions are: %v", model, availableDimensions)
+		for propName, model := range propertyModels {
+			if asString, ok := model.(string); !ok || asString == "" {
+				return errors.Errorf("propertyModels value of %s needs to be a model name, got: %v", propName, model)
+			}
+		}
+	}
+
+	if err := cs.validateStringArray("fallbackModels"); err != nil {
+		return err
+	}
+	for _, fallbackModel := range cs.FallbackModels() {
+		if !validateOpenAISetting[string](fallbackModel, availableModels) {
+			return errors.Errorf("wrong fallbackModels model name %s, available model names are: %v", fallbackModel, availableModels)
 		}
 	}
+	if len(cs.FallbackModels()) > 0 && cs.IsAzure() {
+		return errors.New("fallbackModels can't be used with Azure, the deployment decides the model")
+	}
+
+	if cs.MinPropertyTokens() < 0 {
+		return errors.New("minPropertyTokens needs to be a non-negative number")
+	}
 
 	version := cs.ModelVersion()
 	if err := cs.validateModelVersion(version, model, docType); err != nil {
 		return err
 	}
 
-	err := cs.validateAzureConfig(cs.ResourceName(), cs.DeploymentID())
+	var err error
+	if _, ok := cs.cfg.Class()["isAzure"]; ok {
+		err = cs.validateIsAzure()
+	} else {
+		err = cs.validateAzureConfig(cs.ResourceName(), cs.DeploymentID())
+	}
 	if err != nil {
 		return err
 	}
@@ -210,6 +861,18 @@ func (cs *classSettings) getProperty(name, defaultValue string) string {
 	return defaultValue
 }
 
+// getRawProperty is getProperty without lowercasing the value, for case-sensitive settings such as OpenAI IDs and
+// paths
+func (cs *classSettings) getRawProperty(name, defaultValue string) string {
+	if cs.cfg == nil {
+		return defaultValue
+	}
+	if asString, ok := cs.cfg.Class()[name].(string); ok {
+		return asString
+	}
+	return defaultValue
+}
+
 func (cs *classSettings) getPropertyAsInt(name string, defaultValue *int64) *int64 {
 	if cs.cfg == nil {
 		// we would receive a nil-config on cross-class requests, such as Explore{}
@@ -238,8 +901,101 @@ func (cs *classSettings) getPropertyAsInt(name string, defaultValue *int64) *int
 	return defaultValue
 }
 
+func (cs *classSettings) getPropertyAsFloat(name string, defaultValue float64) float64 {
+	if cs.cfg == nil {
+		// we would receive a nil-config on cross-class requests, such as Explore{}
+		return defaultValue
+	}
+
+	switch value := cs.cfg.Class()[name].(type) {
+	case json.Number:
+		if asFloat, err := value.Float64(); err == nil {
+			return asFloat
+		}
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	case int:
+		return float64(value)
+	case string:
+		if asFloat, err := strconv.ParseFloat(value, 64); err == nil {
+			return asFloat
+		}
+	}
+	return defaultValue
+}
+
+// positiveInt converts numbers of the class config that are positive whole numbers to int
+func positiveInt(value interface{}) (int, bool) {
+	var asFloat float64
+	switch value := value.(type) {
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return 0, false
+		}
+		asFloat = f
+	case float64:
+		asFloat = value
+	case int:
+		asFloat = float64(value)
+	case int64:
+		asFloat = float64(value)
+	default:
+		return 0, false
+	}
+	if asFloat < 1 || asFloat != math.Trunc(asFloat) || asFloat > math.MaxInt32 {
+		return 0, false
+	}
+	return int(asFloat), true
+}
+
+func (cs *classSettings) getPropertyAsStringArray(name string) []string {
+	if cs.cfg == nil {
+		// we would receive a nil-config on cross-class requests, such as Explore{}
+		return nil
+	}
+
+	switch value := cs.cfg.Class()[name].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		asStringArray := make([]string, 0, len(value))
+		for i := range value {
+			if asString, ok := value[i].(string); ok {
+				asStringArray = append(asStringArray, asString)
+			}
+		}
+		return asStringArray
+	default:
+		return nil
+	}
+}
+
+func (cs *classSettings) validateStringArray(name string) error {
+	value, ok := cs.cfg.Class()[name]
+	if !ok {
+		return nil
+	}
+
+	switch value := value.(type) {
+	case []string:
+		return nil
+	case []interface{}:
+		for i := range value {
+			if _, ok := value[i].(string); !ok {
+				return errors.Errorf("%s field value: %v must be a string", name, value[i])
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("%s field needs to be of array type, got: %T", name, value)
+	}
+}
+
 func (cs *classSettings) validateIndexState(class *models.Class, settings ClassSettings) error {
-	if settings.VectorizeClassName() {
+	if settings.VectorizeClassName() || settings.ClassNameFallback() {
 		// if the user chooses to vectorize the classname, vector-building will
 		// always be possible, no need to investigate further
 
@@ -254,7 +1010,8 @@ func (cs *classSettings) validateIndexState(class *models.Class, settings ClassS
 				"got %v", prop.Name, prop.DataType)
 		}
 
-		if prop.DataType[0] != string(schema.DataTypeText) {
+		_, hasObjectArrayPath := settings.ObjectArrayPaths()[prop.Name]
+		if prop.DataType[0] != string(schema.DataTypeText) && !hasObjectArrayPath {
 			// we can only vectorize text-like props
 			continue
 		}
@@ -281,6 +1038,42 @@ func (cs *classSettings) validateAzureConfig(resourceName string, deploymentId s
 	return nil
 }
 
+// validateIsAzure validates an explicit isAzure, which replaces the check that resourceName and deploymentId are
+// set together
+func (cs *classSettings) validateIsAzure() error {
+	value := cs.cfg.Class()["isAzure"]
+	isAzure, ok := value.(bool)
+	if !ok {
+		return fmt.Errorf("isAzure needs to be a boolean, got: %T", value)
+	}
+	if isAzure && cs.DeploymentID() == "" {
+		return errors.New("isAzure needs a deploymentId")
+	}
+	if isAzure && cs.ResourceName() == "" && cs.BaseURL() == DefaultBaseURL {
+		return errors.New("isAzure needs either a resourceName or a baseURL")
+	}
+	return nil
+}
+
+// validateDimensions checks that the dimensions setting is only used with the V3 models and doesn't exceed the
+// dimensions of their full vectors. The batch checks it too, so invalid settings never reach OpenAI.
+func (cs *classSettings) validateDimensions() error {
+	dimensions := cs.Dimensions()
+	if dimensions == nil {
+		return nil
+	}
+	model := cs.Model()
+	maxDimensions, ok := maxV3ModelsDimensions[model]
+	if !ok {
+		return errors.Errorf("dimensions setting can only be used with V3 embedding models: %v", availableV3Models)
+	}
+	if *dimensions < 1 || *dimensions > maxDimensions {
+		return errors.Errorf("wrong dimensions setting for %s model, dimensions need to be between 1 and %d, got: %d",
+			model, maxDimensions, *dimensions)
+	}
+	return nil
+}
+
 func validateOpenAISetting[T string | int64](value T, availableValues []T) bool {
 	for i := range availableValues {
 		if value == availableValues[i] {
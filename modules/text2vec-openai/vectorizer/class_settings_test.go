@@ -12,6 +12,7 @@
 package vectorizer
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -54,15 +55,34 @@ func Test_classSettings_Validate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "text-embedding-3-small, 100 dimensions",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"model":      "text-embedding-3-small",
+					"dimensions": 100,
+				},
+			},
+		},
 		{
 			name: "text-embedding-3-small, wrong dimensions",
 			cfg: &fakeClassConfig{
 				classConfig: map[string]interface{}{
 					"model":      "text-embedding-3-small",
-					"dimensions": 1,
+					"dimensions": 0,
 				},
 			},
-			wantErr: errors.New("wrong dimensions setting for text-embedding-3-small model, available dimensions are: [512 1536]"),
+			wantErr: errors.New("wrong dimensions setting for text-embedding-3-small model, dimensions need to be between 1 and 1536, got: 0"),
+		},
+		{
+			name: "text-embedding-3-small, too many dimensions",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"model":      "text-embedding-3-small",
+					"dimensions": 2048,
+				},
+			},
+			wantErr: errors.New("wrong dimensions setting for text-embedding-3-small model, dimensions need to be between 1 and 1536, got: 2048"),
 		},
 		{
 			name: "text-embedding-3-large",
@@ -73,7 +93,7 @@ func Test_classSettings_Validate(t *testing.T) {
 			},
 		},
 		{
-			name: "text-embedding-3-large, 512 dimensions",
+			name: "text-embedding-3-large, 1024 dimensions",
 			cfg: &fakeClassConfig{
 				classConfig: map[string]interface{}{
 					"model":      "text-embedding-3-large",
@@ -86,10 +106,10 @@ func Test_classSettings_Validate(t *testing.T) {
 			cfg: &fakeClassConfig{
 				classConfig: map[string]interface{}{
 					"model":      "text-embedding-3-large",
-					"dimensions": 512,
+					"dimensions": 4096,
 				},
 			},
-			wantErr: errors.New("wrong dimensions setting for text-embedding-3-large model, available dimensions are: [256 1024 3072]"),
+			wantErr: errors.New("wrong dimensions setting for text-embedding-3-large model, dimensions need to be between 1 and 3072, got: 4096"),
 		},
 		{
 			name: "text-embedding-ada-002",
@@ -139,6 +159,460 @@ func Test_classSettings_Validate(t *testing.T) {
 			},
 			wantErr: errors.New("properties field needs to be of array type, got: string"),
 		},
+		{
+			name: "header property name layout",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyNameLayout": "header",
+				},
+			},
+		},
+		{
+			name: "input template",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"inputTemplate": "{className}: {propName} {propValue}",
+				},
+			},
+		},
+		{
+			name: "input template without a value",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"inputTemplate": "{className}: {propName}",
+				},
+			},
+			wantErr: errors.New("inputTemplate needs to contain {propValue} exactly once and {propName} at most once"),
+		},
+		{
+			name: "input template with the header layout",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"inputTemplate":      "{propValue}",
+					"propertyNameLayout": "header",
+				},
+			},
+			wantErr: errors.New("inputTemplate can't be combined with propertyNameLayout header"),
+		},
+		{
+			name: "endpoint path",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"endpointPath": "/openai/deployments/{deploymentId}/embeddings",
+				},
+			},
+		},
+		{
+			name: "endpoint path with a host",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"endpointPath": "https://example.com/embeddings",
+				},
+			},
+			wantErr: errors.New("endpointPath needs to be a path without host and query, the host is set with baseURL"),
+		},
+		{
+			name: "wrong property name layout",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyNameLayout": "footer",
+				},
+			},
+			wantErr: errors.New("wrong propertyNameLayout, available layouts are: [inline header]"),
+		},
+		{
+			name: "wrong exclude properties",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"excludeProperties": "test",
+				},
+			},
+			wantErr: errors.New("excludeProperties field needs to be of array type, got: string"),
+		},
+		{
+			name: "wrong property list precedence",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"excludeProperties":      []interface{}{"test"},
+					"propertyListPrecedence": "both",
+				},
+			},
+			wantErr: errors.New("wrong propertyListPrecedence, available precedences are: [deny allow]"),
+		},
+		{
+			name: "object array paths",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"objectArrayPaths": []interface{}{"reviews[].text", "reviews[].author.name"},
+					"objectArrayMode":  "separate",
+				},
+			},
+		},
+		{
+			name: "wrong object array path",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"objectArrayPaths": []interface{}{"reviews.text"},
+				},
+			},
+			wantErr: errors.New("wrong objectArrayPaths value: reviews.text, paths need to have the form property[].field"),
+		},
+		{
+			name: "wrong object array mode",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"objectArrayMode": "sum",
+				},
+			},
+			wantErr: errors.New("wrong objectArrayMode, available modes are: [join separate]"),
+		},
+		{
+			name: "wrong min property tokens",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"minPropertyTokens": -1,
+				},
+			},
+			wantErr: errors.New("minPropertyTokens needs to be a non-negative number"),
+		},
+		{
+			name: "wrong separator handling",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"separatorHandling": "drop",
+				},
+			},
+			wantErr: errors.New("wrong separatorHandling, available options are: [keep escape normalize]"),
+		},
+		{
+			name: "property weights",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyWeights": map[string]interface{}{"title": json.Number("3"), "body": 1},
+				},
+			},
+		},
+		{
+			name: "wrong property weights",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyWeights": []interface{}{"title"},
+				},
+			},
+			wantErr: errors.New("propertyWeights field needs to be of object type, got: []interface {}"),
+		},
+		{
+			name: "wrong property weight",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyWeights": map[string]interface{}{"title": 1.5},
+				},
+			},
+			wantErr: errors.New("propertyWeights value of title needs to be a positive whole number, got: 1.5"),
+		},
+		{
+			name: "wrong max input fraction",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"maxInputFraction": 1.5,
+				},
+			},
+			wantErr: errors.New("maxInputFraction needs to be between 0 and 1"),
+		},
+		{
+			name: "wrong input truncation",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"maxInputFraction": 0.5,
+					"inputTruncation":  "drop",
+				},
+			},
+			wantErr: errors.New("wrong inputTruncation, available options are: [fail truncate]"),
+		},
+		{
+			name: "wrong combine strategy",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"combineStrategy": "sum",
+				},
+			},
+			wantErr: errors.New("wrong combineStrategy, available options are: [concat average]"),
+		},
+		{
+			name: "average with section delimiter",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"combineStrategy":  "average",
+					"sectionDelimiter": "<section>",
+				},
+			},
+			wantErr: errors.New("sectionDelimiter can't be combined with combineStrategy average"),
+		},
+		{
+			name: "non text properties",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"vectorizeNonText": true,
+					"numberFormat":     "integer",
+					"nonTextArrayMode": "separate",
+				},
+			},
+		},
+		{
+			name: "wrong number format",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"numberFormat": "hex",
+				},
+			},
+			wantErr: errors.New("wrong numberFormat, available formats are: [decimal integer]"),
+		},
+		{
+			name: "wrong vectorize non text",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"vectorizeNonText": "yes",
+				},
+			},
+			wantErr: errors.New("vectorizeNonText needs to be a boolean, got: string"),
+		},
+		{
+			name: "base64 encoding format",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"encodingFormat": "base64",
+				},
+			},
+		},
+		{
+			name: "wrong encoding format",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"encodingFormat": "binary",
+				},
+			},
+			wantErr: errors.New("wrong encodingFormat, available formats are: [float base64]"),
+		},
+		{
+			name: "strict assembly",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"strictAssembly": true,
+				},
+			},
+		},
+		{
+			name: "wrong strict assembly",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"strictAssembly": 1,
+				},
+			},
+			wantErr: errors.New("strictAssembly needs to be a boolean, got: int"),
+		},
+		{
+			name: "pooling weight by tokens",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"combineStrategy": "average",
+					"poolingWeight":   "byTokens",
+				},
+			},
+		},
+		{
+			name: "wrong pooling weight",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"poolingWeight": "byLength",
+				},
+			},
+			wantErr: errors.New("wrong poolingWeight, available options are: [equal bytokens]"),
+		},
+		{
+			name: "wrong vectorize empty objects",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"vectorizeEmptyObjects": "yes",
+				},
+			},
+			wantErr: errors.New("vectorizeEmptyObjects needs to be a boolean, got: string"),
+		},
+		{
+			name: "wrong compressRequests",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"compressRequests": 1,
+				},
+			},
+			wantErr: errors.New("compressRequests needs to be a boolean, got: int"),
+		},
+		{
+			name: "wrong normalizeInput",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"normalizeInput": "true",
+				},
+			},
+			wantErr: errors.New("normalizeInput needs to be a boolean, got: string"),
+		},
+		{
+			name: "normalizeInput with a whitespace sectionDelimiter",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"normalizeInput":   true,
+					"sectionDelimiter": "\n\n",
+				},
+			},
+			wantErr: errors.New("normalizeInput can't be combined with a sectionDelimiter that only consists of whitespace"),
+		},
+		{
+			name: "wrong truncate input",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"truncateInput": "middle",
+				},
+			},
+			wantErr: errors.New("wrong truncateInput, available options are: [none head tail]"),
+		},
+		{
+			name: "wrong property order",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyOrder": "random",
+				},
+			},
+			wantErr: errors.New("wrong propertyOrder, available orders are: [alphabetical schema]"),
+		},
+		{
+			name: "wrong section delimiter",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"sectionDelimiter": "",
+				},
+			},
+			wantErr: errors.New("sectionDelimiter needs to be a non-empty string"),
+		},
+		{
+			name: "class name fallback",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"vectorizeClassName": "fallback",
+				},
+			},
+		},
+		{
+			name: "wrong vectorize class name",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"vectorizeClassName": "sometimes",
+				},
+			},
+			wantErr: errors.New("vectorizeClassName needs to be true, false or \"fallback\""),
+		},
+		{
+			name: "Azure behind a proxy",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"isAzure":      true,
+					"baseURL":      "https://proxy.example.com",
+					"deploymentId": "embeddings",
+					"apiVersion":   "2024-02-01",
+				},
+			},
+		},
+		{
+			name: "property models",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyModels": map[string]interface{}{"code": "text-embedding-3-large"},
+				},
+			},
+		},
+		{
+			name: "wrong property models",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyModels": []interface{}{"code"},
+				},
+			},
+			wantErr: errors.New("propertyModels field needs to be of object type, got: []interface {}"),
+		},
+		{
+			name: "property model without a name",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"propertyModels": map[string]interface{}{"code": 1},
+				},
+			},
+			wantErr: errors.New("propertyModels value of code needs to be a model name, got: 1"),
+		},
+		{
+			name: "fallback models",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"fallbackModels": []interface{}{"text-embedding-3-small", "Babbage"},
+				},
+			},
+		},
+		{
+			name: "wrong fallback model",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"fallbackModels": []interface{}{"text-embedding-4"},
+				},
+			},
+			wantErr: errors.New("wrong fallbackModels model name text-embedding-4, available model names are: " +
+				"[ada babbage curie davinci text-embedding-3-small text-embedding-3-large]"),
+		},
+		{
+			name: "fallback models with Azure",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"resourceName":   "resource",
+					"deploymentId":   "embeddings",
+					"fallbackModels": []interface{}{"babbage"},
+				},
+			},
+			wantErr: errors.New("fallbackModels can't be used with Azure, the deployment decides the model"),
+		},
+		{
+			name: "wrong dedupeInputs",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"dedupeInputs": "true",
+				},
+			},
+			wantErr: errors.New("dedupeInputs needs to be a boolean, got: string"),
+		},
+		{
+			name: "wrong isAzure",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"isAzure": "yes",
+				},
+			},
+			wantErr: errors.New("isAzure needs to be a boolean, got: string"),
+		},
+		{
+			name: "isAzure without a deployment",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"isAzure": true,
+					"baseURL": "https://proxy.example.com",
+				},
+			},
+			wantErr: errors.New("isAzure needs a deploymentId"),
+		},
+		{
+			name: "isAzure without a resource name or base URL",
+			cfg: &fakeClassConfig{
+				classConfig: map[string]interface{}{
+					"isAzure":      true,
+					"deploymentId": "embeddings",
+				},
+			},
+			wantErr: errors.New("isAzure needs either a resourceName or a baseURL"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -195,4 +669,50 @@ func Test_classSettings(t *testing.T) {
 		assert.False(t, ic.VectorizePropertyName("otherProp"))
 		assert.False(t, ic.VectorizeClassName())
 	})
+
+	t.Run("input token cap as a fraction of the context window", func(t *testing.T) {
+		tests := []struct {
+			classConfig   map[string]interface{}
+			contextWindow int
+			inputTokenCap int
+		}{
+			{classConfig: map[string]interface{}{}, contextWindow: 8191, inputTokenCap: 0},
+			{classConfig: map[string]interface{}{"maxInputFraction": 0.5}, contextWindow: 8191, inputTokenCap: 4095},
+			{classConfig: map[string]interface{}{"maxInputFraction": json.Number("0.25"), "model": "text-embedding-3-large"}, contextWindow: 8191, inputTokenCap: 2047},
+			{classConfig: map[string]interface{}{"maxInputFraction": 0.5, "model": "babbage"}, contextWindow: 2046, inputTokenCap: 1023},
+			{classConfig: map[string]interface{}{"maxInputFraction": 1, "model": "ada", "modelVersion": "001"}, contextWindow: 2046, inputTokenCap: 2046},
+		}
+		for _, tt := range tests {
+			ic := NewClassSettings(&fakeClassConfig{classConfig: tt.classConfig})
+			assert.Equal(t, tt.contextWindow, ic.ContextWindow())
+			assert.Equal(t, tt.inputTokenCap, ic.InputTokenCap())
+		}
+	})
+
+	t.Run("case-sensitive settings", func(t *testing.T) {
+		ic := NewClassSettings(&fakeClassConfig{classConfig: map[string]interface{}{
+			"endpointPath": "/OpenAI/Deployments/{deploymentId}/Embeddings",
+		}})
+		assert.Equal(t, "/OpenAI/Deployments/{deploymentId}/Embeddings", ic.EndpointPath())
+	})
+
+	t.Run("with a property in both the allow-list and the deny-list", func(t *testing.T) {
+		classConfig := map[string]interface{}{
+			"properties":        []interface{}{"title", "body"},
+			"excludeProperties": []interface{}{"title", "secret"},
+		}
+
+		ic := NewClassSettings(&fakeClassConfig{classConfig: classConfig})
+		assert.Equal(t, []string{"title"}, ic.ConflictingProperties())
+		assert.False(t, ic.PropertyIndexed("title"))
+		assert.True(t, ic.PropertyIndexed("body"))
+		assert.False(t, ic.PropertyIndexed("secret"))
+
+		classConfig["propertyListPrecedence"] = PropertyListPrecedenceAllow
+		ic = NewClassSettings(&fakeClassConfig{classConfig: classConfig})
+		assert.True(t, ic.PropertyIndexed("title"))
+		assert.True(t, ic.PropertyIndexed("body"))
+		// the precedence only matters for conflicts
+		assert.False(t, ic.PropertyIndexed("secret"))
+	})
 }
@@ -0,0 +1,149 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+type contextKey int
+
+const (
+	batchPriorityKey contextKey = iota
+	callKindKey
+	importBudgetKey
+	tokenBudgetKey
+	batchCountersKey
+	subBatchKey
+	highPrecisionKey
+	modelKey
+)
+
+// BatchPriority controls the order in which queued batches are vectorized
+type BatchPriority int
+
+const (
+	BatchPriorityNormal BatchPriority = iota
+	// BatchPriorityHigh batches are vectorized before all queued normal batches. With WithPreemption they also pause
+	// a running normal batch between two of its requests to the vectorizer.
+	BatchPriorityHigh
+)
+
+// ContextWithBatchPriority sets the priority of all batches vectorized with the returned context
+func ContextWithBatchPriority(ctx context.Context, priority BatchPriority) context.Context {
+	return context.WithValue(ctx, batchPriorityKey, priority)
+}
+
+// BatchPriorityFromContext returns the priority set with ContextWithBatchPriority, BatchPriorityNormal otherwise
+func BatchPriorityFromContext(ctx context.Context) BatchPriority {
+	if priority, ok := ctx.Value(batchPriorityKey).(BatchPriority); ok {
+		return priority
+	}
+	return BatchPriorityNormal
+}
+
+// CallKind tells the vectorizer whether it is called to vectorize a query or objects during an import. Both have
+// different tradeoffs between latency and throughput, see WithQueryBatchTime.
+type CallKind int
+
+const (
+	CallKindImport CallKind = iota
+	CallKindQuery
+)
+
+// ContextWithCallKind sets the kind of all vectorizer calls with the returned context
+func ContextWithCallKind(ctx context.Context, kind CallKind) context.Context {
+	return context.WithValue(ctx, callKindKey, kind)
+}
+
+// CallKindFromContext returns the kind set with ContextWithCallKind, CallKindImport otherwise
+func CallKindFromContext(ctx context.Context) CallKind {
+	if kind, ok := ctx.Value(callKindKey).(CallKind); ok {
+		return kind
+	}
+	return CallKindImport
+}
+
+// ImportBudget is a hard ceiling for the time that all vectorizer calls of an import can take together, regardless of
+// the deadlines of the single calls. The budget starts when it is created.
+type ImportBudget struct {
+	deadline time.Time
+}
+
+func NewImportBudget(maxDuration time.Duration) *ImportBudget {
+	return &ImportBudget{deadline: time.Now().Add(maxDuration)}
+}
+
+// Exhausted returns whether the time of the budget is used up
+func (b *ImportBudget) Exhausted() bool {
+	return !time.Now().Before(b.deadline)
+}
+
+// ContextWithImportBudget ties all batches vectorized with the returned context to the budget. Once the budget is
+// exhausted, batches fail with ErrImportTimeBudgetExceeded without being vectorized. Batches that are running when
+// the budget runs out are cancelled like with a context deadline.
+func ContextWithImportBudget(ctx context.Context, budget *ImportBudget) context.Context {
+	return context.WithValue(ctx, importBudgetKey, budget)
+}
+
+// ImportBudgetFromContext returns the budget set with ContextWithImportBudget, nil otherwise
+func ImportBudgetFromContext(ctx context.Context) *ImportBudget {
+	if budget, ok := ctx.Value(importBudgetKey).(*ImportBudget); ok {
+		return budget
+	}
+	return nil
+}
+
+// ContextWithTokenBudget lets every request to the vectorizer of the batches vectorized with the returned context use
+// up to the given tokens, instead of 95% of the tokens that are remaining according to the latest rate limits. It is
+// meant for small urgent batches that should not be split into many requests. The budget can only raise the tokens
+// per request and is clamped to the token limit of the account, or of the model with WithModelLimits.
+func ContextWithTokenBudget(ctx context.Context, tokens int) context.Context {
+	return context.WithValue(ctx, tokenBudgetKey, tokens)
+}
+
+// TokenBudgetFromContext returns the budget set with ContextWithTokenBudget, 0 otherwise
+func TokenBudgetFromContext(ctx context.Context) int {
+	if tokens, ok := ctx.Value(tokenBudgetKey).(int); ok {
+		return tokens
+	}
+	return 0
+}
+
+// ContextWithJobID tags all batches vectorized with the returned context with the ID of the import or job they belong
+// to. The ID is part of the log entries of the batches and is sent to OpenAI with every request, see ent.JobIDHeader.
+func ContextWithJobID(ctx context.Context, jobID string) context.Context {
+	return ent.ContextWithJobID(ctx, jobID)
+}
+
+// JobIDFromContext returns the ID set with ContextWithJobID, "" otherwise
+func JobIDFromContext(ctx context.Context) string {
+	return ent.JobIDFromContext(ctx)
+}
+
+// ContextWithModel vectorizes all batches with the returned context with the given model instead of the model of the
+// class, e.g. to compare models on the same class without changing the schema. The model specific settings of the
+// class don't apply, and the batches are paced by the rate limits of the model like the properties of propertyModels.
+// Azure deployments keep the model of their deployment. Batches with a model that is not an available OpenAI model fail
+// with ErrUnknownModel.
+func ContextWithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey, model)
+}
+
+// ModelFromContext returns the model set with ContextWithModel, "" otherwise
+func ModelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelKey).(string)
+	return model
+}
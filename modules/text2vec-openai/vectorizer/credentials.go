@@ -0,0 +1,59 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/weaviate/weaviate/entities/moduletools"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+// credentialsCheckInput is the input of the request of CheckCredentials, a single token
+const credentialsCheckInput = "ping"
+
+// CheckCredentials sends a single tiny embeddings request with the configuration of the class and the API key of the
+// context, so that startup tooling or the creation of a class can fail early with a clear message instead of the
+// first import. The error matches ErrInvalidCredentials, ErrProviderUnreachable or ErrModelNotFound (with errors.Is)
+// if it is one of these, other errors are returned as they are. Nothing is cached and the rate limits of the batches
+// are left alone.
+func (v *Vectorizer) CheckCredentials(ctx context.Context, cfg moduletools.ClassConfig) error {
+	ctx, cancel := v.requestContext(ctx)
+	defer cancel()
+	res, _, err := v.client.Vectorize(ctx, []string{credentialsCheckInput}, v.getVectorizationConfig(cfg))
+	if err == nil && res != nil && len(res.Errors) > 0 {
+		err = res.Errors[0]
+	}
+	if err != nil {
+		return classifyCredentialsError(err)
+	}
+	return nil
+}
+
+func classifyCredentialsError(err error) error {
+	var provider *clients.ProviderError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, clients.ErrMissingAPIKey), errors.As(err, &provider) && provider.AuthFailure():
+		return fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	case errors.Is(err, clients.ErrModelUnavailable):
+		return fmt.Errorf("%w: %w", ErrModelNotFound, err)
+	case errors.Is(err, clients.ErrDNS), errors.Is(err, ErrRequestTimeout),
+		errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return fmt.Errorf("%w: %w", ErrProviderUnreachable, err)
+	default:
+		return err
+	}
+}
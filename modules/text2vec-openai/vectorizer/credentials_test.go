@@ -0,0 +1,56 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+func TestCheckCredentials(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+
+	t.Run("valid credentials", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		require.NoError(t, v.CheckCredentials(context.Background(), &fakeClassConfig{classConfig: map[string]interface{}{}}))
+		require.Equal(t, [][]string{{credentialsCheckInput}}, client.requests())
+	})
+
+	t.Run("rejected API key", func(t *testing.T) {
+		client := &fakeBatchClient{invalidAPIKey: true}
+		v := New(client, 40*time.Second, logger)
+
+		err := v.CheckCredentials(context.Background(), &fakeClassConfig{classConfig: map[string]interface{}{}})
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		var provider *clients.ProviderError
+		require.ErrorAs(t, err, &provider)
+		require.Equal(t, "invalid_api_key", provider.Code)
+		require.Len(t, client.requests(), 1)
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		client := &fakeBatchClient{unavailableModels: []string{"ada"}}
+		v := New(client, 40*time.Second, logger)
+
+		err := v.CheckCredentials(context.Background(), &fakeClassConfig{classConfig: map[string]interface{}{"model": "ada"}})
+		require.ErrorIs(t, err, ErrModelNotFound)
+		require.NotErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
@@ -0,0 +1,50 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+// dedupeInputs skips all objects whose input is the same as the input of an earlier object of the batch, see
+// dedupeInputs of the class settings. It returns a copy of the skip list, the index of the first object with the same
+// input for every duplicate and the number of objects that still need to be vectorized. Duplicates don't cost any
+// tokens.
+func dedupeInputs(texts []string, skipObject []bool, tokens []int, objectCount int) ([]bool, map[int]int, int) {
+	skip := append([]bool{}, skipObject...)
+	first := make(map[string]int, len(texts))
+	duplicates := make(map[int]int)
+	for i := range texts {
+		if skip[i] {
+			continue
+		}
+		if original, ok := first[texts[i]]; ok {
+			duplicates[i] = original
+			skip[i] = true
+			tokens[i] = 0
+			objectCount--
+			continue
+		}
+		first[texts[i]] = i
+	}
+	return skip, duplicates, objectCount
+}
+
+// fanOutDuplicates copies the vector and model or the error of the original object to each of its duplicates
+func fanOutDuplicates(duplicates map[int]int, vecs [][]float32, errs map[int]error, models []string) {
+	for duplicate, original := range duplicates {
+		if err, ok := errs[original]; ok {
+			errs[duplicate] = err
+			continue
+		}
+		if vecs[original] != nil {
+			vecs[duplicate] = append([]float32(nil), vecs[original]...)
+			models[duplicate] = models[original]
+		}
+	}
+}
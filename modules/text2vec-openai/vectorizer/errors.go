@@ -0,0 +1,106 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import "github.com/pkg/errors"
+
+// ErrStale is returned for objects that waited longer than the configured max input age in the batch queue
+var ErrStale = errors.New("object waited too long in the batch queue and is stale")
+
+// ErrSuperseded is returned for objects that were not vectorized because a newer version of the object exists by the
+// time the batch worker reached them. The caller is expected to re-submit the latest version.
+var ErrSuperseded = errors.New("object was superseded by a newer version")
+
+// ErrDimensionMismatch is returned for objects whose vector does not have the requested number of dimensions
+var ErrDimensionMismatch = errors.New("vector does not have the requested dimensions")
+
+// ErrNilObject is returned for nil entries of the objects of a batch
+var ErrNilObject = errors.New("object is nil")
+
+// ErrSkipObjectMismatch is matched by the errors of all objects of a batch whose skip list doesn't have an entry for
+// every object
+var ErrSkipObjectMismatch = errors.New("skip list does not match the objects")
+
+// ErrImportTimeBudgetExceeded is returned for all objects of batches whose import budget (see ContextWithImportBudget)
+// is exhausted
+var ErrImportTimeBudgetExceeded = errors.New("time budget of the import exceeded")
+
+// ErrBatchTimeBudgetExceeded is returned for all objects of a batch that were not vectorized before the maximum
+// duration of the batch call passed, see WithMaxBatchDuration
+var ErrBatchTimeBudgetExceeded = errors.New("time budget of the batch exceeded")
+
+// ErrRequestTimeout is returned for objects whose request to OpenAI did not finish within the timeout of a single
+// request, see WithRequestTimeout
+var ErrRequestTimeout = errors.New("request to the vectorizer timed out")
+
+// ErrCircuitOpen is returned for objects that were not sent to OpenAI because too many consecutive requests failed
+// before, see WithCircuitBreaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrUnknownModel is matched by the errors of all objects of batches whose model is overridden with ContextWithModel by
+// a model that is not an available OpenAI model
+var ErrUnknownModel = errors.New("unknown model")
+
+// ErrInvalidCredentials is matched by errors of CheckCredentials if no API key is configured or OpenAI rejected it
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrProviderUnreachable is matched by errors of CheckCredentials if the request didn't reach OpenAI or got no
+// response in time
+var ErrProviderUnreachable = errors.New("vectorizer is unreachable")
+
+// ErrModelNotFound is matched by errors of CheckCredentials if the configured model doesn't exist or the account has
+// no access to it
+var ErrModelNotFound = errors.New("model not found")
+
+// ErrSubBatchTooLarge is returned for all objects of a sub-batch that doesn't fit into a single request, see
+// ObjectSubBatch
+var ErrSubBatchTooLarge = errors.New("sub-batch does not fit into a single request")
+
+// ErrMixedDimensions is returned for objects whose vector has a different number of dimensions than the other vectors
+// of the batch, see ObjectBatchResults
+var ErrMixedDimensions = errors.New("vector dimensions differ from the other vectors of the batch")
+
+// ErrInputTooLong is returned for objects whose input has more tokens than allowed with maxInputFraction
+var ErrInputTooLong = errors.New("input has too many tokens")
+
+// ErrUnrenderableProperty is matched by errors of properties that cannot be rendered into the input, e.g. an unexpected
+// nested type. These properties are left out, with strictAssembly their objects fail.
+var ErrUnrenderableProperty = errors.New("property cannot be rendered into the input")
+
+// ErrEmptyInput is returned for objects whose assembled input has no text if vectorizeEmptyObjects is set. By
+// default such objects are skipped.
+var ErrEmptyInput = errors.New("input is empty")
+
+// errSkippedInput marks objects that are skipped during a background assembly without an error, see skipInput
+var errSkippedInput = errors.New("input skipped")
+
+// ErrTextTooLong is matched (with errors.Is) by errors of objects whose input has more tokens than the context window
+// of the model or the token limit of the account allows for a single request. These objects fail every time and should
+// not be retried. Objects that fail because the token limit doesn't refresh within the batch time don't match, they
+// might succeed later.
+var ErrTextTooLong = errors.New("text too long for vectorization")
+
+// TextTooLongError is the error of objects whose input has more tokens than the token limit, see ErrTextTooLong
+type TextTooLongError struct {
+	// Tokens is the estimated number of tokens of the input
+	Tokens int
+	// Limit is the context window of the model or the token limit that was reported by OpenAI
+	Limit int
+}
+
+func (e *TextTooLongError) Error() string {
+	return ErrTextTooLong.Error()
+}
+
+func (e *TextTooLongError) Is(target error) bool {
+	return target == ErrTextTooLong
+}
@@ -0,0 +1,64 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	enterrors "github.com/weaviate/weaviate/entities/errors"
+)
+
+// ObjectEvent describes the outcome of vectorizing a single object of a batch
+type ObjectEvent struct {
+	// Index is the position of the object in the batch
+	Index   int
+	Skipped bool
+	Err     error
+	// Tokens is the number of tokens of the input of the object, 0 if its vector came from a cache
+	Tokens int
+	// Duration is how long the call that vectorized the object took
+	Duration time.Duration
+}
+
+// EventSink receives an event for every object of every batch, see WithEventSink
+type EventSink interface {
+	ObjectVectorized(event ObjectEvent)
+}
+
+// eventEmitter passes events to the sink through a buffer, so a slow sink never blocks vectorization. Events that
+// don't fit into the buffer are dropped.
+type eventEmitter struct {
+	sink    EventSink
+	events  chan ObjectEvent
+	dropped atomic.Int64
+}
+
+func newEventEmitter(sink EventSink, bufferSize int, logger logrus.FieldLogger) *eventEmitter {
+	e := &eventEmitter{sink: sink, events: make(chan ObjectEvent, bufferSize)}
+	enterrors.GoWrapper(func() {
+		for event := range e.events {
+			e.sink.ObjectVectorized(event)
+		}
+	}, logger)
+	return e
+}
+
+func (e *eventEmitter) emit(event ObjectEvent) {
+	select {
+	case e.events <- event:
+	default:
+		e.dropped.Add(1)
+	}
+}
@@ -0,0 +1,95 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+type fakeEventSink struct {
+	sync.Mutex
+	events  []ObjectEvent
+	blockCh chan struct{}
+}
+
+func (s *fakeEventSink) ObjectVectorized(event ObjectEvent) {
+	if s.blockCh != nil {
+		<-s.blockCh
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *fakeEventSink) received() []ObjectEvent {
+	s.Lock()
+	defer s.Unlock()
+	return append([]ObjectEvent{}, s.events...)
+}
+
+func TestBatchEventSink(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}
+	skip := []bool{false, false, true}
+
+	t.Run("events are delivered for each object", func(t *testing.T) {
+		sink := &fakeEventSink{}
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithEventSink(sink, 10))
+
+		v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Eventually(t, func() bool { return len(sink.received()) == len(objects) }, time.Second, time.Millisecond)
+		events := sink.received()
+		for i := range events {
+			assert.Equal(t, i, events[i].Index)
+			assert.Greater(t, events[i].Duration, time.Duration(0))
+		}
+		assert.NoError(t, events[0].Err)
+		assert.Greater(t, events[0].Tokens, 0)
+		assert.EqualError(t, events[1].Err, "something")
+		assert.True(t, events[2].Skipped)
+	})
+
+	t.Run("a slow sink does not block the batch", func(t *testing.T) {
+		sink := &fakeEventSink{blockCh: make(chan struct{})}
+		defer close(sink.blockCh)
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithEventSink(sink, 1))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			v.ObjectBatch(context.Background(), objects, skip, cfg)
+			v.ObjectBatch(context.Background(), objects, skip, cfg)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("batch was blocked by the event sink")
+		}
+		// at most one event is in the sink and one in the buffer, all others are dropped
+		assert.GreaterOrEqual(t, v.events.dropped.Load(), int64(2*len(objects)-2))
+	})
+}
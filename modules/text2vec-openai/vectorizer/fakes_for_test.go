@@ -14,35 +14,240 @@ package vectorizer
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
 	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
 )
 
 type fakeBatchClient struct {
 	lastInput        []string
 	lastConfig       ent.VectorizationConfig
+	lastJobID        string
 	defaultResetRate int
+
+	sync.Mutex
+	// model is reported as the model of all responses
+	model string
+	// modelSwitches change the model to the value of an input from the response of that input on
+	modelSwitches map[string]string
+	// tokensPerRequest is reported as the tokens of all requests
+	tokensPerRequest int
+	// latency delays all responses
+	latency time.Duration
+	// remainingTokens overrides the remaining tokens of the default rate limits
+	remainingTokens int
+	// withoutRateLimits reports empty rate limits like providers without rate limit headers
+	withoutRateLimits bool
+	// rateLimitHeaders replace the rate limit headers of all responses, empty values remove a header
+	rateLimitHeaders map[string]string
+	// missingVectors drops the vectors and errors of the last inputs of every response
+	missingVectors int
+	// echoVectors returns echoVector of every input instead of the same vector for all inputs
+	echoVectors bool
+	// requests with these models fail with clients.ErrModelUnavailable
+	unavailableModels []string
+	// invalidAPIKey rejects all requests like an "invalid api key" input
+	invalidAPIKey bool
+	// requestID is returned as the ID of all requests like by the OpenAI client
+	requestID string
+	// inputs of all requests in the order they were received
+	history [][]string
+	// start times of all requests in the order they were received
+	requestTimes []time.Time
+	// models of all requests in the order they were received
+	requestModels []string
+	// number of requests that failed because of an "overloaded N" input
+	overloaded int
+	// number of requests that failed because of a "server error N" input
+	serverErrors int
+	// number of requests that hung because of a "hang N" input
+	hangs int
+	// number of requests that failed because of a "dns N" input
+	dnsFailures int
+	// number of requests whose response was not JSON because of a "malformed N" input
+	malformed int
+	// number of requests that failed because of a "ratelimited N" input
+	rateLimited int
+	// retryAfter is reported as the Retry-After of rate limited requests
+	retryAfter time.Duration
+	// if set, the tokens of all requests that are in flight at the same time are tracked
+	countTokens       func(string) int
+	inFlightTokens    int
+	maxInFlightTokens int
+}
+
+// rateLimitHeader returns the headers with which OpenAI reports the rate limits
+func rateLimitHeader(rateLimit *ent.RateLimits) http.Header {
+	header := http.Header{}
+	header.Set("x-ratelimit-limit-requests", strconv.Itoa(rateLimit.LimitRequests))
+	header.Set("x-ratelimit-limit-tokens", strconv.Itoa(rateLimit.LimitTokens))
+	header.Set("x-ratelimit-remaining-requests", strconv.Itoa(rateLimit.RemainingRequests))
+	header.Set("x-ratelimit-remaining-tokens", strconv.Itoa(rateLimit.RemainingTokens))
+	header.Set("x-ratelimit-reset-requests", fmt.Sprintf("%ds", rateLimit.ResetRequests))
+	header.Set("x-ratelimit-reset-tokens", fmt.Sprintf("%ds", rateLimit.ResetTokens))
+	return header
+}
+
+// fakeRateLimitError is a 429 response with an optional Retry-After header
+type fakeRateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *fakeRateLimitError) Error() string {
+	return "connection to: OpenAI API failed with status: 429"
+}
+
+func (e *fakeRateLimitError) Is(target error) bool {
+	return target == clients.ErrRateLimited
+}
+
+func (e *fakeRateLimitError) RetryAfter() time.Duration {
+	return e.retryAfter
 }
 
 func (c *fakeBatchClient) Vectorize(ctx context.Context,
 	text []string, cfg ent.VectorizationConfig,
 ) (*ent.VectorizationResult, *ent.RateLimits, error) {
+	c.Lock()
+	c.history = append(c.history, append([]string{}, text...))
+	c.requestTimes = append(c.requestTimes, time.Now())
+	c.requestModels = append(c.requestModels, cfg.Model)
+	if slices.Contains(c.unavailableModels, cfg.Model) {
+		c.Unlock()
+		return nil, nil, fmt.Errorf("connection to: OpenAI API failed with status: 404 error: model %s does not exist: %w",
+			cfg.Model, clients.ErrModelUnavailable)
+	}
+	for i := range text {
+		// fails the whole request for the first N requests that contain the input
+		if strings.HasPrefix(text[i], "overloaded ") {
+			n, _ := strconv.Atoi(strings.Split(text[i][len("overloaded "):], " ")[0])
+			if c.overloaded < n {
+				c.overloaded++
+				c.Unlock()
+				return nil, nil, fmt.Errorf("connection to: OpenAI API failed with status: 503: %w", clients.ErrModelOverloaded)
+			}
+		}
+		if strings.HasPrefix(text[i], "server error ") {
+			n, _ := strconv.Atoi(strings.Split(text[i][len("server error "):], " ")[0])
+			if c.serverErrors < n {
+				c.serverErrors++
+				c.Unlock()
+				return nil, nil, fmt.Errorf("connection to: OpenAI API failed with status: 500 error: %w", &clients.ProviderError{
+					Type: "server_error", Message: "the server had an error", HTTPStatus: http.StatusInternalServerError,
+				})
+			}
+		}
+		if strings.HasPrefix(text[i], "hang ") {
+			// hangs until the request is cancelled, like a request that never gets a response
+			n, _ := strconv.Atoi(strings.Split(text[i][len("hang "):], " ")[0])
+			if c.hangs < n {
+				c.hangs++
+				c.Unlock()
+				<-ctx.Done()
+				return nil, nil, fmt.Errorf("send POST request: %w", ctx.Err())
+			}
+		}
+		if text[i] == "invalid api key" || c.invalidAPIKey {
+			c.Unlock()
+			return nil, nil, fmt.Errorf("connection to: OpenAI API failed with status: 401 error: %w", &clients.ProviderError{
+				Type: "invalid_request_error", Code: "invalid_api_key", Message: "incorrect API key", HTTPStatus: http.StatusUnauthorized,
+			})
+		}
+		if text[i] == "missing api key" {
+			c.Unlock()
+			return nil, nil, fmt.Errorf("API Key: %w", clients.ErrMissingAPIKey)
+		}
+		if text[i] == "insufficient quota" {
+			c.Unlock()
+			return nil, nil, fmt.Errorf("connection to: OpenAI API failed with status: 429: %w", clients.ErrQuotaExhausted)
+		}
+		if strings.HasPrefix(text[i], "ratelimited ") {
+			n, _ := strconv.Atoi(strings.Split(text[i][len("ratelimited "):], " ")[0])
+			if c.rateLimited < n {
+				c.rateLimited++
+				c.Unlock()
+				return nil, nil, &fakeRateLimitError{retryAfter: c.retryAfter}
+			}
+		}
+		if strings.HasPrefix(text[i], "dns ") {
+			n, _ := strconv.Atoi(strings.Split(text[i][len("dns "):], " ")[0])
+			if c.dnsFailures < n {
+				c.dnsFailures++
+				c.Unlock()
+				return nil, nil, fmt.Errorf("send POST request: lookup api.openai.com: %w", clients.ErrDNS)
+			}
+		}
+		if strings.HasPrefix(text[i], "malformed ") {
+			n, _ := strconv.Atoi(strings.Split(text[i][len("malformed "):], " ")[0])
+			if c.malformed < n {
+				c.malformed++
+				c.Unlock()
+				return nil, nil, fmt.Errorf("unmarshal response body with status 502: %q: %w", "<html>Bad Gateway</html>",
+					clients.ErrMalformedResponse)
+			}
+		}
+	}
 	c.lastInput = text
 	c.lastConfig = cfg
-
+	c.lastJobID = ent.JobIDFromContext(ctx)
 	if c.defaultResetRate == 0 {
 		c.defaultResetRate = 60
 	}
+	resetRate := c.defaultResetRate
+	for i := range text {
+		if model, ok := c.modelSwitches[text[i]]; ok {
+			c.model = model
+		}
+	}
+	model := c.model
+	reportedTokens := c.tokensPerRequest
+	latency := c.latency
+	remainingTokens := c.remainingTokens
+	withoutRateLimits := c.withoutRateLimits
+	rateLimitHeaders := c.rateLimitHeaders
+	missingVectors := c.missingVectors
+	echoVectors := c.echoVectors
+	requestID := c.requestID
+	if c.countTokens != nil {
+		tokens := 0
+		for i := range text {
+			tokens += c.countTokens(text[i])
+		}
+		c.inFlightTokens += tokens
+		if c.inFlightTokens > c.maxInFlightTokens {
+			c.maxInFlightTokens = c.inFlightTokens
+		}
+		defer func() {
+			c.Lock()
+			c.inFlightTokens -= tokens
+			c.Unlock()
+		}()
+	}
+	c.Unlock()
+	time.Sleep(latency)
 
 	vectors := make([][]float32, len(text))
 	errors := make([]error, len(text))
-	rateLimit := &ent.RateLimits{RemainingTokens: 100, RemainingRequests: 100, LimitTokens: 200, ResetTokens: c.defaultResetRate, ResetRequests: 1}
+	rateLimit := &ent.RateLimits{
+		RemainingTokens: 100, RemainingRequests: 100, LimitTokens: 200, LimitRequests: 200, ResetTokens: resetRate, ResetRequests: 1,
+	}
+	if remainingTokens > 0 {
+		rateLimit.RemainingTokens = remainingTokens
+		rateLimit.LimitTokens = 2 * remainingTokens
+	}
 	for i := range text {
 		if len(text[i]) >= len("error ") && text[i][:6] == "error " {
-			errors[i] = fmt.Errorf(text[i][6:])
+			// like an input that OpenAI rejected in an otherwise successful response
+			errors[i] = clients.WithRequestID(&clients.ProviderError{
+				Type: "invalid_request_error", Message: text[i][6:], HTTPStatus: http.StatusOK,
+			}, requestID)
 			continue
 		}
 
@@ -57,24 +262,93 @@ func (c *fakeBatchClient) Vectorize(ctx context.Context,
 		if len(text[i]) >= req && text[i][:req] == "requests " {
 			reqs, _ := strconv.Atoi(strings.Split(text[i][req:], " ")[0])
 			rateLimit.RemainingRequests = reqs
-			rateLimit.LimitRequests = 2 * reqs
+			rateLimit.LimitRequests = max(2*reqs, rateLimit.LimitRequests)
+		}
+
+		if strings.HasPrefix(text[i], "dimensions ") {
+			// ignores the requested dimensions
+			dimensions, _ := strconv.Atoi(strings.Split(text[i][len("dimensions "):], " ")[0])
+			vectors[i] = make([]float32, dimensions)
+			for j := range vectors[i] {
+				vectors[i][j] = 1
+			}
+			continue
+		}
+
+		if strings.HasPrefix(text[i], "slow ") {
+			// unlike wait, slow requests are cancelled with their context
+			slow, _ := strconv.Atoi(strings.Split(text[i][len("slow "):], " ")[0])
+			if err := sleepWithContext(ctx, time.Duration(slow)*time.Millisecond); err != nil {
+				return nil, nil, err
+			}
 		}
 
 		if len(text[i]) >= len("wait ") && text[i][:5] == "wait " {
-			wait, _ := strconv.Atoi(text[i][5:])
+			wait, _ := strconv.Atoi(strings.Split(text[i][5:], " ")[0])
 			time.Sleep(time.Duration(wait) * time.Millisecond)
 		}
 		vectors[i] = []float32{0, 1, 2, 3}
+		if echoVectors {
+			vectors[i] = echoVector(text[i])
+		}
+	}
+	header := rateLimitHeader(rateLimit)
+	if withoutRateLimits {
+		header = http.Header{}
+	}
+	for key, value := range rateLimitHeaders {
+		if value == "" {
+			header.Del(key)
+		} else {
+			header.Set(key, value)
+		}
+	}
+	// the rate limits are parsed from the headers like by the OpenAI client
+	rateLimit = ent.GetRateLimitsFromHeader(header)
+	if missingVectors > 0 {
+		keep := max(len(text)-missingVectors, 0)
+		vectors, errors = vectors[:keep], errors[:keep]
+	}
+
+	var highPrecision [][]float64
+	if cfg.HighPrecision {
+		// like a response whose values have more digits than float32 keeps
+		highPrecision = make([][]float64, len(vectors))
+		for i := range vectors {
+			if vectors[i] != nil {
+				highPrecision[i] = make([]float64, len(vectors[i]))
+				for j := range vectors[i] {
+					highPrecision[i][j] = float64(vectors[i][j]) * (1 + 1e-12)
+				}
+			}
+		}
 	}
 
 	return &ent.VectorizationResult{
-		Vector:     vectors,
-		Dimensions: 4,
-		Text:       text,
-		Errors:     errors,
+		Vector:        vectors,
+		VectorFloat64: highPrecision,
+		Dimensions:    4,
+		Text:          text,
+		Errors:        errors,
+		Model:         model,
+		Tokens:        reportedTokens,
+		RequestID:     requestID,
 	}, rateLimit, nil
 }
 
+// echoVector is a vector that identifies the input it was created for
+func echoVector(text string) []float32 {
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	sum := h.Sum32()
+	return []float32{float32(len(text)), float32(sum >> 16), float32(sum & 0xffff), 1}
+}
+
+// AccountKey tells accounts apart by the base URL of the config, see WithRateLimitLanes
+func (c *fakeBatchClient) AccountKey(ctx context.Context, cfg ent.VectorizationConfig) string {
+	return cfg.BaseURL
+}
+
 func (c *fakeBatchClient) VectorizeQuery(ctx context.Context,
 	text []string, cfg ent.VectorizationConfig,
 ) (*ent.VectorizationResult, error) {
@@ -157,3 +431,37 @@ func (f fakeClassConfig) Tenant() string {
 func (f fakeClassConfig) TargetVector() string {
 	return ""
 }
+
+func (c *fakeBatchClient) setModel(model string) {
+	c.Lock()
+	defer c.Unlock()
+	c.model = model
+}
+
+func (c *fakeBatchClient) requests() [][]string {
+	c.Lock()
+	defer c.Unlock()
+	return c.history
+}
+
+// fakeExternalCache is an ExternalCache backed by a map
+type fakeExternalCache struct {
+	sync.Mutex
+	vectors map[string][]float32
+}
+
+func (c *fakeExternalCache) Lookup(key string) ([]float32, bool) {
+	c.Lock()
+	defer c.Unlock()
+	vector, ok := c.vectors[key]
+	return vector, ok
+}
+
+func (c *fakeExternalCache) Store(key string, vector []float32) {
+	c.Lock()
+	defer c.Unlock()
+	if c.vectors == nil {
+		c.vectors = make(map[string][]float32)
+	}
+	c.vectors[key] = vector
+}
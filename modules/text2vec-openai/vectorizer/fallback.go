@@ -0,0 +1,73 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+type sendFunc func(conf ent.VectorizationConfig) (*ent.VectorizationResult, *ent.RateLimits, error)
+
+// withFallbackModels sends the request with the model of conf. If that model is not available (see
+// clients.ErrModelUnavailable) the same inputs are sent with the fallbackModels in order, until a model succeeds or
+// fails with any other error. It returns the config of the model that was sent last.
+func withFallbackModels(conf ent.VectorizationConfig, fallbackModels []string, send sendFunc,
+) (*ent.VectorizationResult, *ent.RateLimits, ent.VectorizationConfig, error) {
+	res, rateLimit, err := send(conf)
+	for _, model := range fallbackModels {
+		if err == nil || !errors.Is(err, clients.ErrModelUnavailable) {
+			return res, rateLimit, conf, err
+		}
+		if model == conf.Model {
+			continue
+		}
+		conf = fallbackConfig(conf, model)
+		res, rateLimit, err = send(conf)
+	}
+	if len(fallbackModels) > 0 && errors.Is(err, clients.ErrModelUnavailable) {
+		err = fmt.Errorf("no fallback model is available: %w", err)
+	}
+	return res, rateLimit, conf, err
+}
+
+// vectorModels returns the model of every vector. Vectors without a model in models came from a cache, which only
+// holds vectors of the given model of the class.
+func vectorModels(vecs [][]float32, models []string, model string) []string {
+	vecModels := make([]string, len(vecs))
+	for i := range vecs {
+		switch {
+		case vecs[i] == nil:
+		case models != nil && models[i] != "":
+			vecModels[i] = models[i]
+		default:
+			vecModels[i] = model
+		}
+	}
+	return vecModels
+}
+
+// fallbackConfig returns conf with the given model instead of the model of the class. The model version is the
+// default of the model and the dimensions are only kept if the model supports them, otherwise the model returns its
+// full vectors.
+func fallbackConfig(conf ent.VectorizationConfig, model string) ent.VectorizationConfig {
+	conf.Model = model
+	conf.ModelVersion = PickDefaultModelVersion(model, conf.Type)
+	if maxDimensions, ok := maxV3ModelsDimensions[model]; !ok || conf.Dimensions == nil || *conf.Dimensions > maxDimensions {
+		conf.Dimensions = PickDefaultDimensions(model)
+	}
+	return conf
+}
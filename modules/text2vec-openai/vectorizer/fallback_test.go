@@ -0,0 +1,109 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+func TestBatchFallbackModels(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+		"vectorizeClassName": false, "fallbackModels": []interface{}{"Babbage", "curie"},
+	}}
+	logger, _ := test.NewNullLogger()
+	texts := []string{"first text", "second text", "third text"}
+	objects := make([]*models.Object, len(texts))
+	for i, text := range texts {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": text}}
+	}
+	skip := make([]bool, len(objects))
+
+	t.Run("the next model vectorizes the inputs if the model is not available", func(t *testing.T) {
+		client := &fakeBatchClient{echoVectors: true, unavailableModels: []string{"ada"}}
+		v := New(client, 40*time.Second, logger, WithVectorCache(10, false))
+
+		for call := 0; call < 2; call++ {
+			results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+			require.Len(t, results, len(objects))
+			for i := range results {
+				require.NoError(t, results[i].Err)
+				assert.Equal(t, echoVector(texts[i]), results[i].Vector)
+				assert.Equal(t, "babbage", results[i].Model)
+				// vectors of fallback models are not cached
+				assert.False(t, results[i].CacheHit)
+			}
+		}
+		for i, model := range client.requestModels {
+			// every request is sent with the model of the class first
+			if i%2 == 0 {
+				assert.Equal(t, "ada", model)
+			} else {
+				assert.Equal(t, "babbage", model)
+				assert.Equal(t, client.history[i-1], client.history[i])
+			}
+		}
+
+		vec, _, err := v.Object(context.Background(), objects[0], cfg)
+		require.NoError(t, err)
+		assert.Equal(t, echoVector(texts[0]), vec)
+	})
+
+	t.Run("the model of the class is reported if it is available", func(t *testing.T) {
+		client := &fakeBatchClient{echoVectors: true}
+		v := New(client, 40*time.Second, logger)
+
+		results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+		for i := range results {
+			require.NoError(t, results[i].Err)
+			assert.Equal(t, "ada", results[i].Model)
+		}
+		assert.NotContains(t, client.requestModels, "babbage")
+	})
+
+	t.Run("all objects fail if no model of the chain is available", func(t *testing.T) {
+		client := &fakeBatchClient{unavailableModels: []string{"ada", "babbage", "curie"}}
+		v := New(client, 40*time.Second, logger)
+
+		vecs, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+
+		require.Len(t, errs, len(objects))
+		for i := range objects {
+			assert.ErrorIs(t, errs[i], clients.ErrModelUnavailable)
+			assert.ErrorContains(t, errs[i], "no fallback model is available")
+			assert.Nil(t, vecs[i])
+		}
+		assert.Equal(t, []string{"ada", "babbage", "curie"}, client.requestModels[:3])
+	})
+
+	t.Run("other errors don't fall back", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "error broken"}},
+		}, []bool{false}, cfg)
+
+		require.Len(t, errs, 1)
+		assert.EqualError(t, errs[0], "broken")
+		assert.Equal(t, []string{"ada"}, client.requestModels)
+	})
+}
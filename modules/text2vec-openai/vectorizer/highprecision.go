@@ -0,0 +1,73 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/entities/moduletools"
+)
+
+// highPrecisionVectors collects the float64 vectors of a batch call, see ObjectBatchHighPrecision
+type highPrecisionVectors struct {
+	vecs [][]float64
+}
+
+// highPrecisionFromContext returns the collector of the batch call of ctx, nil if float32 vectors are sufficient
+func highPrecisionFromContext(ctx context.Context) *highPrecisionVectors {
+	collector, _ := ctx.Value(highPrecisionKey).(*highPrecisionVectors)
+	return collector
+}
+
+// ObjectBatchHighPrecision vectorizes the given objects like ObjectBatch, but returns the vectors in float64. With
+// WithHighPrecision the vectors keep the full precision of the response, otherwise and for vectors that are not taken
+// from a response as they are, e.g. cache hits, the combined vectors of sections or vectors whose dimensions were
+// adjusted, the float32 vectors are converted. Either way the vectors agree with the ones of ObjectBatch in float32.
+func (v *Vectorizer) ObjectBatchHighPrecision(ctx context.Context, objects []*models.Object, skipObject []bool,
+	cfg moduletools.ClassConfig,
+) ([][]float64, map[int]error) {
+	collector := &highPrecisionVectors{}
+	if v.highPrecision {
+		ctx = context.WithValue(ctx, highPrecisionKey, collector)
+	}
+	vecs, errs := v.ObjectBatch(ctx, objects, skipObject, cfg)
+
+	highPrecision := make([][]float64, len(vecs))
+	for i := range vecs {
+		if vecs[i] == nil {
+			continue
+		}
+		if i < len(collector.vecs) && agreesInFloat32(collector.vecs[i], vecs[i]) {
+			highPrecision[i] = collector.vecs[i]
+			continue
+		}
+		highPrecision[i] = make([]float64, len(vecs[i]))
+		for j := range vecs[i] {
+			highPrecision[i][j] = float64(vecs[i][j])
+		}
+	}
+	return highPrecision, errs
+}
+
+// agreesInFloat32 returns whether the float64 vector is the float32 vector in a higher precision
+func agreesInFloat32(highPrecision []float64, vector []float32) bool {
+	if len(highPrecision) != len(vector) {
+		return false
+	}
+	for i := range vector {
+		if float32(highPrecision[i]) != vector[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestObjectBatchHighPrecision(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error broken"}},
+	}
+	skip := []bool{false, false, true, false}
+
+	agree := func(t *testing.T, highPrecision [][]float64, vecs [][]float32) {
+		require.Len(t, highPrecision, len(vecs))
+		for i := range vecs {
+			require.Len(t, highPrecision[i], len(vecs[i]))
+			for j := range vecs[i] {
+				assert.Equal(t, vecs[i][j], float32(highPrecision[i][j]))
+			}
+		}
+	}
+
+	client := &fakeBatchClient{echoVectors: true}
+	v := New(client, 40*time.Second, logger, WithHighPrecision())
+	vecs, errs := New(&fakeBatchClient{echoVectors: true}, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+	highPrecision, highPrecisionErrs := v.ObjectBatchHighPrecision(context.Background(), objects, skip, cfg)
+
+	require.Len(t, errs, 1)
+	assert.EqualError(t, highPrecisionErrs[3], errs[3].Error())
+	require.Nil(t, highPrecision[2])
+	require.Nil(t, highPrecision[3])
+	agree(t, highPrecision, vecs)
+	// the precision of the response is kept
+	assert.NotEqual(t, float64(vecs[0][0]), highPrecision[0][0])
+	assert.True(t, client.lastConfig.HighPrecision)
+
+	t.Run("regular batches don't ask for it", func(t *testing.T) {
+		_, errs := v.ObjectBatch(context.Background(), objects[:1], skip[:1], cfg)
+		require.Len(t, errs, 0)
+		assert.False(t, client.lastConfig.HighPrecision)
+	})
+
+	t.Run("float32 vectors are converted without the option", func(t *testing.T) {
+		client := &fakeBatchClient{echoVectors: true}
+		highPrecision, errs := New(client, 40*time.Second, logger).ObjectBatchHighPrecision(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 1)
+		agree(t, highPrecision, vecs)
+		assert.Equal(t, float64(vecs[0][0]), highPrecision[0][0])
+		assert.False(t, client.lastConfig.HighPrecision)
+	})
+}
@@ -0,0 +1,403 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/weaviate/tiktoken-go"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/weaviate/weaviate/entities/models"
+	objectsvectorizer "github.com/weaviate/weaviate/usecases/modulecomponents/vectorizer"
+)
+
+// assembleInput builds the text that is sent to OpenAI for a single object.
+//
+// Property values are lowercased and visited in sorted property-name order, or in schema order with propertyOrder
+// "schema". If the class name is vectorized it always comes first. If an object has nothing to vectorize the class name
+// is used as a fallback, which is all that vectorizeClassName "fallback" does.
+//
+// The propertyNameLayout setting controls where vectorized property names end up:
+//   - inline (default): every value is prefixed with its property name, e.g. "body y title x"
+//   - header: the property names are grouped in a single header block which is separated from the values by a
+//     newline, e.g. "body title\ny x"
+//
+// With an inputTemplate the class name, the property names and the values are woven into the input as the template
+// says (see InputTemplateClassName), which replaces vectorizeClassName and vectorizePropertyName.
+//
+// The separator of the layout in values is kept, escaped or replaced depending on the separatorHandling setting. With
+// normalizeInput the values are normalized afterwards, see normalizeText.
+//
+// If minPropertyTokens is set, properties whose values have fewer tokens (counted with countTokens) are left out.
+//
+// With propertyWeights the values of a property are repeated as often as its weight right where the property would
+// appear once, e.g. "title x title x body y" for a title weight of 2. Repeated values keep their property name prefix
+// in the inline layout, while the header lists every property name only once. Weights are applied after
+// minPropertyTokens, so they don't change which properties are left out.
+func assembleInput(object *models.Object, settings ClassSettings, countTokens func(string) int) string {
+	return joinInput(object, settings, assembleProperties(object, settings, countTokens))
+}
+
+// assemblePropertyInputs builds one input per vectorized property of a single object for the combineStrategy
+// average. Every input is assembled like the input of an object with only that property. Properties whose values
+// are all blank are left out, an object without any other property gets a single input like with assembleInput.
+func assemblePropertyInputs(object *models.Object, settings ClassSettings, countTokens func(string) int) []string {
+	properties := assembleProperties(object, settings, countTokens)
+	var inputs []string
+	for i := range properties {
+		if !properties[i].blank {
+			inputs = append(inputs, joinInput(object, settings, properties[i:i+1]))
+		}
+	}
+	if len(inputs) == 0 {
+		return []string{joinInput(object, settings, properties)}
+	}
+	return inputs
+}
+
+// propertyInput is the part of the input that a single property contributes. Its Name is only set if the property
+// name is vectorized in the header layout.
+type propertyInput struct {
+	objectsvectorizer.PropertyInput
+	// blank is set if all values are blank before the property name is added
+	blank bool
+}
+
+// assembleProperties returns the parts of the input of all vectorized properties of the object in order, see
+// assembleInput
+func assembleProperties(object *models.Object, settings ClassSettings, countTokens func(string) int) []propertyInput {
+	headerLayout := settings.PropertyNameLayout() == PropertyNameLayoutHeader
+	objectArrayPaths := settings.ObjectArrayPaths()
+	minPropertyTokens := settings.MinPropertyTokens()
+	weights := settings.PropertyWeights()
+	normalize := settings.NormalizeInput()
+	_, valueTemplate := splitInputTemplate(settings.InputTemplate())
+	// an inputTemplate replaces the layout and joins the values with spaces like the inline layout
+	separatorReplacer := newSeparatorReplacer(settings.SeparatorHandling(), headerLayout && valueTemplate == "")
+	var properties []propertyInput
+	if object.Properties != nil {
+		propMap := object.Properties.(map[string]interface{})
+		for _, propName := range orderedPropertyNames(propMap, settings) {
+			if !settings.PropertyIndexed(propName) {
+				continue
+			}
+
+			// properties that cannot be rendered are left out, see propertyErrors
+			values, err := propertyValues(propMap[propName], objectArrayPaths[propName], settings)
+			if err != nil || len(values) == 0 {
+				continue
+			}
+			if separatorReplacer != nil {
+				for i := range values {
+					values[i] = separatorReplacer.Replace(values[i])
+				}
+			}
+			if normalize {
+				for i := range values {
+					values[i] = normalizeText(values[i])
+				}
+			}
+			if countTokens != nil && countTokens(strings.Join(values, " ")) < minPropertyTokens {
+				continue
+			}
+
+			property := propertyInput{blank: strings.TrimSpace(strings.Join(values, "")) == ""}
+			if valueTemplate != "" {
+				replacer := strings.NewReplacer(InputTemplateClassName, objectsvectorizer.CamelCaseToLower(object.Class),
+					InputTemplatePropName, objectsvectorizer.CamelCaseToLower(propName))
+				rendered := replacer.Replace(valueTemplate)
+				for i := range values {
+					values[i] = strings.Replace(rendered, InputTemplatePropValue, values[i], 1)
+				}
+			} else if settings.VectorizePropertyName(propName) {
+				lowerPropertyName := objectsvectorizer.CamelCaseToLower(propName)
+				if headerLayout {
+					property.Name = lowerPropertyName
+				} else {
+					for i := range values {
+						values[i] = fmt.Sprintf("%s %s", lowerPropertyName, values[i])
+					}
+				}
+			}
+			for repeat := 0; repeat < max(weights[propName], 1); repeat++ {
+				property.Values = append(property.Values, values...)
+			}
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// propertyValues renders the value of a property into values of the input. Values that are left out by design have no
+// values, e.g. properties that are not part of the object, and numbers and booleans unless they are vectorized. Values
+// that are rendered but contain something else fail, e.g. a nested object in an array with vectorizeNonText or a
+// number at one of the objectArrayPaths.
+func propertyValues(value interface{}, paths [][]string, settings ClassSettings) ([]string, error) {
+	switch val := value.(type) {
+	case []string:
+		values := make([]string, len(val))
+		for i := range val {
+			values[i] = strings.ToLower(val[i])
+		}
+		return values, nil
+	case string:
+		return []string{strings.ToLower(val)}, nil
+	case []interface{}:
+		if paths != nil {
+			return objectArrayValues(val, paths, settings.ObjectArrayMode())
+		}
+	}
+	if settings.VectorizeNonText() {
+		return nonTextValues(value, settings)
+	}
+	return nil, nil
+}
+
+// propertyErrors returns an error for every vectorized property of the object whose value cannot be rendered, see
+// propertyValues. These properties are left out of the input, the rest of the object is vectorized.
+func propertyErrors(object *models.Object, settings ClassSettings) []error {
+	if object.Properties == nil {
+		return nil
+	}
+	propMap := object.Properties.(map[string]interface{})
+	objectArrayPaths := settings.ObjectArrayPaths()
+	var errs []error
+	for _, propName := range orderedPropertyNames(propMap, settings) {
+		if !settings.PropertyIndexed(propName) {
+			continue
+		}
+		if _, err := propertyValues(propMap[propName], objectArrayPaths[propName], settings); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrUnrenderableProperty, propName, err))
+		}
+	}
+	return errs
+}
+
+// joinInput joins the parts of the given properties and the class name into the input of the object
+func joinInput(object *models.Object, settings ClassSettings, properties []propertyInput) string {
+	if classTemplate, valueTemplate := splitInputTemplate(settings.InputTemplate()); valueTemplate != "" {
+		var corpi []string
+		for _, property := range properties {
+			corpi = append(corpi, property.Values...)
+		}
+		if len(corpi) == 0 {
+			return objectsvectorizer.CamelCaseToLower(object.Class)
+		}
+		return strings.ReplaceAll(classTemplate, InputTemplateClassName, objectsvectorizer.CamelCaseToLower(object.Class)) +
+			strings.Join(corpi, " ")
+	}
+
+	inputs := make([]objectsvectorizer.PropertyInput, len(properties))
+	for i := range properties {
+		inputs[i] = properties[i].PropertyInput
+	}
+	return objectsvectorizer.JoinInput(object.Class, settings.VectorizeClassName(), inputs)
+}
+
+// splitInputTemplate splits the inputTemplate into the part that is rendered once per object and the part that is
+// rendered once per property value, which starts at the first property placeholder
+func splitInputTemplate(template string) (string, string) {
+	start := strings.Index(template, InputTemplatePropValue)
+	if start < 0 {
+		return "", ""
+	}
+	if name := strings.Index(template, InputTemplatePropName); name >= 0 && name < start {
+		start = name
+	}
+	return template[:start], template[start:]
+}
+
+// orderedPropertyNames returns the names of the properties of an object in the configured order. With schema order,
+// properties that are not part of the schema come last in sorted order.
+func orderedPropertyNames(propMap map[string]interface{}, settings ClassSettings) []string {
+	if settings.PropertyOrder() != PropertyOrderSchema {
+		return objectsvectorizer.OrderedPropertyNames(propMap, nil)
+	}
+	return objectsvectorizer.OrderedPropertyNames(propMap, settings.SchemaPropertyNames())
+}
+
+// capInput enforces the maximum number of tokens of a single input, see maxInputFraction. Longer inputs are either
+// truncated to maxTokens or fail with ErrInputTooLong. A maxTokens of 0 disables the cap.
+func capInput(text string, maxTokens int, truncate bool, tke *tiktoken.Tiktoken) (string, error) {
+	if maxTokens <= 0 {
+		return text, nil
+	}
+	encoded := tke.Encode(text, nil, nil)
+	if len(encoded) <= maxTokens {
+		return text, nil
+	}
+	if !truncate {
+		return "", fmt.Errorf("%w: %d tokens, at most %d are allowed", ErrInputTooLong, len(encoded), maxTokens)
+	}
+	return tke.Decode(encoded[:maxTokens]), nil
+}
+
+// truncateTokens returns the text of the first maxTokens of the encoded input, or of the last maxTokens with tail
+func truncateTokens(encoded []int, maxTokens int, tail bool, tke *tiktoken.Tiktoken) string {
+	if len(encoded) <= maxTokens {
+		return tke.Decode(encoded)
+	}
+	if tail {
+		return tke.Decode(encoded[len(encoded)-maxTokens:])
+	}
+	return tke.Decode(encoded[:maxTokens])
+}
+
+// normalizeText applies the unicode normalization form NFC and collapses all runs of whitespace into single spaces,
+// so that texts which only differ in their encoding or spacing have the same input and tokens
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(text)), " ")
+}
+
+// newSeparatorReplacer returns the replacer of the separator of the layout in values, which is the newline in the
+// header layout and the space otherwise, see SeparatorHandlingEscape
+func newSeparatorReplacer(handling string, headerLayout bool) *strings.Replacer {
+	switch {
+	case handling == SeparatorHandlingEscape && headerLayout:
+		return strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`)
+	case handling == SeparatorHandlingEscape:
+		return strings.NewReplacer(`\`, `\\`, " ", `\s`)
+	case handling == SeparatorHandlingNormalize && headerLayout:
+		return strings.NewReplacer("\r\n", " ", "\n", " ")
+	case handling == SeparatorHandlingNormalize:
+		return strings.NewReplacer(" ", "_")
+	default:
+		return nil
+	}
+}
+
+// nonTextValues renders a number, a boolean or an array of them as values of the input, see NumberFormatDecimal.
+// Strings in arrays are lowercased like text values. Values and elements of other types fail, nil is left out.
+func nonTextValues(value interface{}, settings ClassSettings) ([]string, error) {
+	var elements []interface{}
+	switch val := value.(type) {
+	case []interface{}:
+		elements = val
+	case []float64:
+		elements = anySlice(val)
+	case []int64:
+		elements = anySlice(val)
+	case []int:
+		elements = anySlice(val)
+	case []bool:
+		elements = anySlice(val)
+	case nil:
+		return nil, nil
+	default:
+		if text, ok := formatNonText(val, settings.NumberFormat()); ok {
+			return []string{text}, nil
+		}
+		return nil, fmt.Errorf("unexpected value of type %T", val)
+	}
+
+	var values []string
+	for _, element := range elements {
+		text, ok := formatNonText(element, settings.NumberFormat())
+		if !ok && element != nil {
+			return nil, fmt.Errorf("unexpected element of type %T", element)
+		}
+		if text != "" {
+			values = append(values, text)
+		}
+	}
+	if settings.NonTextArrayMode() == ObjectArrayModeJoin && len(values) > 1 {
+		return []string{strings.Join(values, " ")}, nil
+	}
+	return values, nil
+}
+
+func formatNonText(value interface{}, numberFormat string) (string, bool) {
+	switch val := value.(type) {
+	case string:
+		return strings.ToLower(val), true
+	case bool:
+		return strconv.FormatBool(val), true
+	case int:
+		return strconv.Itoa(val), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case float32:
+		return formatNumber(float64(val), numberFormat), true
+	case float64:
+		return formatNumber(val, numberFormat), true
+	case json.Number:
+		if f, err := val.Float64(); err == nil {
+			return formatNumber(f, numberFormat), true
+		}
+		return "", false
+	default:
+		return "", false
+	}
+}
+
+func formatNumber(f float64, numberFormat string) string {
+	if numberFormat == NumberFormatInteger {
+		return strconv.FormatFloat(math.Round(f), 'f', 0, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func anySlice[T any](values []T) []interface{} {
+	elements := make([]interface{}, len(values))
+	for i := range values {
+		elements[i] = values[i]
+	}
+	return elements
+}
+
+// objectArrayValues extracts the text fields at the given paths from every object of an array of objects. The texts
+// are visited object by object and in path order within an object. Missing fields are left out, fields that are no
+// text and elements that are no objects fail.
+func objectArrayValues(objects []interface{}, paths [][]string, mode string) ([]string, error) {
+	var values []string
+	for i := range objects {
+		for _, path := range paths {
+			text, err := objectField(objects[i], path)
+			if err != nil {
+				return nil, err
+			}
+			if text != "" {
+				values = append(values, strings.ToLower(text))
+			}
+		}
+	}
+	if mode == ObjectArrayModeJoin && len(values) > 1 {
+		return []string{strings.Join(values, " ")}, nil
+	}
+	return values, nil
+}
+
+func objectField(object interface{}, path []string) (string, error) {
+	for _, field := range path {
+		if object == nil {
+			return "", nil
+		}
+		asMap, ok := object.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("unexpected %T instead of an object in %s", object, strings.Join(path, "."))
+		}
+		object = asMap[field]
+	}
+	switch text := object.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return text, nil
+	default:
+		return "", fmt.Errorf("unexpected %T instead of a text in %s", text, strings.Join(path, "."))
+	}
+}
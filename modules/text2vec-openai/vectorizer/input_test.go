@@ -0,0 +1,583 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/entities/schema"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+	"github.com/weaviate/weaviate/usecases/modules"
+)
+
+func TestAssembleInputPropertyNameLayout(t *testing.T) {
+	object := &models.Object{Class: "Article", Properties: map[string]interface{}{"title": "X", "body": "Y"}}
+
+	tests := []struct {
+		name               string
+		layout             string
+		vectorizeClassName bool
+		expected           string
+	}{
+		{name: "default layout is inline", layout: "", expected: "body y title x"},
+		{name: "inline", layout: PropertyNameLayoutInline, expected: "body y title x"},
+		{name: "header", layout: PropertyNameLayoutHeader, expected: "body title\ny x"},
+		{name: "inline with class name", layout: PropertyNameLayoutInline, vectorizeClassName: true, expected: "article body y title x"},
+		{name: "header with class name", layout: PropertyNameLayoutHeader, vectorizeClassName: true, expected: "article body title\ny x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classConfig := map[string]interface{}{"vectorizeClassName": tt.vectorizeClassName}
+			if tt.layout != "" {
+				classConfig["propertyNameLayout"] = tt.layout
+			}
+			cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: classConfig}
+
+			assert.Equal(t, tt.expected, assembleInput(object, NewClassSettings(cfg), nil))
+		})
+	}
+
+	t.Run("header without vectorized property names", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{
+			"vectorizeClassName": true, "propertyNameLayout": PropertyNameLayoutHeader,
+		}}
+
+		assert.Equal(t, "article y x", assembleInput(object, NewClassSettings(cfg), nil))
+		assert.Equal(t, "article", assembleInput(&models.Object{Class: "Article"}, NewClassSettings(cfg), nil))
+	})
+}
+
+func TestAssembleInputTemplate(t *testing.T) {
+	object := &models.Object{Class: "SportsCar", Properties: map[string]interface{}{
+		"brand": "BMW", "modelName": "Z4", "features": []string{"Fast", "Red"},
+	}}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: "{propValue}", expected: "bmw fast red z4"},
+		{template: "{className} {propName} {propValue}", expected: "sports car brand bmw features fast features red model name z4"},
+		{template: "{className}: {propName}={propValue};", expected: "sports car: brand=bmw; features=fast; features=red; model name=z4;"},
+		{template: "{propName}: {propValue} ({className})", expected: "brand: bmw (sports car) features: fast (sports car) features: red (sports car) model name: z4 (sports car)"},
+		{template: "Class {ClassName} with {PROPVALUE}", expected: "class sports car with bmw fast red z4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			// the template replaces both vectorizeClassName and vectorizePropertyName
+			cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+				"vectorizeClassName": false, "inputTemplate": tt.template,
+			}}
+
+			assert.Equal(t, tt.expected, assembleInput(object, NewClassSettings(cfg), nil))
+		})
+	}
+
+	t.Run("the default template matches the flags", func(t *testing.T) {
+		flags := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{"vectorizeClassName": true}}
+		template := &fakeClassConfig{classConfig: map[string]interface{}{"inputTemplate": "{className} {propName} {propValue}"}}
+
+		assert.Equal(t, assembleInput(object, NewClassSettings(flags), nil), assembleInput(object, NewClassSettings(template), nil))
+	})
+
+	t.Run("objects without values fall back to the class name", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"inputTemplate": "{className}: {propValue}"}}
+
+		assert.Equal(t, "sports car", assembleInput(&models.Object{Class: "SportsCar"}, NewClassSettings(cfg), nil))
+	})
+}
+
+func TestAssembleInputObjectArrays(t *testing.T) {
+	object := &models.Object{Class: "Product", Properties: map[string]interface{}{
+		"name": "Chair",
+		"reviews": []interface{}{
+			map[string]interface{}{"text": "Comfortable", "stars": 5, "author": map[string]interface{}{"name": "Ann"}},
+			map[string]interface{}{"text": "Too Small"},
+			map[string]interface{}{"stars": 1},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		paths    []interface{}
+		mode     string
+		expected string
+	}{
+		{name: "join by default", paths: []interface{}{"reviews[].text"}, expected: "name chair reviews comfortable too small"},
+		{name: "separate", paths: []interface{}{"reviews[].text"}, mode: ObjectArrayModeSeparate, expected: "name chair reviews comfortable reviews too small"},
+		{name: "multiple and nested fields", paths: []interface{}{"reviews[].text", "reviews[].author.name"}, expected: "name chair reviews comfortable ann too small"},
+		{name: "no path", expected: "name chair"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classConfig := map[string]interface{}{"vectorizeClassName": false}
+			if tt.paths != nil {
+				classConfig["objectArrayPaths"] = tt.paths
+			}
+			if tt.mode != "" {
+				classConfig["objectArrayMode"] = tt.mode
+			}
+			cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: classConfig}
+
+			assert.Equal(t, tt.expected, assembleInput(object, NewClassSettings(cfg), nil))
+		})
+	}
+}
+
+func TestAssembleInputMinPropertyTokens(t *testing.T) {
+	object := &models.Object{Class: "Product", Properties: map[string]interface{}{
+		"sku":         "A1",
+		"size":        "XL",
+		"description": "A comfortable wooden chair for the dining room",
+		"tags":        []string{"oak", "handmade", "sturdy"},
+	}}
+	classConfig := map[string]interface{}{"vectorizeClassName": false, "minPropertyTokens": 3}
+	settings := NewClassSettings(&fakeClassConfig{classConfig: classConfig})
+	tke, err := tokenEncoder(settings.Model())
+	require.NoError(t, err)
+
+	expected := "a comfortable wooden chair for the dining room oak handmade sturdy"
+	assert.Equal(t, expected, assembleInput(object, settings, propertyTokenCounter(settings, tke)))
+
+	t.Run("disabled by default", func(t *testing.T) {
+		settings := NewClassSettings(&fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}})
+		assert.Nil(t, propertyTokenCounter(settings, tke))
+		assert.Equal(t, "a comfortable wooden chair for the dining room xl a1 oak handmade sturdy",
+			assembleInput(object, settings, nil))
+	})
+
+	t.Run("single object and batches", func(t *testing.T) {
+		logger, _ := test.NewNullLogger()
+		cfg := &fakeClassConfig{classConfig: classConfig}
+
+		client := &fakeClient{}
+		_, _, err := New(client, 40*time.Second, logger).Object(context.Background(), object, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{expected}, client.lastInput)
+
+		batchClient := &fakeBatchClient{}
+		_, errs := New(batchClient, 40*time.Second, logger).ObjectBatch(context.Background(), []*models.Object{object}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, [][]string{{expected}}, batchClient.requests())
+	})
+}
+
+func TestAssembleInputSeparatorHandling(t *testing.T) {
+	object := &models.Object{Class: "Note", Properties: map[string]interface{}{
+		"title": "Shopping",
+		"body":  "Milk\nEggs\r\nC:\\Temp",
+	}}
+
+	tests := []struct {
+		handling string
+		expected string
+	}{
+		{handling: "", expected: "body title\nmilk\neggs\r\nc:\\temp shopping"},
+		{handling: SeparatorHandlingKeep, expected: "body title\nmilk\neggs\r\nc:\\temp shopping"},
+		{handling: SeparatorHandlingEscape, expected: `body title` + "\n" + `milk\neggs\nc:\\temp shopping`},
+		{handling: SeparatorHandlingNormalize, expected: "body title\nmilk eggs c:\\temp shopping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handling, func(t *testing.T) {
+			classConfig := map[string]interface{}{"vectorizeClassName": false, "propertyNameLayout": PropertyNameLayoutHeader}
+			if tt.handling != "" {
+				classConfig["separatorHandling"] = tt.handling
+			}
+			cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: classConfig}
+
+			input := assembleInput(object, NewClassSettings(cfg), nil)
+			assert.Equal(t, tt.expected, input)
+			if tt.handling == SeparatorHandlingEscape || tt.handling == SeparatorHandlingNormalize {
+				// the only newline left separates the header from the values
+				assert.Equal(t, 1, strings.Count(input, "\n"))
+			}
+		})
+	}
+}
+
+func TestAssembleInputSeparatorHandlingInline(t *testing.T) {
+	object := &models.Object{Class: "Note", Properties: map[string]interface{}{
+		"title": "Shopping",
+		"body":  "Milk and\nEggs C:\\Temp",
+	}}
+
+	tests := []struct {
+		handling string
+		expected string
+	}{
+		{handling: SeparatorHandlingKeep, expected: "milk and\neggs c:\\temp shopping"},
+		{handling: SeparatorHandlingEscape, expected: `milk\sand` + "\n" + `eggs\sc:\\temp shopping`},
+		{handling: SeparatorHandlingNormalize, expected: "milk_and\neggs_c:\\temp shopping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handling, func(t *testing.T) {
+			cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "separatorHandling": tt.handling}}
+
+			input := assembleInput(object, NewClassSettings(cfg), nil)
+			assert.Equal(t, tt.expected, input)
+			if tt.handling != SeparatorHandlingKeep {
+				// the only space left separates the values
+				assert.Equal(t, 1, strings.Count(input, " "))
+			}
+		})
+	}
+}
+
+func TestAssembleInputNormalization(t *testing.T) {
+	// the same text with a precomposed and a decomposed "é" and different spacing
+	composed := &models.Object{Class: "Note", Properties: map[string]interface{}{"title": "Caf\u00e9 au lait", "body": "na\u00efve"}}
+	decomposed := &models.Object{Class: "Note", Properties: map[string]interface{}{"title": "Cafe\u0301  au\tlait ", "body": "nai\u0308ve"}}
+
+	cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	assert.NotEqual(t, assembleInput(composed, NewClassSettings(cfg), nil), assembleInput(decomposed, NewClassSettings(cfg), nil))
+
+	cfg = &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{"vectorizeClassName": false, "normalizeInput": true}}
+	assert.Equal(t, "body na\u00efve title caf\u00e9 au lait", assembleInput(composed, NewClassSettings(cfg), nil))
+	assert.Equal(t, assembleInput(composed, NewClassSettings(cfg), nil), assembleInput(decomposed, NewClassSettings(cfg), nil))
+
+	t.Run("the header separator and section delimiters are kept", func(t *testing.T) {
+		object := &models.Object{Class: "Note", Properties: map[string]interface{}{"body": "first  part\n---\nsecond\tpart"}}
+		cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{
+			"vectorizeClassName": false, "normalizeInput": true, "propertyNameLayout": PropertyNameLayoutHeader,
+			"sectionDelimiter": "\n---\n",
+		}}
+
+		input := assembleInput(object, NewClassSettings(cfg), nil)
+		assert.Equal(t, "body\nfirst part --- second part", input)
+
+		sections := inputSections([]*models.Object{object}, []string{input}, []bool{false}, NewClassSettings(cfg), nil)
+		require.NotNil(t, sections)
+		assert.Equal(t, []string{"body\nfirst part", "second part"}, sections.texts)
+	})
+}
+
+func TestAssembleInputNonText(t *testing.T) {
+	object := &models.Object{Class: "Car", Properties: map[string]interface{}{
+		"year": 2024, "electric": true, "tags": []string{"Fast", "Red"}, "ratings": []interface{}{4.5, float64(3)},
+	}}
+
+	tests := []struct {
+		name        string
+		classConfig map[string]interface{}
+		expected    string
+	}{
+		{name: "left out by default", classConfig: map[string]interface{}{}, expected: "tags fast tags red"},
+		{
+			name:        "vectorized",
+			classConfig: map[string]interface{}{"vectorizeNonText": true},
+			expected:    "electric true ratings 4.5 3 tags fast tags red year 2024",
+		},
+		{
+			name:        "separate array values",
+			classConfig: map[string]interface{}{"vectorizeNonText": true, "nonTextArrayMode": ObjectArrayModeSeparate},
+			expected:    "electric true ratings 4.5 ratings 3 tags fast tags red year 2024",
+		},
+		{
+			name:        "integer numbers",
+			classConfig: map[string]interface{}{"vectorizeNonText": true, "numberFormat": NumberFormatInteger},
+			expected:    "electric true ratings 5 3 tags fast tags red year 2024",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.classConfig["vectorizeClassName"] = false
+			cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: tt.classConfig}
+			assert.Equal(t, tt.expected, assembleInput(object, NewClassSettings(cfg), nil))
+		})
+	}
+
+	t.Run("typed arrays and large integers", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "vectorizeNonText": true}}
+		object := &models.Object{Class: "Car", Properties: map[string]interface{}{
+			"a": []bool{true, false}, "b": []int64{1, 2}, "c": int64(9007199254740993), "d": json.Number("0.10"),
+		}}
+		assert.Equal(t, "true false 1 2 9007199254740993 0.1", assembleInput(object, NewClassSettings(cfg), nil))
+	})
+}
+
+func TestAssembleInputUnrenderableProperty(t *testing.T) {
+	object := &models.Object{Class: "Car", Properties: map[string]interface{}{
+		"brand":   "Fast",
+		"year":    2024,
+		"extras":  []interface{}{"Heated Seats", map[string]interface{}{"unexpected": "nested"}},
+		"reviews": []interface{}{map[string]interface{}{"text": "Great"}, map[string]interface{}{"text": 5}},
+		"model":   "X1",
+	}}
+	classConfig := func(strict bool) map[string]interface{} {
+		return map[string]interface{}{
+			"vectorizeClassName": false,
+			"vectorizeNonText":   true,
+			"objectArrayPaths":   []interface{}{"reviews[].text"},
+			"strictAssembly":     strict,
+		}
+	}
+
+	t.Run("left out by default", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(logrus.DebugLevel)
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: classConfig(false)}
+
+		vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{object}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		require.NotNil(t, vecs[0])
+		assert.Equal(t, [][]string{{"brand fast model x1 year 2024"}}, client.requests())
+
+		var warnings []error
+		for _, entry := range hook.AllEntries() {
+			if entry.Data["action"] == "text2vec_openai_assembly" {
+				warnings = append(warnings, entry.Data[logrus.ErrorKey].(error))
+			}
+		}
+		require.Len(t, warnings, 2)
+		assert.ErrorIs(t, warnings[0], ErrUnrenderableProperty)
+		assert.EqualError(t, warnings[0], "property cannot be rendered into the input: extras: "+
+			"unexpected element of type map[string]interface {}")
+		assert.EqualError(t, warnings[1], "property cannot be rendered into the input: reviews: "+
+			"unexpected int instead of a text in text")
+	})
+
+	t.Run("objects fail with strictAssembly", func(t *testing.T) {
+		logger, _ := test.NewNullLogger()
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: classConfig(true)}
+		valid := &models.Object{Class: "Car", Properties: map[string]interface{}{"brand": "Fast"}}
+
+		vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{object, valid}, []bool{false, false}, cfg)
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], ErrUnrenderableProperty)
+		assert.Nil(t, vecs[0])
+		assert.NotNil(t, vecs[1])
+		assert.Equal(t, [][]string{{"brand fast"}}, client.requests())
+
+		_, err := v.AssembleInput(object, cfg)
+		assert.ErrorIs(t, err, ErrUnrenderableProperty)
+	})
+}
+
+func TestAssembleInputClassNameFallback(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": VectorizeClassNameFallback}}
+	settings := NewClassSettings(cfg)
+	require.False(t, settings.VectorizeClassName())
+	require.True(t, settings.ClassNameFallback())
+
+	withContent := &models.Object{Class: "SuperCar", Properties: map[string]interface{}{"brand": "Fast", "year": 2024}}
+	withoutContent := &models.Object{Class: "SuperCar", Properties: map[string]interface{}{"year": 2024}}
+
+	assert.Equal(t, "fast", assembleInput(withContent, settings, nil))
+	assert.Equal(t, "super car", assembleInput(withoutContent, settings, nil))
+	assert.Equal(t, "super car", assembleInput(&models.Object{Class: "SuperCar"}, settings, nil))
+}
+
+func TestAssembleInputPropertyOrder(t *testing.T) {
+	newClass := func(order string) *models.Class {
+		return &models.Class{
+			Class: "Article",
+			ModuleConfig: map[string]interface{}{
+				"my-module": map[string]interface{}{"vectorizeClassName": false, "propertyOrder": order},
+			},
+			Properties: []*models.Property{
+				{Name: "title", DataType: []string{schema.DataTypeText.String()}},
+				{Name: "body", DataType: []string{schema.DataTypeText.String()}},
+			},
+		}
+	}
+	existing := &models.Object{Class: "Article", Properties: map[string]interface{}{"title": "X", "body": "Y"}}
+	added := &models.Object{Class: "Article", Properties: map[string]interface{}{"title": "X", "body": "Y", "abstract": "Z"}}
+
+	t.Run("schema order", func(t *testing.T) {
+		class := newClass(PropertyOrderSchema)
+		settings := NewClassSettings(modules.NewClassBasedModuleConfig(class, "my-module", "", ""))
+		require.NoError(t, settings.Validate(class))
+		before := assembleInput(existing, settings, nil)
+		assert.Equal(t, "x y", before)
+
+		class.Properties = append(class.Properties, &models.Property{Name: "abstract", DataType: []string{schema.DataTypeText.String()}})
+		settings = NewClassSettings(modules.NewClassBasedModuleConfig(class, "my-module", "", ""))
+		assert.Equal(t, before, assembleInput(existing, settings, nil))
+		assert.Equal(t, before+" z", assembleInput(added, settings, nil))
+	})
+
+	t.Run("alphabetical order", func(t *testing.T) {
+		class := newClass(PropertyOrderAlphabetical)
+		class.Properties = append(class.Properties, &models.Property{Name: "abstract", DataType: []string{schema.DataTypeText.String()}})
+		settings := NewClassSettings(modules.NewClassBasedModuleConfig(class, "my-module", "", ""))
+		assert.Equal(t, "y x", assembleInput(existing, settings, nil))
+		assert.Equal(t, "z y x", assembleInput(added, settings, nil))
+	})
+
+	t.Run("properties that are not part of the schema come last", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "propertyOrder": PropertyOrderSchema}}
+		assert.Equal(t, "z y x", assembleInput(added, NewClassSettings(cfg), nil))
+	})
+}
+
+func TestAssembleInputPropertyWeights(t *testing.T) {
+	object := &models.Object{Class: "Article", Properties: map[string]interface{}{"title": "X", "body": "Y", "tags": []string{"a", "b"}}}
+
+	tests := []struct {
+		name                  string
+		weights               map[string]interface{}
+		layout                string
+		vectorizePropertyName bool
+		expected              string
+	}{
+		{name: "no weights", expected: "y a b x"},
+		{name: "title weighted", weights: map[string]interface{}{"title": 3}, expected: "y a b x x x"},
+		{name: "arrays repeat as a whole", weights: map[string]interface{}{"tags": json.Number("2")}, expected: "y a b a b x"},
+		{name: "inline names are repeated", weights: map[string]interface{}{"title": 2}, vectorizePropertyName: true, expected: "body y tags a tags b title x title x"},
+		{name: "header names are not repeated", weights: map[string]interface{}{"title": 2}, layout: PropertyNameLayoutHeader, vectorizePropertyName: true, expected: "body tags title\ny a b x x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classConfig := map[string]interface{}{"vectorizeClassName": false}
+			if tt.weights != nil {
+				classConfig["propertyWeights"] = tt.weights
+			}
+			if tt.layout != "" {
+				classConfig["propertyNameLayout"] = tt.layout
+			}
+			cfg := &fakeClassConfig{vectorizePropertyName: tt.vectorizePropertyName, classConfig: classConfig}
+
+			assert.Equal(t, tt.expected, assembleInput(object, NewClassSettings(cfg), nil))
+		})
+	}
+}
+
+func TestAssembleInputDeterministic(t *testing.T) {
+	newObject := func() *models.Object {
+		props := map[string]interface{}{}
+		for _, name := range []string{"title", "body", "author", "summary", "tags", "category", "notes", "source"} {
+			props[name] = "Value of " + name
+		}
+		return &models.Object{Class: "Article", Properties: props}
+	}
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{}}
+
+	expected := assembleInput(newObject(), NewClassSettings(cfg), nil)
+	for i := 0; i < 20; i++ {
+		require.Equal(t, expected, assembleInput(newObject(), NewClassSettings(cfg), nil))
+	}
+
+	var requests [][]string
+	for i := 0; i < 2; i++ {
+		client := &fakeBatchClient{}
+		_, errs := New(client, 40*time.Second, logger).ObjectBatch(context.Background(), []*models.Object{newObject()}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		require.Len(t, client.requests(), 1)
+		requests = append(requests, client.requests()[0])
+	}
+	assert.Equal(t, []string{expected}, requests[0])
+	assert.Equal(t, requests[0], requests[1])
+}
+
+func TestVectorizerAssembleInput(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	v := New(&fakeBatchClient{}, 40*time.Second, logger)
+	object := &models.Object{Class: "SuperCar", Properties: map[string]interface{}{"model": "Z4", "brand": "BMW"}}
+
+	t.Run("with the class name", func(t *testing.T) {
+		cfg := &fakeClassConfig{vectorizePropertyName: true, classConfig: map[string]interface{}{"vectorizeClassName": true}}
+		input, err := v.AssembleInput(object, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, "super car brand bmw model z4", input)
+	})
+
+	t.Run("without the class name in schema order", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "propertyOrder": PropertyOrderSchema}}
+		input, err := v.AssembleInput(object, cfg)
+		require.NoError(t, err)
+		// without schema properties all properties are in sorted order
+		assert.Equal(t, "bmw z4", input)
+	})
+
+	t.Run("the input is the same as in a batch", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+		input, err := v.AssembleInput(object, cfg)
+		require.NoError(t, err)
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{object}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, [][]string{{input}}, client.requests())
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "vectorizeEmptyObjects": true}}
+		_, err := v.AssembleInput(&models.Object{Class: "SuperCar", Properties: map[string]interface{}{"model": " "}}, cfg)
+		require.ErrorIs(t, err, ErrEmptyInput)
+	})
+
+	t.Run("sections", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"sectionDelimiter": "---"}}
+		_, err := v.AssembleInput(object, cfg)
+		require.Error(t, err)
+	})
+
+	t.Run("nil object", func(t *testing.T) {
+		_, err := v.AssembleInput(nil, &fakeClassConfig{classConfig: map[string]interface{}{}})
+		require.ErrorIs(t, err, ErrNilObject)
+	})
+}
+
+func TestPreprocess(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "normalizeInput": true}}
+	object := &models.Object{Class: "Doc", Properties: map[string]interface{}{"text": "see  https://example.com\tfor   **details**"}}
+	var received []string
+	preprocess := func(text string) string {
+		received = append(received, text)
+		var words []string
+		for _, word := range strings.Fields(text) {
+			if !strings.HasPrefix(word, "https://") {
+				words = append(words, strings.Trim(word, "*"))
+			}
+		}
+		return strings.Join(words, " ")
+	}
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithPreprocess(preprocess))
+
+	results := v.ObjectBatchResults(context.Background(), []*models.Object{object}, []bool{false}, cfg)
+
+	require.NoError(t, results[0].Err)
+	// the hook gets the normalized input
+	assert.Equal(t, []string{"see https://example.com for **details**"}, received)
+	assert.Equal(t, [][]string{{"see for details"}}, client.requests())
+	tke, err := tokenEncoder("ada")
+	require.NoError(t, err)
+	assert.Equal(t, clients.GetTokensCount("ada", "see for details", tke), results[0].Tokens)
+
+	t.Run("inputs that are empty afterwards are skipped", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithPreprocess(preprocess))
+		onlyURL := &models.Object{Class: "Doc", Properties: map[string]interface{}{"text": "https://example.com"}}
+
+		vecs, errs := v.ObjectBatch(context.Background(), []*models.Object{onlyURL}, []bool{false}, cfg)
+
+		require.Len(t, errs, 0)
+		require.Nil(t, vecs[0])
+		require.Len(t, client.requests(), 0)
+	})
+}
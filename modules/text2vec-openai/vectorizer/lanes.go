@@ -0,0 +1,102 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"sync"
+
+	enterrors "github.com/weaviate/weaviate/entities/errors"
+	"github.com/weaviate/weaviate/entities/moduletools"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// batchLane is a batch worker with its own queues and rate limit state. Jobs of the same lane are processed one
+// after the other, jobs of different lanes concurrently.
+type batchLane struct {
+	jobQueueCh         chan batchJob
+	priorityJobQueueCh chan batchJob
+
+	// workerLock is held while a job is processed, so only one job at a time uses the rate limit state. This is
+	// usually the batch worker, but small batches can take the fast path and run on the calling go routine.
+	workerLock  sync.Mutex
+	workerState *batchWorkerState
+}
+
+func newBatchLane() *batchLane {
+	return &batchLane{
+		jobQueueCh:         make(chan batchJob, BatchChannelSize),
+		priorityJobQueueCh: make(chan batchJob, BatchChannelSize),
+		workerState:        &batchWorkerState{rateLimit: &ent.RateLimits{}, firstRequest: true},
+	}
+}
+
+// AccountKeyer is implemented by clients that can tell which account, and thereby which rate limits, a request
+// belongs to, see WithRateLimitLanes
+type AccountKeyer interface {
+	// AccountKey returns the same key for all requests that share rate limits
+	AccountKey(ctx context.Context, config ent.VectorizationConfig) string
+}
+
+// laneFor returns the lane that processes the job. Without WithRateLimitLanes, or if the client can't tell the
+// account of a request, all jobs share the same lane.
+func (v *Vectorizer) laneFor(job batchJob) *batchLane {
+	key, ok := v.laneKey(job.ctx, job.cfg)
+	if !ok {
+		return v.lane
+	}
+
+	v.lanesLock.Lock()
+	defer v.lanesLock.Unlock()
+	lane, ok := v.lanes[key]
+	if !ok {
+		lane = newBatchLane()
+		if v.lanes == nil {
+			v.lanes = make(map[string]*batchLane)
+		}
+		v.lanes[key] = lane
+		enterrors.GoWrapper(func() { v.batchWorker(lane) }, v.logger)
+	}
+	return lane
+}
+
+// existingLane returns the lane that processes jobs with the given context and config like laneFor, or nil if no job
+// of the account was processed yet
+func (v *Vectorizer) existingLane(ctx context.Context, cfg moduletools.ClassConfig) *batchLane {
+	key, ok := v.laneKey(ctx, cfg)
+	if !ok {
+		return v.lane
+	}
+
+	v.lanesLock.Lock()
+	defer v.lanesLock.Unlock()
+	return v.lanes[key]
+}
+
+// laneKey returns the account key of the lane for jobs with the given context and config, false if all jobs share the
+// same lane. The properties that propertyModels routes to other models and batches with the model of ContextWithModel
+// always get their own lane per model, as the rate limits of OpenAI apply per model.
+func (v *Vectorizer) laneKey(ctx context.Context, cfg moduletools.ClassConfig) (string, bool) {
+	var key string
+	keyer, ok := v.client.(AccountKeyer)
+	lanes := v.rateLimitLanes && ok
+	if lanes {
+		key = keyer.AccountKey(ctx, v.getVectorizationConfig(cfg))
+	}
+	if routed, ok := cfg.(propertyModelConfig); ok && routed.model != "" {
+		return key + "\x00" + routed.model, true
+	}
+	if model := overriddenModel(cfg); model != "" {
+		return key + "\x00" + model, true
+	}
+	return key, lanes
+}
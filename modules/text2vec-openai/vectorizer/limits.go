@@ -0,0 +1,210 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/weaviate/weaviate/entities/moduletools"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// ModelLimits are the per-minute quotas of a model, see WithModelLimits
+type ModelLimits struct {
+	TokensPerMinute   int
+	RequestsPerMinute int
+}
+
+// DefaultModelLimits are the quotas of the embedding models in the first usage tier of OpenAI, keyed by the model
+// setting of the class. Accounts in higher tiers have higher quotas, which the rate limit headers of the responses
+// reveal after the first request.
+var DefaultModelLimits = map[string]ModelLimits{
+	"ada":               {TokensPerMinute: 1_000_000, RequestsPerMinute: 3_000},
+	TextEmbedding3Small: {TokensPerMinute: 1_000_000, RequestsPerMinute: 3_000},
+	TextEmbedding3Large: {TokensPerMinute: 1_000_000, RequestsPerMinute: 3_000},
+}
+
+// fallbackModelLimits are used for models without known limits. They are low enough for every account that is
+// allowed to use embeddings at all.
+var fallbackModelLimits = ModelLimits{TokensPerMinute: 150_000, RequestsPerMinute: 500}
+
+// seedRateLimit returns the rate limits that the batch worker starts with for the given model before any response
+// reported the actual limits, and whether they are the known limits of the model instead of fallbackModelLimits
+func (v *Vectorizer) seedRateLimit(model string) (*ent.RateLimits, bool) {
+	limits, ok := v.modelLimits[model]
+	if !ok {
+		limits = fallbackModelLimits
+		if v.logger != nil {
+			v.unknownModelLimits.Do(func() {
+				v.logger.WithField("action", "text2vec_openai_model_limits").WithField("model", model).
+					Warnf("no rate limits known for the model, assuming %d tokens and %d requests per minute",
+						limits.TokensPerMinute, limits.RequestsPerMinute)
+			})
+		}
+	}
+	return &ent.RateLimits{
+		LimitTokens:       limits.TokensPerMinute,
+		RemainingTokens:   limits.TokensPerMinute,
+		ResetTokens:       60,
+		LimitRequests:     limits.RequestsPerMinute,
+		RemainingRequests: limits.RequestsPerMinute,
+		ResetRequests:     60,
+	}, ok
+}
+
+// updateRateLimit reconciles the known rate limits with the ones reported by the latest response, see
+// reconcileRateLimit. Responses without rate limit headers, as sent by some OpenAI compatible providers, keep the
+// limits that were seeded from the known limits of the model (see WithModelLimits), but not the fallback limits, which
+// would otherwise cap such providers for good.
+func (s *batchWorkerState) updateRateLimit(rateLimit *ent.RateLimits) {
+	if rateLimit == nil || (s.seeded && rateLimit.LimitTokens == 0 && rateLimit.RemainingTokens == 0) {
+		return
+	}
+	known := s.rateLimit
+	if s.fallbackSeeded {
+		// the first response replaces the guessed limits like the response of a first request
+		known, s.fallbackSeeded = nil, false
+	}
+	rateLimit = reconcileRateLimit(known, rateLimit)
+	s.rateLimit = rateLimit
+	s.reported, s.reportedAt = *rateLimit, time.Now()
+
+	reset := 0
+	if rateLimit.RemainingTokens < rateLimit.LimitTokens {
+		reset = rateLimit.ResetTokens
+	}
+	if rateLimit.RemainingRequests == 0 {
+		reset = max(reset, rateLimit.ResetRequests)
+	}
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.status = RateLimitStatus{
+		RemainingTokens:   rateLimit.RemainingTokens,
+		RemainingRequests: rateLimit.RemainingRequests,
+		NextAvailable:     time.Now().Add(time.Duration(reset) * time.Second),
+	}
+}
+
+// refill adds the tokens and requests that were regained since the latest response to the remaining ones. Every limit
+// refills linearly until it is back to its initial state after the reset interval that the response reported for it,
+// e.g. a token limit with 100 of 200 tokens remaining that resets in 10s regains 10 tokens per second. Providers whose
+// windows are shorter or longer than a minute are paced by their own reset intervals.
+func (s *batchWorkerState) refill(now time.Time) {
+	if s.rateLimit == nil || s.reportedAt.IsZero() {
+		return
+	}
+	elapsed := now.Sub(s.reportedAt)
+	s.rateLimit.RemainingTokens = max(s.rateLimit.RemainingTokens,
+		refilled(s.reported.RemainingTokens, s.reported.LimitTokens, s.reported.ResetTokens, elapsed))
+	s.rateLimit.RemainingRequests = max(s.rateLimit.RemainingRequests,
+		refilled(s.reported.RemainingRequests, s.reported.LimitRequests, s.reported.ResetRequests, elapsed))
+}
+
+// refilled returns the remaining value of a limit after elapsed, see refill
+func refilled(remaining, limit, resetSeconds int, elapsed time.Duration) int {
+	reset := time.Duration(resetSeconds) * time.Second
+	if reset <= 0 || remaining >= limit {
+		return remaining
+	}
+	if elapsed >= reset {
+		return limit
+	}
+	return remaining + int(float64(limit-remaining)*float64(elapsed)/float64(reset))
+}
+
+// refillWait returns how long it takes from now until the token limit has refilled to the given tokens, see refill.
+// Tokens above the limit are available once the limit is reset completely.
+func (s *batchWorkerState) refillWait(tokens int, now time.Time) time.Duration {
+	remaining, limit := s.reported.RemainingTokens, s.reported.LimitTokens
+	reset := time.Duration(s.reported.ResetTokens) * time.Second
+	if tokens <= remaining || remaining >= limit || reset <= 0 {
+		return 0
+	}
+	fraction := min(float64(tokens-remaining)/float64(limit-remaining), 1)
+	refilledAt := s.reportedAt.Add(time.Duration(float64(reset) * fraction))
+	return max(refilledAt.Sub(now), 0)
+}
+
+// reconcileRateLimit returns the rate limits after a response that reported the given limits. The remaining tokens and
+// requests of the response are authoritative and replace the estimates of the batch worker, e.g. the tokens that it
+// expects to have been refilled while it waited. Headers that are missing from the response, which the parsed limits
+// report as 0, keep the known values: the token or request limits if only their remaining values are reported, and
+// all token or request limits if none of their headers is sent.
+func reconcileRateLimit(known, reported *ent.RateLimits) *ent.RateLimits {
+	if known == nil {
+		return reported
+	}
+	reconciled := *reported
+	if reported.LimitTokens == 0 && reported.RemainingTokens == 0 {
+		reconciled.LimitTokens, reconciled.RemainingTokens = known.LimitTokens, known.RemainingTokens
+	} else if reported.LimitTokens == 0 {
+		reconciled.LimitTokens = max(known.LimitTokens, reported.RemainingTokens)
+	}
+	if reported.ResetTokens == 0 && reconciled.RemainingTokens < reconciled.LimitTokens {
+		reconciled.ResetTokens = known.ResetTokens
+	}
+	if reported.LimitRequests == 0 && reported.RemainingRequests == 0 {
+		reconciled.LimitRequests, reconciled.RemainingRequests = known.LimitRequests, known.RemainingRequests
+	} else if reported.LimitRequests == 0 {
+		reconciled.LimitRequests = max(known.LimitRequests, reported.RemainingRequests)
+	}
+	if reported.ResetRequests == 0 && reconciled.RemainingRequests < reconciled.LimitRequests {
+		reconciled.ResetRequests = known.ResetRequests
+	}
+	return &reconciled
+}
+
+// tokenBudget returns the tokens that a single request of the job can use according to ContextWithTokenBudget, 0 if
+// the job has no budget. Budgets above the known token limit are clamped to the limit.
+func (v *Vectorizer) tokenBudget(job batchJob, state *batchWorkerState) int {
+	budget := TokenBudgetFromContext(job.ctx)
+	if budget <= 0 {
+		return 0
+	}
+	if limit := state.rateLimit.LimitTokens; limit > 0 && budget > limit {
+		if v.logger != nil {
+			v.logger.WithField("action", "text2vec_openai_token_budget").
+				WithField("budget", budget).
+				WithField("limit", limit).
+				WithField("job_id", ent.JobIDFromContext(job.ctx)).
+				Warnf("token budget of the batch exceeds the token limit, using the limit of %d tokens instead", limit)
+		}
+		budget = limit
+	}
+	return budget
+}
+
+// RateLimitStatus is what the vectorizer knows about the rate limits of an account as of the latest response to a
+// batch request, see Vectorizer.RateLimitStatus
+type RateLimitStatus struct {
+	// RemainingTokens and RemainingRequests are the budgets that were left with the latest response
+	RemainingTokens   int
+	RemainingRequests int
+	// NextAvailable is when the token and request budgets are expected to be back to their limits. It is the zero time
+	// if no batch request was sent for the account yet.
+	NextAvailable time.Time
+}
+
+// RateLimitStatus returns the rate limit status of the account that batches of the class use with the given context
+// (see WithRateLimitLanes and ContextWithModel). Import coordinators can use it to pace their submissions, or to decide
+// how long to back off before retrying the objects of a batch that failed because the rate limits did not refresh in
+// time.
+func (v *Vectorizer) RateLimitStatus(ctx context.Context, cfg moduletools.ClassConfig) RateLimitStatus {
+	lane := v.existingLane(ctx, withModelOverride(ctx, cfg))
+	if lane == nil {
+		return RateLimitStatus{}
+	}
+	lane.workerState.statusLock.Lock()
+	defer lane.workerState.statusLock.Unlock()
+	return lane.workerState.status
+}
@@ -0,0 +1,105 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the prometheus metrics of the batch vectorizer, see WithMetrics
+type Metrics struct {
+	objectsPerRequest *prometheus.HistogramVec
+	tokensPerRequest  *prometheus.HistogramVec
+	batchDuration     *prometheus.HistogramVec
+	tokens            *prometheus.CounterVec
+	requests          *prometheus.CounterVec
+	rateLimitWaits    *prometheus.CounterVec
+}
+
+// NewMetrics registers the metrics of the batch vectorizer with reg. Metrics that are already registered are reused,
+// so several vectorizers can share the same registry. With a nil reg no metrics are recorded.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		return nil
+	}
+	return &Metrics{
+		objectsPerRequest: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "text2vec_openai_objects_per_request",
+			Help:    "Number of objects in a single request to the OpenAI embeddings API",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"model"})),
+		tokensPerRequest: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "text2vec_openai_tokens_per_request",
+			Help:    "Number of tokens in a single request to the OpenAI embeddings API",
+			Buckets: prometheus.ExponentialBuckets(16, 4, 10),
+		}, []string{"model"})),
+		batchDuration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "text2vec_openai_batch_duration_seconds",
+			Help:    "Duration of vectorizing a whole batch, including the time in the batch queue",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"model", "class"})),
+		tokens: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "text2vec_openai_tokens_total",
+			Help: "Number of tokens of successful requests to the OpenAI embeddings API, as reported by the API or estimated",
+		}, []string{"model", "class"})),
+		requests: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "text2vec_openai_requests_total",
+			Help: "Number of requests to the OpenAI embeddings API, including retries",
+		}, []string{"model", "class"})),
+		rateLimitWaits: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "text2vec_openai_rate_limit_waits_total",
+			Help: "Number of times a batch waited for the rate limit of the OpenAI embeddings API",
+		}, []string{"model", "class", "reason"})),
+	}
+}
+
+func register[T prometheus.Collector](reg prometheus.Registerer, collector T) T {
+	if err := reg.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		// metrics are best effort, an unregistered collector still works but is not exported
+	}
+	return collector
+}
+
+// observeRequest records the size of a single request (sub-batch) to the vectorizer
+func (m *Metrics) observeRequest(model string, objects, tokens int) {
+	m.objectsPerRequest.WithLabelValues(model).Observe(float64(objects))
+	m.tokensPerRequest.WithLabelValues(model).Observe(float64(tokens))
+}
+
+// observeBatch records the duration of a whole batch
+func (m *Metrics) observeBatch(model, class string, duration time.Duration) {
+	m.batchDuration.WithLabelValues(model, class).Observe(duration.Seconds())
+}
+
+// observeAttempt records a single attempt to send a request to the vectorizer
+func (m *Metrics) observeAttempt(model, class string) {
+	m.requests.WithLabelValues(model, class).Inc()
+}
+
+// observeTokens records the tokens of a successful request
+func (m *Metrics) observeTokens(model, class string, tokens int) {
+	m.tokens.WithLabelValues(model, class).Add(float64(tokens))
+}
+
+// observeWait records a wait for the rate limit
+func (m *Metrics) observeWait(model, class, reason string) {
+	m.rateLimitWaits.WithLabelValues(model, class, reason).Inc()
+}
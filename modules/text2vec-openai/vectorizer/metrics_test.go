@@ -0,0 +1,141 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/tiktoken-go"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+type metricSample struct {
+	count uint64
+	sum   float64
+	// labels of the sample by name
+	labels map[string]string
+}
+
+func TestBatchMetrics(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	texts := []string{
+		"tokens 25", // set limit so next 3 objects are one batch
+		"first object first batch",
+		"second object first batch",
+		"third object first batch",
+		"first object second batch", // rate is 100 again
+		"second object second batch",
+	}
+	objects := make([]*models.Object, len(texts))
+	for i := range texts {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+	}
+
+	reg := prometheus.NewRegistry()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger, WithMetrics(NewMetrics(reg)))
+
+	_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+	require.Len(t, errs, 0)
+
+	requests := client.requests()
+	require.Len(t, requests, 3)
+	tke, err := tiktoken.EncodingForModel(DefaultOpenAIModel)
+	require.NoError(t, err)
+	tokens := 0
+	for i := range texts {
+		tokens += clients.GetTokensCount(DefaultOpenAIModel, texts[i], tke)
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	samples := map[string]*metricSample{}
+	for _, family := range families {
+		require.Len(t, family.GetMetric(), 1)
+		metric := family.GetMetric()[0]
+		sample := &metricSample{labels: map[string]string{}}
+		for _, label := range metric.GetLabel() {
+			sample.labels[label.GetName()] = label.GetValue()
+		}
+		assert.Equal(t, DefaultOpenAIModel, sample.labels["model"])
+		if metric.GetHistogram() != nil {
+			sample.count = metric.GetHistogram().GetSampleCount()
+			sample.sum = metric.GetHistogram().GetSampleSum()
+		} else {
+			sample.count = 1
+			sample.sum = metric.GetCounter().GetValue()
+		}
+		samples[family.GetName()] = sample
+	}
+
+	require.Contains(t, samples, "text2vec_openai_objects_per_request")
+	assert.Equal(t, uint64(len(requests)), samples["text2vec_openai_objects_per_request"].count)
+	assert.Equal(t, float64(len(texts)), samples["text2vec_openai_objects_per_request"].sum)
+	require.Contains(t, samples, "text2vec_openai_tokens_per_request")
+	assert.Equal(t, uint64(len(requests)), samples["text2vec_openai_tokens_per_request"].count)
+	assert.Equal(t, float64(tokens), samples["text2vec_openai_tokens_per_request"].sum)
+
+	require.Contains(t, samples, "text2vec_openai_batch_duration_seconds")
+	assert.Equal(t, uint64(1), samples["text2vec_openai_batch_duration_seconds"].count)
+	assert.Equal(t, "Car", samples["text2vec_openai_batch_duration_seconds"].labels["class"])
+	require.Contains(t, samples, "text2vec_openai_requests_total")
+	assert.Equal(t, float64(len(requests)), samples["text2vec_openai_requests_total"].sum)
+	assert.Equal(t, "Car", samples["text2vec_openai_requests_total"].labels["class"])
+	// the fake client doesn't report tokens, so the estimated tokens are counted
+	require.Contains(t, samples, "text2vec_openai_tokens_total")
+	assert.Equal(t, float64(tokens), samples["text2vec_openai_tokens_total"].sum)
+	assert.NotContains(t, samples, "text2vec_openai_rate_limit_waits_total")
+
+	t.Run("rate limit waits", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		client := &fakeBatchClient{defaultResetRate: 1}
+		v := New(client, 40*time.Second, logger, WithMetrics(NewMetrics(reg)))
+
+		// the second object doesn't fit into the remaining 5 tokens and has to wait for the token limit
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": "tokens 5"}},
+			{Class: "Car", Properties: map[string]interface{}{"test": "long long long"}},
+		}, []bool{false, false}, cfg)
+		require.Len(t, errs, 0)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		var waits float64
+		for _, family := range families {
+			if family.GetName() == "text2vec_openai_rate_limit_waits_total" {
+				for _, metric := range family.GetMetric() {
+					waits += metric.GetCounter().GetValue()
+				}
+			}
+		}
+		assert.GreaterOrEqual(t, waits, float64(1))
+	})
+
+	t.Run("no metrics without registerer", func(t *testing.T) {
+		assert.Nil(t, NewMetrics(nil))
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithMetrics(NewMetrics(nil)))
+		_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+		require.Len(t, errs, 0)
+	})
+
+	t.Run("metrics can be registered twice", func(t *testing.T) {
+		assert.NotPanics(t, func() { NewMetrics(reg) })
+	})
+}
@@ -0,0 +1,76 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/weaviate/weaviate/entities/moduletools"
+)
+
+// modelOverrideConfig is the class config of a batch whose model is overridden with ContextWithModel
+type modelOverrideConfig struct {
+	moduletools.ClassConfig
+	model string
+}
+
+// Class returns the settings of the class with the model of the override, without the settings that only apply to the
+// model of the class like for propertyModelConfig
+func (c modelOverrideConfig) Class() map[string]interface{} {
+	class := make(map[string]interface{}, len(c.ClassConfig.Class()))
+	for name, value := range c.ClassConfig.Class() {
+		class[name] = value
+	}
+	class["model"] = c.model
+	delete(class, "modelVersion")
+	delete(class, "dimensions")
+	delete(class, "fallbackModels")
+	return class
+}
+
+// withModelOverride returns the config of batches with ctx, which is wrapped in a modelOverrideConfig if
+// ContextWithModel overrides the model of the class
+func withModelOverride(ctx context.Context, cfg moduletools.ClassConfig) moduletools.ClassConfig {
+	model := strings.ToLower(ModelFromContext(ctx))
+	if model == "" || model == NewClassSettings(cfg).Model() {
+		return cfg
+	}
+	return modelOverrideConfig{ClassConfig: cfg, model: model}
+}
+
+// checkModelOverride returns ErrUnknownModel if the config is overridden with a model that is not available. Batches
+// with such a model fail before they get a lane, which would otherwise be kept for every model name that is passed.
+func checkModelOverride(cfg moduletools.ClassConfig) error {
+	model := overriddenModel(cfg)
+	if model == "" {
+		return nil
+	}
+	availableModels := append(availableOpenAIModels, availableV3Models...)
+	if !validateOpenAISetting[string](model, availableModels) {
+		return fmt.Errorf("%w %q of the context, available model names are: %v", ErrUnknownModel, model, availableModels)
+	}
+	return nil
+}
+
+// overriddenModel returns the model that the config was overridden with, also if its properties are routed with
+// propertyModels, "" if the class model is used
+func overriddenModel(cfg moduletools.ClassConfig) string {
+	if routed, ok := cfg.(propertyModelConfig); ok {
+		cfg = routed.ClassConfig
+	}
+	if override, ok := cfg.(modelOverrideConfig); ok {
+		return override.model
+	}
+	return ""
+}
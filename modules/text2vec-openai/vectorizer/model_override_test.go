@@ -0,0 +1,89 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestContextWithModel(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{
+		"vectorizeClassName": false, "modelVersion": "002", "fallbackModels": []interface{}{TextEmbedding3Large},
+	}}
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "third"}},
+	}
+	skip := []bool{false, false, false}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	// every object has 4 tokens and at most 95% of the 10 tokens of the override model are used for a request
+	v := New(client, 40*time.Second, logger, WithModelLimits(map[string]ModelLimits{
+		DefaultOpenAIModel: {TokensPerMinute: 1000, RequestsPerMinute: 100},
+		"babbage":          {TokensPerMinute: 10, RequestsPerMinute: 100},
+	}))
+	ctx := ContextWithModel(context.Background(), "babbage")
+
+	_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+	require.Len(t, errs, 0)
+	assert.Equal(t, "babbage", client.lastConfig.Model)
+	// the model version of the class doesn't apply to the override model
+	assert.Equal(t, PickDefaultModelVersion("babbage", DefaultOpenAIDocumentType), client.lastConfig.ModelVersion)
+	requests := client.requests()
+	require.GreaterOrEqual(t, len(requests), 2)
+	assert.Equal(t, []string{"first", "second"}, requests[0])
+	for _, model := range client.requestModels {
+		assert.Equal(t, "babbage", model)
+	}
+	// the status of the override model is reported with its context
+	assert.NotEqual(t, v.RateLimitStatus(ctx, cfg), v.RateLimitStatus(context.Background(), cfg))
+
+	t.Run("the class model is used without the override", func(t *testing.T) {
+		_, errs := v.ObjectBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, DefaultOpenAIModel, client.lastConfig.Model)
+		assert.Equal(t, "002", client.lastConfig.ModelVersion)
+		// the class model has its own limits, which fit all objects into a single request
+		assert.Equal(t, []string{"first", "second", "third"}, client.requests()[len(requests)])
+		assert.Len(t, client.requests(), len(requests)+1)
+	})
+
+	t.Run("unknown models fail without a lane", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+		_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+		require.Len(t, errs, 0)
+		for i := 0; i < 10; i++ {
+			ctx := ContextWithModel(context.Background(), fmt.Sprintf("model-%d", i))
+			_, errs := v.ObjectBatch(ctx, objects, skip, cfg)
+			require.Len(t, errs, len(objects))
+			assert.ErrorIs(t, errs[0], ErrUnknownModel)
+			assert.ErrorIs(t, v.ValidateBatch(ctx, objects, skip, cfg)[0], ErrUnknownModel)
+		}
+		// known models share their lane however they are spelled
+		_, errs = v.ObjectBatch(ContextWithModel(context.Background(), "Babbage"), objects, skip, cfg)
+		require.Len(t, errs, 0)
+
+		v.lanesLock.Lock()
+		defer v.lanesLock.Unlock()
+		assert.Len(t, v.lanes, 1)
+	})
+}
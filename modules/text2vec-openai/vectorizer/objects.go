@@ -14,7 +14,10 @@ package vectorizer
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,18 +26,19 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaviate/tiktoken-go"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
 
 	"github.com/weaviate/weaviate/entities/models"
 	"github.com/weaviate/weaviate/entities/moduletools"
 	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
-	objectsvectorizer "github.com/weaviate/weaviate/usecases/modulecomponents/vectorizer"
 	libvectorizer "github.com/weaviate/weaviate/usecases/vectorizer"
 )
 
 const (
-	MaxObjectsPerBatch = 2000 // https://platform.openai.com/docs/api-reference/embeddings/create
+	// MaxObjectsPerBatch is the default maximum number of inputs of a single request, see WithMaxObjectsPerRequest
+	MaxObjectsPerBatch = 2048 // https://platform.openai.com/docs/api-reference/embeddings/create
 	BatchChannelSize   = 100
 	// time per token goes down up to a certain batch size and then flattens - however the times vary a lot so we
 	// don't want to get too close to the maximum of 50s
@@ -51,24 +55,117 @@ type batchJob struct {
 	vecs       [][]float32
 	skipObject []bool
 	startTime  time.Time
+	objects    []*models.Object
+	// maxBatchTime depends on the kind of the call, see WithQueryBatchTime
+	maxBatchTime time.Duration
+	// highPriority jobs are received before normal jobs and can preempt them if enabled with WithPreemption
+	highPriority bool
+	// assembly is set if the inputs are still being assembled while the job is processed, see WithAssemblyPrefetch
+	assembly *assembly
+	// models holds the model that produced each vector of vecs, see fallbackModels
+	models []string
+	// reportedModels holds the model that OpenAI reported for each vector of vecs, only with WithModelCacheInvalidation
+	reportedModels []string
+	// stream is set if the results of the objects are sent as soon as their request is done, see ObjectBatchStream
+	stream *batchStream
+	// subBatch jobs are sent in a single request, see ObjectSubBatch
+	subBatch bool
+	// vecs64 holds the vectors in float64 if they are requested, see ObjectBatchHighPrecision
+	vecs64 [][]float64
+	// claimed is set by whoever takes the job first: the worker that processes it, or the caller that gives it up
+	// because its context ended while it was queued, see dispatch
+	claimed *atomic.Bool
+}
+
+// claim returns whether the job is taken by the caller, false if it was already taken. Jobs without a claim are
+// always processed.
+func (j batchJob) claim() bool {
+	return j.claimed == nil || j.claimed.CompareAndSwap(false, true)
 }
 
 type Vectorizer struct {
-	client           Client
-	objectVectorizer *objectsvectorizer.ObjectVectorizer
-	jobQueueCh       chan batchJob
-	maxBatchTime     time.Duration
+	client            Client
+	maxBatchTime      time.Duration
+	queryBatchTime    time.Duration
+	maxInputAge       time.Duration
+	overloadRetries   RetryConfig
+	dnsRetries        RetryConfig
+	rateLimitRetries  RetryConfig
+	smallBatchSize    int
+	latestVersion     LatestVersionFunc
+	cache             *vectorCache
+	dedupWindow       *vectorCache
+	externalCache     ExternalCache
+	dimensionMismatch DimensionMismatch
+	eventSink         EventSink
+	onBatchComplete   func(BatchStats)
+	eventBufferSize   int
+	events            *eventEmitter
+	metrics           *Metrics
+	tenantUsage       *TenantUsage
+	batchRetryBackoff time.Duration
+	maxInFlightTokens int64
+	inFlightTokens    *semaphore.Weighted
+	pacingThreshold   float64
+	rateLimitJitter   float64
+	// disableRateLimit sends the objects of a job without any rate limit accounting, see WithoutRateLimit
+	disableRateLimit bool
+	// minRequestInterval is the minimum time between the starts of two requests of the same job
+	minRequestInterval time.Duration
+	waitLogRate        int
+	waitLog            *waitLogger
+	logger             logrus.FieldLogger
+	// missingUsage makes sure that responses without reported tokens are only logged once
+	missingUsage         sync.Once
+	modelLimits          map[string]ModelLimits
+	maxObjectsPerRequest int
+	maxBatchDuration     time.Duration
+	tokenCounter         TokenCounter
+	deadlineGrace        time.Duration
+	// requestTimeout limits every single request to the vectorizer, see WithRequestTimeout
+	requestTimeout        time.Duration
+	requestTimeoutRetries RetryConfig
+	breaker               *circuitBreaker
+	usage                 usageCounters
+	// unknownModelLimits makes sure that models without known limits are only logged once
+	unknownModelLimits sync.Once
+
+	// malformedResponseRetries retry requests whose response is not valid JSON, see WithMalformedResponseRetries
+	malformedResponseRetries RetryConfig
+	// preprocess is applied to every input before it is tokenized, see WithPreprocess
+	preprocess func(string) string
+
+	// lane is used by all jobs unless WithRateLimitLanes is enabled, then lanes holds one lane per account
+	lane           *batchLane
+	rateLimitLanes bool
+	lanesLock      sync.Mutex
+	lanes          map[string]*batchLane
+
+	allOrNothingSubBatches bool
+	vectorFingerprints     bool
+	preemption             bool
+	modelCacheInvalidation bool
+	assemblyPrefetch       bool
+	highPrecision          bool
 }
 
-func New(client Client, maxBatchTime time.Duration, logger logrus.FieldLogger) *Vectorizer {
+func New(client Client, maxBatchTime time.Duration, logger logrus.FieldLogger, opts ...Option) *Vectorizer {
 	vec := &Vectorizer{
-		client:           client,
-		objectVectorizer: objectsvectorizer.New(),
-		jobQueueCh:       make(chan batchJob, BatchChannelSize),
-		maxBatchTime:     maxBatchTime,
+		client:               client,
+		maxBatchTime:         maxBatchTime,
+		maxObjectsPerRequest: MaxObjectsPerBatch,
+		logger:               logger,
+		lane:                 newBatchLane(),
+	}
+	for _, opt := range opts {
+		opt(vec)
+	}
+	vec.waitLog = newWaitLogger(logger, vec.waitLogRate)
+	if vec.eventSink != nil {
+		vec.events = newEventEmitter(vec.eventSink, vec.eventBufferSize, logger)
 	}
 
-	enterrors.GoWrapper(func() { vec.batchWorker() }, logger)
+	enterrors.GoWrapper(func() { vec.batchWorker(vec.lane) }, logger)
 	return vec
 }
 
@@ -84,13 +181,45 @@ type ClassSettings interface {
 	PropertyIndexed(property string) bool
 	VectorizePropertyName(propertyName string) bool
 	VectorizeClassName() bool
+	ClassNameFallback() bool
+	SectionDelimiter() string
+	CombineStrategy() string
+	PoolingWeight() string
+	PropertyOrder() string
+	InputTokenCap() int
+	ContextWindow() int
+	InputTruncation() string
+	TruncateInput() string
+	VectorizeEmptyObjects() bool
+	DedupeInputs() bool
+	SchemaPropertyNames() []string
 	Model() string
 	Type() string
 	ModelVersion() string
 	ResourceName() string
 	DeploymentID() string
 	BaseURL() string
+	Organization() string
+	Project() string
 	IsAzure() bool
+	APIVersion() string
+	EndpointPath() string
+	EncodingFormat() string
+	PropertyNameLayout() string
+	ObjectArrayPaths() map[string][][]string
+	ObjectArrayMode() string
+	MinPropertyTokens() int
+	SeparatorHandling() string
+	PropertyWeights() map[string]int
+	PropertyModels() map[string]string
+	FallbackModels() []string
+	CompressRequests() bool
+	NormalizeInput() bool
+	VectorizeNonText() bool
+	StrictAssembly() bool
+	NumberFormat() string
+	NonTextArrayMode() string
+	InputTemplate() string
 }
 
 func (v *Vectorizer) Object(ctx context.Context, object *models.Object, cfg moduletools.ClassConfig,
@@ -101,8 +230,35 @@ func (v *Vectorizer) Object(ctx context.Context, object *models.Object, cfg modu
 
 func (v *Vectorizer) object(ctx context.Context, object *models.Object, cfg moduletools.ClassConfig,
 ) ([]float32, error) {
-	text := v.objectVectorizer.Texts(ctx, object, NewClassSettings(cfg))
-	res, _, err := v.client.Vectorize(ctx, []string{text}, v.getVectorizationConfig(cfg))
+	settings := NewClassSettings(cfg)
+	if err := settings.validateDimensions(); err != nil {
+		return nil, err
+	}
+	conf := v.getVectorizationConfig(cfg)
+	var tke *tiktoken.Tiktoken
+	if settings.MinPropertyTokens() > 0 || v.inFlightTokens != nil {
+		var err error
+		if tke, err = tokenEncoder(conf.Model); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.checkAssembly(object, settings); err != nil {
+		return nil, err
+	}
+	text := assembleInput(object, settings, propertyTokenCounter(settings, tke))
+
+	if v.inFlightTokens != nil {
+		release, err := v.acquireTokens(ctx, v.countTokens(text, conf.Model, tke))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	res, _, conf, err := withFallbackModels(conf, settings.FallbackModels(),
+		func(conf ent.VectorizationConfig) (*ent.VectorizationResult, *ent.RateLimits, error) {
+			return v.client.Vectorize(ctx, []string{text}, conf)
+		})
 	if err != nil {
 		return nil, err
 	}
@@ -110,175 +266,1070 @@ func (v *Vectorizer) object(ctx context.Context, object *models.Object, cfg modu
 	if len(res.Vector) > 1 {
 		return libvectorizer.CombineVectors(res.Vector), nil
 	}
-	return res.Vector[0], nil
+	return v.checkDimensions(res.Vector[0], conf)
+}
+
+// checkDimensions makes sure that the vector has the requested dimensions, see WithDimensionMismatch
+func (v *Vectorizer) checkDimensions(vector []float32, conf ent.VectorizationConfig) ([]float32, error) {
+	if conf.Dimensions == nil || len(vector) == int(*conf.Dimensions) {
+		return vector, nil
+	}
+
+	dimensions := int(*conf.Dimensions)
+	if len(vector) < dimensions || v.dimensionMismatch != DimensionMismatchTruncate {
+		return nil, fmt.Errorf("%w: requested %d dimensions, got %d", ErrDimensionMismatch, dimensions, len(vector))
+	}
+
+	truncated := vector[:dimensions]
+	norm := float64(0)
+	for _, f := range truncated {
+		norm += float64(f) * float64(f)
+	}
+	if norm == 0 {
+		return truncated, nil
+	}
+	norm = math.Sqrt(norm)
+	for i := range truncated {
+		truncated[i] = float32(float64(truncated[i]) / norm)
+	}
+	return truncated, nil
+}
+
+// checkMixedDimensions fails the objects whose vector doesn't have the given dimensions. Without dimensions the
+// dimensions of most vectors of the batch are expected, ties go to the dimensions of the first vector. Vectors of
+// different dimensions can't be in the same index.
+func checkMixedDimensions(vecs [][]float32, errs map[int]error, common int) {
+	if common == 0 {
+		counts := make(map[int]int)
+		for i := range vecs {
+			if vecs[i] != nil && errs[i] == nil {
+				counts[len(vecs[i])]++
+			}
+		}
+		if len(counts) < 2 {
+			return
+		}
+		for i := range vecs {
+			if vecs[i] != nil && errs[i] == nil && (common == 0 || counts[len(vecs[i])] > counts[common]) {
+				common = len(vecs[i])
+			}
+		}
+	}
+	for i := range vecs {
+		if vecs[i] != nil && errs[i] == nil && len(vecs[i]) != common {
+			errs[i] = mixedDimensionsError(len(vecs[i]), common)
+			vecs[i] = nil
+		}
+	}
+}
+
+func mixedDimensionsError(dimensions, expected int) error {
+	return fmt.Errorf("%w: got %d dimensions, expected %d", ErrMixedDimensions, dimensions, expected)
 }
 
 func (v *Vectorizer) getVectorizationConfig(cfg moduletools.ClassConfig) ent.VectorizationConfig {
 	settings := NewClassSettings(cfg)
+	// floats are requested without an encoding_format, which not every OpenAI compatible server knows
+	var encodingFormat string
+	if settings.EncodingFormat() != EncodingFormatFloat {
+		encodingFormat = settings.EncodingFormat()
+	}
 	return ent.VectorizationConfig{
-		Type:         settings.Type(),
-		Model:        settings.Model(),
-		ModelVersion: settings.ModelVersion(),
-		ResourceName: settings.ResourceName(),
-		DeploymentID: settings.DeploymentID(),
-		BaseURL:      settings.BaseURL(),
-		IsAzure:      settings.IsAzure(),
-		Dimensions:   settings.Dimensions(),
+		Type:             settings.Type(),
+		Model:            settings.Model(),
+		ModelVersion:     settings.ModelVersion(),
+		ResourceName:     settings.ResourceName(),
+		DeploymentID:     settings.DeploymentID(),
+		BaseURL:          settings.BaseURL(),
+		IsAzure:          settings.IsAzure(),
+		APIVersion:       settings.APIVersion(),
+		EndpointPath:     settings.EndpointPath(),
+		Dimensions:       settings.Dimensions(),
+		EncodingFormat:   encodingFormat,
+		Organization:     settings.Organization(),
+		Project:          settings.Project(),
+		CompressRequests: settings.CompressRequests(),
 	}
 }
 
+// batchWorkerState is what the batch worker knows about the rate limits of the vectorizer. It is carried over from
+// one job to the next.
+type batchWorkerState struct {
+	rateLimit *ent.RateLimits
+	// reported are the rate limits as of reportedAt, the time of the latest response or the seeding, which the
+	// remaining tokens and requests refill from, see refill
+	reported     ent.RateLimits
+	reportedAt   time.Time
+	firstRequest bool
+	// seeded is set if the rate limits were seeded from the known limits of the model instead of a first request, see
+	// seedRateLimit
+	seeded bool
+	// fallbackSeeded is set until the first response if the rate limits were seeded from fallbackModelLimits
+	fallbackSeeded bool
+	timePerToken   float64
+
+	// status is updated with every response and read by RateLimitStatus while jobs are processed
+	statusLock sync.Mutex
+	status     RateLimitStatus
+}
+
 // batchWorker is a go routine that handles the communication with the vectorizer
 //
 // On the high level it has the following steps:
-//  1. It receives a batch job
+//  1. It receives a batch job. Jobs in the priority queue are always received before normal jobs.
 //  2. It splits the job into smaller vectorizer-batches if the token limit is reached. Note that objects from different
 //     batches are not mixed with each other to simplify returning the vectors.
 //  3. It sends the smaller batches to the vectorizer
-func (v *Vectorizer) batchWorker() {
-	rateLimit := &ent.RateLimits{}
+func (v *Vectorizer) batchWorker(lane *batchLane) {
+	for {
+		var job batchJob
+		select {
+		case job = <-lane.priorityJobQueueCh:
+		default:
+			select {
+			case job = <-lane.priorityJobQueueCh:
+			case job = <-lane.jobQueueCh:
+			}
+		}
+		lane.workerLock.Lock()
+		v.processJob(job, lane)
+		lane.workerLock.Unlock()
+	}
+}
+
+// dispatch hands the job to the batch worker and waits until it is done. Small jobs are processed directly on the
+// calling go routine if enabled with WithSmallBatchFastPath, nothing is queued and the worker is idle.
+func (v *Vectorizer) dispatch(job batchJob, objectCount int) {
+	lane := v.laneFor(job)
+	if objectCount <= v.smallBatchSize && len(lane.jobQueueCh) == 0 && len(lane.priorityJobQueueCh) == 0 &&
+		lane.workerLock.TryLock() {
+		v.processJob(job, lane)
+		lane.workerLock.Unlock()
+		return
+	}
+
+	// a job that is still queued when its context ends fails right away instead of waiting for the jobs before it, so
+	// callers that are gone, e.g. consumers of ObjectBatchStream, don't keep their go routines around. The worker
+	// skips the job once it reaches it.
+	if job.claimed != nil {
+		stop := context.AfterFunc(job.ctx, func() {
+			if job.claim() {
+				failFrom(job, 0, contextError(job.ctx))
+				job.wg.Done()
+			}
+		})
+		defer stop()
+	}
+	queue := lane.jobQueueCh
+	if job.highPriority {
+		queue = lane.priorityJobQueueCh
+	}
+	select {
+	case queue <- job:
+	case <-job.ctx.Done():
+	}
+	job.wg.Wait()
+}
+
+// preempt processes all queued high priority jobs. It is only called between two vectorizer-batches of a normal
+// priority job, so a request that is in flight is never interrupted.
+func (v *Vectorizer) preempt(lane *batchLane) {
+	for {
+		select {
+		case job := <-lane.priorityJobQueueCh:
+			v.processJob(job, lane)
+		default:
+			return
+		}
+	}
+}
+
+func (v *Vectorizer) processJob(job batchJob, lane *batchLane) {
+	if !job.claim() {
+		// the caller gave up the job while it was queued, see dispatch
+		return
+	}
+	defer job.wg.Done()
+	state := lane.workerState
+
+	// the total batch should not take longer than 60s to avoid timeouts. We will only use 40s here to be safe
+
+	// objects that waited too long in the queue might already be superseded by newer versions
+	if v.maxInputAge > 0 && time.Since(job.startTime) > v.maxInputAge {
+		for j := range job.texts {
+			if !job.skipObject[j] {
+				job.errs[j] = ErrStale
+			}
+		}
+		return
+	}
+
+	if v.latestVersion != nil {
+		job.skipObject = v.skipSuperseded(job)
+	}
+
+	objCounter := 0
+	tokensInCurrentBatch := 0
 	texts := make([]string, 0, 100)
 	origIndex := make([]int, 0, 100)
-	firstRequest := true
-	timePerToken := 0.0
-	batchTookInS := float64(0)
-
-	for job := range v.jobQueueCh {
-		// the total batch should not take longer than 60s to avoid timeouts. We will only use 40s here to be safe
 
-		objCounter := 0
-		tokensInCurrentBatch := 0
-		texts = texts[:0]
-		origIndex = origIndex[:0]
+	conf := v.getVectorizationConfig(job.cfg)
+	if v.disableRateLimit && !job.subBatch {
+		v.processJobWithoutRateLimit(job, lane, conf)
+		return
+	}
+	// lastRequest is when the previous request of the job was sent, see WithMinRequestInterval
+	var lastRequest time.Time
 
-		conf := v.getVectorizationConfig(job.cfg)
+	if state.firstRequest && v.modelLimits != nil {
+		state.rateLimit, state.seeded = v.seedRateLimit(conf.Model)
+		state.fallbackSeeded = !state.seeded
+		state.reported, state.reportedAt = *state.rateLimit, time.Now()
+		state.firstRequest = false
+	}
+	// the limits refilled while the worker waited for this job
+	state.refill(time.Now())
+	if job.subBatch {
+		v.processSubBatch(job, lane, conf)
+		return
+	}
 
-		// we don't know the current rate limits without a request => send a small one
-		for objCounter < len(job.texts) && firstRequest {
-			var err error
-			if !job.skipObject[objCounter] {
-				rateLimit, err = v.makeRequest(job, job.texts[objCounter:objCounter+1], conf, []int{objCounter})
-				if err != nil {
+	// we don't know the current rate limits without a request => send a small one
+	for objCounter < len(job.texts) && state.firstRequest {
+		var err error
+		if !job.skipObject[objCounter] {
+			if err = job.assembly.wait(objCounter); err != nil {
+				if err != errSkippedInput {
 					job.errs[objCounter] = err
-					continue
 				}
-				firstRequest = false
+				objCounter++
+				continue
 			}
-			objCounter++
+			var rateLimit *ent.RateLimits
+			if !v.awaitRequestInterval(job, lastRequest) {
+				failFrom(job, objCounter, errRequestIntervalTimeout)
+				return
+			}
+			lastRequest = time.Now()
+			rateLimit, err = v.makeRequest(job, job.texts[objCounter:objCounter+1], conf, []int{objCounter})
+			if isTerminal(err) {
+				failFrom(job, objCounter, err)
+				return
+			}
+			if err != nil {
+				objCounter++
+				continue
+			}
+			state.updateRateLimit(rateLimit)
+			state.firstRequest = false
 		}
+		objCounter++
+	}
 
-		for objCounter < len(job.texts) {
-			if job.ctx.Err() != nil {
-				for j := objCounter; j < len(job.texts); j++ {
-					if !job.skipObject[j] {
-						job.errs[j] = fmt.Errorf("context deadline exceeded or cancelled")
-					}
+	budget := v.tokenBudget(job, state)
+	for objCounter < len(job.texts) {
+		if job.ctx.Err() != nil {
+			for j := objCounter; j < len(job.texts); j++ {
+				if !job.skipObject[j] {
+					job.errs[j] = contextError(job.ctx)
 				}
-				break
 			}
+			break
+		}
 
-			if job.skipObject[objCounter] {
-				objCounter++
-				continue
+		if job.skipObject[objCounter] {
+			objCounter++
+			continue
+		}
+
+		if err := job.assembly.wait(objCounter); err != nil {
+			if err != errSkippedInput {
+				job.errs[objCounter] = err
 			}
+			objCounter++
+			continue
+		}
+		if job.tokens[objCounter] > state.rateLimit.LimitTokens {
+			job.errs[objCounter] = &TextTooLongError{Tokens: job.tokens[objCounter], Limit: state.rateLimit.LimitTokens}
+			objCounter++
+			continue
+		}
 
-			if job.tokens[objCounter] > rateLimit.LimitTokens {
-				job.errs[objCounter] = fmt.Errorf("text too long for vectorization")
-				objCounter++
+		// add objects to the current vectorizer-batch until the remaining tokens are used up or other limits are reached
+		text := job.texts[objCounter]
+		limit := v.splitLimit(state, budget, tokensInCurrentBatch, job.tokens[objCounter], len(texts))
+		if limit == "" {
+			tokensInCurrentBatch += job.tokens[objCounter]
+			texts = append(texts, text)
+			origIndex = append(origIndex, objCounter)
+			objCounter++
+			if objCounter < len(job.texts) {
 				continue
 			}
+			limit = splitLimitEnd
+		}
 
-			// add objects to the current vectorizer-batch until the remaining tokens are used up or other limits are reached
-			text := job.texts[objCounter]
-			if float32(tokensInCurrentBatch+job.tokens[objCounter]) < 0.95*float32(rateLimit.RemainingTokens) && (timePerToken*float64(tokensInCurrentBatch) < OpenAiMaxTimePerBatch) && len(texts) < MaxObjectsPerBatch {
-				tokensInCurrentBatch += job.tokens[objCounter]
-				texts = append(texts, text)
-				origIndex = append(origIndex, objCounter)
-				objCounter++
-				if objCounter < len(job.texts) {
-					continue
+		// if a single object is larger than the current token limit we need to wait until the token limit refreshes
+		// enough to be able to handle the object, which is known from the reset interval of the latest response (see
+		// refill). This assumes that the tokenLimit refreshes linearly which is true for openAI, but needs to be
+		// checked for other providers
+		if len(texts) == 0 && state.rateLimit.ResetTokens > 0 {
+			// the object fits once the remaining tokens are above it with the margin of splitLimit
+			required := int(float32(job.tokens[objCounter])/0.95) + 1
+			sleepTime := state.refillWait(required, time.Now())
+			v.logSplit(state, limit, job.tokens[objCounter], []int{objCounter}, sleepTime)
+			if time.Since(job.startTime)+sleepTime < job.maxBatchTime {
+				sleepTime = v.jitterRateLimitWait(job, sleepTime)
+				v.rateLimitWait(job, conf, "tokens", sleepTime)
+				// a cancelled context ends the wait right away and fails the remaining objects at the top of the loop
+				if sleepWithContext(job.ctx, sleepTime) == nil {
+					state.refill(time.Now())
+					// objects within the margin of the token limit don't fit even into a full limit
+					state.rateLimit.RemainingTokens = max(state.rateLimit.RemainingTokens, required)
 				}
+			} else {
+				job.errs[objCounter] = fmt.Errorf("text too long for vectorization. Cannot wait for token refresh due to time limit")
+				objCounter++
 			}
+			continue // try again or next item
+		}
 
-			// if a single object is larger than the current token limit we need to wait until the token limit refreshes
-			// enough to be able to handle the object. This assumes that the tokenLimit refreshes linearly which is true
-			// for openAI, but needs to be checked for other providers
-			if len(texts) == 0 && rateLimit.ResetTokens > 0 {
-				fractionOfTotalLimit := float32(job.tokens[objCounter]) / float32(rateLimit.LimitTokens)
-				sleepTime := time.Duration(float32(rateLimit.ResetTokens)*fractionOfTotalLimit+1) * time.Second
-				if time.Since(job.startTime)+sleepTime < v.maxBatchTime {
-					time.Sleep(sleepTime)
-					rateLimit.RemainingTokens += int(float32(rateLimit.LimitTokens) * fractionOfTotalLimit)
-				} else {
-					job.errs[objCounter] = fmt.Errorf("text too long for vectorization. Cannot wait for token refresh due to time limit")
-					objCounter++
-				}
-				continue // try again or next item
-			}
-
-			start := time.Now()
-			rateLimitNew, _ := v.makeRequest(job, texts, conf, origIndex)
-			batchTookInS = time.Since(start).Seconds()
-			timePerToken = batchTookInS / float64(tokensInCurrentBatch)
-			if rateLimitNew != nil {
-				rateLimit = rateLimitNew
-			}
-			// not all request limits are included in "RemainingRequests" and "ResetRequests". For example, in the free
-			// tier only the RPD limits are shown but not RPM
-			if rateLimit.RemainingRequests == 0 && rateLimit.ResetRequests > 0 {
-				// if we need to wait more than MaxBatchTime for a reset we need to stop the batch to not produce timeouts
-				if time.Since(job.startTime)+time.Duration(rateLimit.ResetRequests)*time.Second > v.maxBatchTime {
-					for j := origIndex[0]; j < len(job.texts); j++ {
-						if !job.skipObject[j] {
-							job.errs[j] = errors.New("request rate limit exceeded and will not refresh in time")
-						}
+		v.logSplit(state, limit, tokensInCurrentBatch, origIndex, 0)
+		if !v.awaitRequestInterval(job, lastRequest) {
+			failFrom(job, origIndex[0], errRequestIntervalTimeout)
+			texts = texts[:0]
+			break
+		}
+		start := time.Now()
+		lastRequest = start
+		rateLimitNew, err := v.makeRequest(job, texts, conf, origIndex)
+		if isTerminal(err) {
+			failFrom(job, objCounter, err)
+			return
+		}
+		batchTookInS := time.Since(start).Seconds()
+		state.timePerToken = batchTookInS / float64(tokensInCurrentBatch)
+		state.updateRateLimit(rateLimitNew)
+		// not all request limits are included in "RemainingRequests" and "ResetRequests". For example, in the free
+		// tier only the RPD limits are shown but not RPM
+		if state.rateLimit.RemainingRequests == 0 && state.rateLimit.ResetRequests > 0 {
+			// if we need to wait more than MaxBatchTime for a reset we need to stop the batch to not produce timeouts
+			if time.Since(job.startTime)+time.Duration(state.rateLimit.ResetRequests)*time.Second > job.maxBatchTime {
+				for j := origIndex[0]; j < len(job.texts); j++ {
+					if !job.skipObject[j] {
+						job.errs[j] = errors.New("request rate limit exceeded and will not refresh in time")
 					}
-					break
 				}
-				time.Sleep(time.Duration(rateLimit.ResetRequests) * time.Second)
+				break
 			}
+			wait := v.jitterRateLimitWait(job, time.Duration(state.rateLimit.ResetRequests)*time.Second)
+			v.rateLimitWait(job, conf, "requests", wait)
+			sleepWithContext(job.ctx, wait)
+		}
 
-			// reset for next vectorizer-batch
-			tokensInCurrentBatch = 0
-			texts = texts[:0]
-			origIndex = origIndex[:0]
+		if delay := pacingDelay(state.rateLimit, v.pacingThreshold); delay > 0 && objCounter < len(job.texts) &&
+			time.Since(job.startTime)+delay < job.maxBatchTime {
+			v.rateLimitWait(job, conf, "pacing", delay)
+			sleepWithContext(job.ctx, delay)
 		}
 
-		// in case we exit the loop without sending the last batch. This can happen when the last object is a skip or
-		// is too long
-		if len(texts) > 0 && objCounter == len(job.texts) {
-			rateLimitNew, _ := v.makeRequest(job, texts, conf, origIndex)
-			if rateLimitNew != nil {
-				rateLimit = rateLimitNew
+		// reset for next vectorizer-batch
+		tokensInCurrentBatch = 0
+		texts = texts[:0]
+		origIndex = origIndex[:0]
+
+		// high priority jobs can only preempt between two vectorizer-batches. The time they take counts towards the
+		// batch time of the preempted job.
+		if v.preemption && !job.highPriority {
+			v.preempt(lane)
+		}
+	}
+
+	// in case we exit the loop without sending the last batch. This can happen when the last object is a skip or
+	// is too long
+	if len(texts) > 0 && objCounter == len(job.texts) {
+		v.logSplit(state, splitLimitEnd, tokensInCurrentBatch, origIndex, 0)
+		if !v.awaitRequestInterval(job, lastRequest) {
+			failFrom(job, origIndex[0], errRequestIntervalTimeout)
+			return
+		}
+		rateLimitNew, _ := v.makeRequest(job, texts, conf, origIndex)
+		state.updateRateLimit(rateLimitNew)
+	}
+}
+
+// processJobWithoutRateLimit sends the objects of the job in requests of up to maxObjectsPerRequest objects right
+// after each other, without probing or waiting for rate limits and without splitting on tokens, see WithoutRateLimit
+func (v *Vectorizer) processJobWithoutRateLimit(job batchJob, lane *batchLane, conf ent.VectorizationConfig) {
+	texts := make([]string, 0, v.maxObjectsPerRequest)
+	origIndex := make([]int, 0, v.maxObjectsPerRequest)
+	var lastRequest time.Time
+	// send sends the collected objects and reports whether the job can go on, objects from next on fail if it can't
+	send := func(next int) bool {
+		if job.ctx.Err() != nil {
+			failFrom(job, origIndex[0], contextError(job.ctx))
+			return false
+		}
+		v.logSplit(lane.workerState, splitLimitObjects, 0, origIndex, 0)
+		if !v.awaitRequestInterval(job, lastRequest) {
+			failFrom(job, origIndex[0], errRequestIntervalTimeout)
+			return false
+		}
+		lastRequest = time.Now()
+		if _, err := v.makeRequest(job, texts, conf, origIndex); isTerminal(err) {
+			failFrom(job, next, err)
+			return false
+		}
+		texts = texts[:0]
+		origIndex = origIndex[:0]
+		return true
+	}
+	for objCounter := 0; objCounter < len(job.texts); objCounter++ {
+		if job.skipObject[objCounter] {
+			continue
+		}
+		if err := job.assembly.wait(objCounter); err != nil {
+			if err != errSkippedInput {
+				job.errs[objCounter] = err
 			}
+			continue
+		}
+		texts = append(texts, job.texts[objCounter])
+		origIndex = append(origIndex, objCounter)
+		if len(texts) < v.maxObjectsPerRequest {
+			continue
 		}
 
-		job.wg.Done()
+		if !send(objCounter + 1) {
+			return
+		}
+		if v.preemption && !job.highPriority {
+			v.preempt(lane)
+		}
+	}
 
+	// the last objects are sent here, whether or not the last object of the job made it into them
+	if len(texts) > 0 {
+		send(len(job.texts))
+	}
+}
+
+// contextError is the error of the objects that were not vectorized because the context of the job ended
+func contextError(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrBatchTimeBudgetExceeded) {
+		return cause
+	}
+	return fmt.Errorf("context deadline exceeded or cancelled")
+}
+
+// failFrom fails all objects of the job that are not skipped, starting at index from
+func failFrom(job batchJob, from int, err error) {
+	for j := from; j < len(job.texts); j++ {
+		if !job.skipObject[j] {
+			job.errs[j] = err
+		}
+	}
+}
+
+// skipSuperseded fails all objects of the job with ErrSuperseded whose version is older than the latest version and
+// returns a copy of the skip list in which those objects are skipped as well
+func (v *Vectorizer) skipSuperseded(job batchJob) []bool {
+	skipObject := make([]bool, len(job.skipObject))
+	copy(skipObject, job.skipObject)
+	for j := range job.objects {
+		if skipObject[j] {
+			continue
+		}
+		if latest, ok := v.latestVersion(job.ctx, job.objects[j]); ok && latest > job.objects[j].LastUpdateTimeUnix {
+			job.errs[j] = ErrSuperseded
+			skipObject[j] = true
+		}
 	}
+	return skipObject
 }
 
 func (v *Vectorizer) makeRequest(job batchJob, texts []string, conf ent.VectorizationConfig, origIndex []int,
 ) (*ent.RateLimits, error) {
-	res, rateLimit, err := v.client.Vectorize(job.ctx, texts, conf)
+	probe, breakerErr := v.breaker.allow()
+	if breakerErr != nil || probe == 0 || len(texts) <= probe {
+		return v.sendRequest(job, texts, conf, origIndex, breakerErr)
+	}
+
+	// the probe of an open breaker only sends a few inputs, the others follow once it closed the breaker
+	rateLimit, err := v.sendRequest(job, texts[:probe], conf, origIndex[:probe], nil)
+	if isTerminal(err) {
+		for _, index := range origIndex[probe:] {
+			job.errs[index] = err
+		}
+		if job.stream != nil {
+			v.streamResults(job, origIndex[probe:])
+		}
+		return rateLimit, err
+	}
+	rest, err := v.makeRequest(job, texts[probe:], conf, origIndex[probe:])
+	if rest == nil {
+		rest = rateLimit
+	}
+	return rest, err
+}
+
+// sendRequest sends a single request with the given inputs, or fails them with breakerErr if the circuit breaker
+// didn't allow the request
+func (v *Vectorizer) sendRequest(job batchJob, texts []string, conf ent.VectorizationConfig, origIndex []int,
+	breakerErr error,
+) (*ent.RateLimits, error) {
+	if job.stream != nil {
+		defer v.streamResults(job, origIndex)
+	}
+	tokens := 0
+	for _, index := range origIndex {
+		tokens += job.tokens[index]
+	}
+	if v.metrics != nil {
+		v.metrics.observeRequest(conf.Model, len(texts), tokens)
+	}
+
+	if breakerErr != nil {
+		for j := 0; j < len(texts); j++ {
+			job.errs[origIndex[j]] = breakerErr
+		}
+		return nil, breakerErr
+	}
+
+	release, err := v.acquireTokens(job.ctx, tokens)
 	if err != nil {
 		for j := 0; j < len(texts); j++ {
 			job.errs[origIndex[j]] = err
 		}
+		return nil, err
+	}
+	defer release()
+
+	conf.HighPrecision = job.vecs64 != nil
+	res, rateLimit, conf, err := withFallbackModels(conf, NewClassSettings(job.cfg).FallbackModels(),
+		func(conf ent.VectorizationConfig) (*ent.VectorizationResult, *ent.RateLimits, error) {
+			return v.vectorize(job, texts, conf)
+		})
+	// the remaining objects of the job fail right away once the breaker opens
+	openErr := v.breaker.record(err, job.ctx.Err() != nil || isTerminal(err))
+	if err != nil {
+		if job.ctx.Err() != nil && errors.Is(context.Cause(job.ctx), ErrBatchTimeBudgetExceeded) {
+			err = fmt.Errorf("%w: %v", ErrBatchTimeBudgetExceeded, err)
+		}
+		for j := 0; j < len(texts); j++ {
+			job.errs[origIndex[j]] = err
+		}
 	} else {
+		if res.Tokens > 0 {
+			v.usage.tokens.Add(int64(res.Tokens))
+		} else {
+			v.usage.tokens.Add(int64(tokens))
+		}
+		if v.tenantUsage != nil {
+			v.attributeTokens(job, origIndex, res.Tokens)
+		}
+		if v.metrics != nil {
+			if res.Tokens > 0 {
+				tokens = res.Tokens
+			}
+			v.metrics.observeTokens(conf.Model, batchClassName(job.objects), tokens)
+		}
+		if v.modelCacheInvalidation {
+			for _, cache := range v.vectorCaches() {
+				cache.observeModel(conf, res.Model)
+			}
+		}
+
+		alignResult(res, len(texts))
+		if res.RequestID != "" && debugEnabled(v.logger) {
+			v.logger.WithField("action", "text2vec_openai_request").
+				WithField("request_id", res.RequestID).
+				WithField("job_id", ent.JobIDFromContext(job.ctx)).
+				WithField("objects", len(texts)).
+				Debug("vectorized a request")
+		}
+
+		// by default a response that only failed for some inputs still succeeds for the others
+		var subBatchErr error
+		if v.allOrNothingSubBatches {
+			for j := 0; j < len(texts); j++ {
+				if res.Errors[j] != nil {
+					subBatchErr = res.Errors[j]
+					break
+				}
+			}
+		}
 		for j := 0; j < len(texts); j++ {
-			if res.Errors[j] != nil {
+			if subBatchErr != nil {
+				job.errs[origIndex[j]] = subBatchErr
+			} else if res.Errors[j] != nil {
 				job.errs[origIndex[j]] = res.Errors[j]
+			} else if vec, err := v.checkDimensions(res.Vector[j], conf); err != nil {
+				job.errs[origIndex[j]] = err
 			} else {
-				job.vecs[origIndex[j]] = res.Vector[j]
+				job.vecs[origIndex[j]] = vec
+				job.models[origIndex[j]] = conf.Model
+				if job.reportedModels != nil {
+					job.reportedModels[origIndex[j]] = res.Model
+				}
+				if job.vecs64 != nil && j < len(res.VectorFloat64) {
+					job.vecs64[origIndex[j]] = res.VectorFloat64[j]
+				}
 			}
 		}
 	}
 
+	if openErr != nil {
+		return rateLimit, openErr
+	}
 	return rateLimit, err
 }
 
+// alignResult makes sure that the result has a vector and an error for each of the given number of inputs. Clients
+// that return fewer vectors than inputs fail the inputs at the end with clients.ErrResponseCountMismatch, so the
+// vectors that did return keep their inputs.
+func alignResult(res *ent.VectorizationResult, inputs int) {
+	if len(res.Vector) >= inputs && len(res.Errors) >= inputs {
+		return
+	}
+	vectors, errs := len(res.Vector), len(res.Errors)
+	res.Vector = append(res.Vector, make([][]float32, max(inputs-vectors, 0))...)
+	res.Errors = append(res.Errors, make([]error, max(inputs-errs, 0))...)
+	for j := vectors; j < inputs; j++ {
+		if res.Errors[j] == nil {
+			res.Errors[j] = clients.WithRequestID(fmt.Errorf("%w: got %d vectors for %d inputs",
+				clients.ErrResponseCountMismatch, vectors, inputs), res.RequestID)
+		}
+	}
+}
+
+// rateLimitWait records a wait of the batch worker for the rate limit before it waits
+func (v *Vectorizer) rateLimitWait(job batchJob, conf ent.VectorizationConfig, reason string, d time.Duration) {
+	v.waitLog.wait(reason, d, ent.JobIDFromContext(job.ctx))
+	batchCountersFromContext(job.ctx).observeWait(d)
+	if v.metrics != nil {
+		v.metrics.observeWait(conf.Model, batchClassName(job.objects), reason)
+	}
+}
+
+// batchClassName returns the class of the objects of a batch, which all belong to the same class
+func batchClassName(objects []*models.Object) string {
+	for _, object := range objects {
+		if object != nil {
+			return object.Class
+		}
+	}
+	return ""
+}
+
+// attributeTokens attributes the tokens of a request to the tenants of its objects. Some OpenAI compatible providers
+// don't report the tokens of a request, in which case the estimated tokens are used.
+func (v *Vectorizer) attributeTokens(job batchJob, origIndex []int, reported int) {
+	estimated := make(map[string]int)
+	total := 0
+	for _, index := range origIndex {
+		tenant := job.cfg.Tenant()
+		if index < len(job.objects) && job.objects[index] != nil && job.objects[index].Tenant != "" {
+			tenant = job.objects[index].Tenant
+		}
+		estimated[tenant] += job.tokens[index]
+		total += job.tokens[index]
+	}
+	if reported > 0 {
+		total = reported
+	} else if v.logger != nil {
+		v.missingUsage.Do(func() {
+			v.logger.WithField("action", "text2vec_openai_usage").
+				Warn("the vectorizer response does not report the used tokens, falling back to estimated tokens")
+		})
+	}
+	v.tenantUsage.attribute(total, estimated)
+}
+
+// ObjectBatch vectorizes the given objects. The vector of every object is returned at the index of the object, no
+// matter how the objects were split into requests, waited for rate limits or retried. Skipped and failed objects have
+// a nil vector, the errors are keyed by the index of the object. All returned vectors have the same dimensions,
+// objects whose vector differs from most others fail with ErrMixedDimensions. An empty batch returns empty vectors and
+// errors without sending anything, see ObjectBatchResults.
 func (v *Vectorizer) ObjectBatch(ctx context.Context, objects []*models.Object, skipObject []bool, cfg moduletools.ClassConfig,
 ) ([][]float32, map[int]error) {
+	results := v.ObjectBatchResults(ctx, objects, skipObject, cfg)
+	vecs := make([][]float32, len(results))
+	errs := make(map[int]error)
+	for i := range results {
+		vecs[i] = results[i].Vector
+		if results[i].Err != nil {
+			errs[i] = results[i].Err
+		}
+	}
+	return vecs, errs
+}
+
+// batchTime returns the maximum batch time for the kind of the call
+func (v *Vectorizer) batchTime(ctx context.Context) time.Duration {
+	if v.queryBatchTime > 0 && CallKindFromContext(ctx) == CallKindQuery {
+		return v.queryBatchTime
+	}
+	return v.maxBatchTime
+}
+
+// ObjectBatchResults vectorizes the given objects like ObjectBatch, but returns the outcome per object including
+// optional metadata. The results have the same order as the objects. An empty batch returns right away without any
+// request, a batch whose skipObject doesn't have an entry per object fails with ErrSkipObjectMismatch.
+func (v *Vectorizer) ObjectBatchResults(ctx context.Context, objects []*models.Object, skipObject []bool, cfg moduletools.ClassConfig,
+) []BatchResult {
+	if len(objects) == 0 {
+		return []BatchResult{}
+	}
+	if err := checkSkipObject(objects, skipObject); err != nil {
+		return mismatchResults(objects, err)
+	}
+	if v.onBatchComplete == nil {
+		return v.objectBatchResults(ctx, objects, skipObject, cfg, nil)
+	}
+	ctx, counters := contextWithBatchCounters(ctx, len(objects))
+	results := v.objectBatchResults(ctx, objects, skipObject, cfg, nil)
+	for i := range results {
+		counters.observeResult(results[i], skipObject[i])
+	}
+	v.onBatchComplete(counters.finish())
+	return results
+}
+
+// objectBatchResults implements ObjectBatchResults. With a stream the results that are known before the batch is done
+// are sent right away, they are left empty in the returned results.
+func (v *Vectorizer) objectBatchResults(ctx context.Context, objects []*models.Object, skipObject []bool,
+	cfg moduletools.ClassConfig, stream *batchStream,
+) []BatchResult {
+	cfg = withModelOverride(ctx, cfg)
+	if err := checkModelOverride(cfg); err != nil {
+		return failedResults(skipObject, err)
+	}
+	if budget := ImportBudgetFromContext(ctx); budget != nil {
+		if budget.Exhausted() {
+			return failedResults(skipObject, ErrImportTimeBudgetExceeded)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, budget.deadline)
+		defer cancel()
+	}
+	if v.maxBatchDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, v.maxBatchDuration, ErrBatchTimeBudgetExceeded)
+		defer cancel()
+	}
+	if err := NewClassSettings(cfg).validateDimensions(); err != nil {
+		return failedResults(skipObject, err)
+	}
+
+	// with propertyModels the vector of the class model only covers the properties that are not routed to other models
+	var routed *propertyModelConfig
+	mainSkip := skipObject
+	if propertyModels := NewClassSettings(cfg).PropertyModels(); len(propertyModels) > 0 {
+		routed = &propertyModelConfig{ClassConfig: cfg, propertyModels: propertyModels}
+		cfg = *routed
+		if routed.routesAllProperties() {
+			mainSkip = make([]bool, len(objects))
+			for i := range mainSkip {
+				mainSkip[i] = true
+			}
+		}
+	}
+
+	start := time.Now()
+	// results can only be sent before the batch is done if they are final once their request is done
+	var early *batchStream
+	if stream != nil && routed == nil && v.batchRetryBackoff <= 0 {
+		early = stream
+		early.start = start
+	}
+	vecs, errs, tokens, sections, reasons, vecModels := v.objectBatch(ctx, objects, mainSkip, cfg, early)
+	if v.retryBatch(ctx, mainSkip, errs) {
+		vecs, errs, tokens, sections, reasons, vecModels = v.objectBatch(ctx, objects, mainSkip, cfg, nil)
+	}
+	if early != nil {
+		checkMixedDimensions(vecs, errs, early.dimensions)
+	} else {
+		checkMixedDimensions(vecs, errs, 0)
+	}
+	duration := time.Since(start)
+	if v.metrics != nil {
+		v.metrics.observeBatch(NewClassSettings(cfg).Model(), batchClassName(objects), duration)
+	}
+	consumed := deadlineConsumed(ctx, start, v.batchTime(ctx))
+	results := make([]BatchResult, len(objects))
+	for i := range objects {
+		results[i].Index = i
+		if early != nil && early.sent[i] {
+			continue
+		}
+		results[i].Err = errs[i]
+		if tokens != nil && errs[i] == nil {
+			results[i].Tokens = tokens[i]
+		}
+		if vecs != nil {
+			results[i].Vector = vecs[i]
+		}
+		if sections != nil {
+			results[i].Sections = sections[i]
+		}
+		if reasons != nil {
+			results[i].CacheHit = reasons[i] == SkipReasonCacheHit
+		}
+		if vecModels != nil {
+			results[i].Model = vecModels[i]
+		}
+		eventTokens := 0
+		if tokens != nil {
+			eventTokens = tokens[i]
+		}
+		v.finishResult(&results[i], skipObject[i], eventTokens, consumed, duration)
+	}
+	if routed != nil {
+		v.namedVectors(ctx, objects, skipObject, *routed, results)
+	}
+	for i := range results {
+		if early == nil || !early.sent[i] {
+			reason := SkipReasonNone
+			if reasons != nil {
+				reason = reasons[i]
+			}
+			setSkipReason(&results[i], skipObject[i], reason)
+		}
+	}
+	return results
+}
+
+// ObjectBatchWithMetadata vectorizes the given objects like ObjectBatchResults and attaches the opaque metadata of
+// every object to its result, so callers do not have to correlate results by index. The metadata needs to be
+// parallel to the objects, a nil slice attaches no metadata.
+func (v *Vectorizer) ObjectBatchWithMetadata(ctx context.Context, objects []*models.Object, skipObject []bool,
+	metadata []interface{}, cfg moduletools.ClassConfig,
+) []BatchResult {
+	if metadata != nil && len(metadata) != len(objects) {
+		err := fmt.Errorf("got metadata for %d objects, expected %d", len(metadata), len(objects))
+		results := make([]BatchResult, len(objects))
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	results := v.ObjectBatchResults(ctx, objects, skipObject, cfg)
+	for i := range metadata {
+		results[i].Metadata = metadata[i]
+	}
+	return results
+}
+
+// ValidateBatch runs the same input checks as ObjectBatch without vectorizing anything, so a batch can be checked
+// before an import. It returns the errors of the objects that would fail before being sent to OpenAI, e.g.
+// ErrNilObject, ErrInputTooLong, ErrTextTooLong if an input exceeds the context window of the model or ErrEmptyInput
+// with vectorizeEmptyObjects.
+// Errors that depend on the rate limits of the account or on the responses of OpenAI are not detected.
+func (v *Vectorizer) ValidateBatch(ctx context.Context, objects []*models.Object, skipObject []bool, cfg moduletools.ClassConfig,
+) map[int]error {
+	errs := make(map[int]error)
+	if err := checkSkipObject(objects, skipObject); err != nil {
+		for i := range objects {
+			errs[i] = err
+		}
+		return errs
+	}
+	cfg = withModelOverride(ctx, cfg)
+	fail := func(err error) map[int]error {
+		for i := range objects {
+			if !skipObject[i] {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+	if err := checkModelOverride(cfg); err != nil {
+		return fail(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	conf := v.getVectorizationConfig(cfg)
+	icheck := NewClassSettings(cfg)
+	tke, err := tokenEncoder(conf.Model)
+	if err != nil {
+		return fail(err)
+	}
+
+	texts := make([]string, len(objects))
+	skip := append([]bool{}, skipObject...)
+	for i := range objects {
+		if skip[i] {
+			continue
+		}
+		if objects[i] == nil {
+			skip[i] = true
+			errs[i] = ErrNilObject
+			continue
+		}
+		if err := v.checkAssembly(objects[i], icheck); err != nil {
+			skip[i] = true
+			errs[i] = err
+			continue
+		}
+		texts[i] = assembleInput(objects[i], icheck, propertyTokenCounter(icheck, tke))
+	}
+
+	// sections are checked like separate objects and an object fails with the first error of its sections
+	owners := make([]int, len(texts))
+	for i := range owners {
+		owners[i] = i
+	}
+	if sections := inputSections(objects, texts, skip, icheck, tke); sections != nil {
+		texts, skip, owners = sections.texts, sections.skipObject, sections.owners
+	}
+	for i := range texts {
+		if skip[i] {
+			continue
+		}
+		if _, _, err := v.prepareInput(texts[i], icheck, conf.Model, tke); err != nil && !skipInput(err, icheck) &&
+			errs[owners[i]] == nil {
+			errs[owners[i]] = err
+		}
+	}
+	return errs
+}
+
+// AssembleInput returns the input that is sent to OpenAI for the object with the settings of the class, after the
+// same checks and truncation as in a batch, without sending anything. It reproduces the input of an object whose vector
+// looks wrong. Objects without any text to vectorize fail with ErrEmptyInput, whether they are skipped in batches or
+// not. Objects of classes with a sectionDelimiter or the combineStrategy average are sent as several inputs and fail.
+func (v *Vectorizer) AssembleInput(object *models.Object, cfg moduletools.ClassConfig) (string, error) {
+	if object == nil {
+		return "", ErrNilObject
+	}
+	icheck := NewClassSettings(cfg)
+	if icheck.SectionDelimiter() != "" || icheck.CombineStrategy() == CombineStrategyAverage {
+		return "", errors.New("objects with a sectionDelimiter or the combineStrategy average have several inputs")
+	}
+	if err := v.checkAssembly(object, icheck); err != nil {
+		return "", err
+	}
+	model := v.getVectorizationConfig(cfg).Model
+	tke, err := tokenEncoder(model)
+	if err != nil {
+		return "", err
+	}
+	text, _, err := v.prepareInput(assembleInput(object, icheck, propertyTokenCounter(icheck, tke)), icheck, model, tke)
+	return text, err
+}
+
+// checkAssembly logs the properties of the object that are left out of its input because they cannot be rendered at
+// debug level. With strictAssembly the object fails with the first of them instead.
+func (v *Vectorizer) checkAssembly(object *models.Object, settings ClassSettings) error {
+	for _, err := range propertyErrors(object, settings) {
+		if settings.StrictAssembly() {
+			return err
+		}
+		v.logger.WithField("action", "text2vec_openai_assembly").WithField("class", object.Class).WithError(err).
+			Debug("left a property that cannot be rendered out of the input")
+	}
+	return nil
+}
+
+// acquireTokens blocks until the tokens of a request fit into the budget for in-flight tokens, see
+// WithMaxInFlightTokens. A request with more tokens than the budget waits for all other requests to finish.
+func (v *Vectorizer) acquireTokens(ctx context.Context, tokens int) (func(), error) {
+	if v.inFlightTokens == nil {
+		return func() {}, nil
+	}
+
+	weight := int64(tokens)
+	if weight > v.maxInFlightTokens {
+		weight = v.maxInFlightTokens
+	}
+	if err := v.inFlightTokens.Acquire(ctx, weight); err != nil {
+		return nil, err
+	}
+	return func() { v.inFlightTokens.Release(weight) }, nil
+}
+
+// tokenEncoder returns the tokenizer of the given model
+func tokenEncoder(model string) (*tiktoken.Tiktoken, error) {
+	// go token library is outdated. Alter the model-name to use a different model name with the same tokenization-behaviour
+	if model == "text-embedding-ada-002" || model == "text-embedding-3-small" || model == "text-embedding-3-large" {
+		model = "gpt-4"
+	}
+	return tiktoken.EncodingForModel(model)
+}
+
+// countTokens returns the number of tokens of a single input, which decides how inputs are split into requests
+func (v *Vectorizer) countTokens(text, model string, tke *tiktoken.Tiktoken) int {
+	if v.tokenCounter != nil {
+		return v.tokenCounter(text, model)
+	}
+	return clients.GetTokensCount(model, text, tke)
+}
+
+// prepareInput runs all checks of a single input that don't depend on the rate limits and returns the input that is
+// sent to OpenAI and its tokens. Inputs without any text fail with ErrEmptyInput (see skipInput), inputs longer than
+// maxInputFraction allows are truncated or fail with ErrInputTooLong and inputs that don't fit into the context window
+// of the model are truncated with truncateInput or fail with a TextTooLongError. ValidateBatch runs the same checks.
+// The hook of WithPreprocess runs first.
+func (v *Vectorizer) prepareInput(text string, settings ClassSettings, model string, tke *tiktoken.Tiktoken,
+) (string, int, error) {
+	if v.preprocess != nil {
+		text = v.preprocess(text)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", 0, ErrEmptyInput
+	}
+	text, err := capInput(text, settings.InputTokenCap(), settings.InputTruncation() == InputTruncationTruncate, tke)
+	if err != nil {
+		return "", 0, err
+	}
+	tokens := v.countTokens(text, model, tke)
+	contextWindow := settings.ContextWindow()
+	if contextWindow <= 0 || tokens <= contextWindow {
+		return text, tokens, nil
+	}
+	if mode := settings.TruncateInput(); mode != TruncateInputNone {
+		encoded := tke.Encode(text, nil, nil)
+		// the tokens of an input include a fixed overhead on top of its encoding that needs to fit as well
+		keep := contextWindow - max(tokens-len(encoded), 0)
+		if keep > 0 {
+			truncated := truncateTokens(encoded, keep, mode == TruncateInputTail, tke)
+			if truncatedTokens := v.countTokens(truncated, model, tke); truncatedTokens <= contextWindow {
+				v.logger.WithField("action", "text2vec_openai_truncate_input").WithField("model", model).
+					WithField("tokens", tokens).WithField("limit", contextWindow).
+					Debugf("truncated an input that does not fit into the context window to its %s", mode)
+				return truncated, truncatedTokens, nil
+			}
+		}
+	}
+	return "", 0, &TextTooLongError{Tokens: tokens, Limit: contextWindow}
+}
+
+// skipInput returns whether an object whose input failed with err is skipped instead of failing. Objects without any
+// text to vectorize are skipped and keep a nil vector, unless vectorizeEmptyObjects is set.
+func skipInput(err error, settings ClassSettings) bool {
+	return errors.Is(err, ErrEmptyInput) && !settings.VectorizeEmptyObjects()
+}
+
+// propertyTokenCounter returns the token counter for assembleInput, which is only needed if short properties are
+// excluded
+func propertyTokenCounter(settings ClassSettings, tke *tiktoken.Tiktoken) func(string) int {
+	if settings.MinPropertyTokens() <= 0 {
+		return nil
+	}
+	return func(text string) int {
+		return len(tke.Encode(text, nil, nil))
+	}
+}
+
+// objectBatch returns the vectors, errors and tokens of all objects, if the class has a sectionDelimiter or the
+// combineStrategy average the vectors of all sections of every object and, if a cache or dedupeInputs is used, which
+// vectors came from the cache or an earlier duplicate
+func (v *Vectorizer) objectBatch(ctx context.Context, objects []*models.Object, skipObject []bool, cfg moduletools.ClassConfig,
+	stream *batchStream,
+) ([][]float32, map[int]error, []int, [][][]float32, []SkipReason, []string) {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	errs := make(map[int]error)
@@ -288,49 +1339,276 @@ func (v *Vectorizer) ObjectBatch(ctx context.Context, objects []*models.Object,
 	icheck := NewClassSettings(cfg)
 	vecs := make([][]float32, len(objects))
 
-	// go token library is outdated. Alter the model-name to use a different model name with the same tokenization-behaviour
-	model := conf.Model
-	if model == "text-embedding-ada-002" || model == "text-embedding-3-small" || model == "text-embedding-3-large" {
-		model = "gpt-4"
-	}
+	caches := v.vectorLookups()
+	split := icheck.SectionDelimiter() != "" || icheck.CombineStrategy() == CombineStrategyAverage
+	// inputs can only be assembled in the background if they are not all needed before the batch is dispatched
+	prefetch := v.assemblyPrefetch && len(caches) == 0 && !split && !icheck.DedupeInputs()
 
-	tke, err := tiktoken.EncodingForModel(model)
-	if err != nil { // fail all objects as they all have the same model
-		for j := range objects {
-			errs[j] = err
+	var tke *tiktoken.Tiktoken
+	if !prefetch {
+		var err error
+		tke, err = tokenEncoder(conf.Model)
+		if err != nil { // fail all objects as they all have the same model
+			for j := range objects {
+				errs[j] = err
+			}
+			return nil, errs, nil, nil, nil, nil
 		}
-		return nil, errs
 	}
 
 	// prepare input for vectorizer, and send it to the queue. Prepare here to avoid work in the queue-worker
-	skipAll := true
+	objectCount := 0
+	// objects that fail before they are dispatched are skipped from here on, without modifying the skip list of the
+	// caller
+	skipObject = append([]bool{}, skipObject...)
 	for i := range objects {
 		if skipObject[i] {
 			continue
 		}
-		skipAll = false
-		text := v.objectVectorizer.Texts(ctx, objects[i], icheck)
-		texts[i] = text
-		tokens[i] = clients.GetTokensCount(conf.Model, text, tke)
+		if objects[i] == nil {
+			skipObject[i] = true
+			errs[i] = ErrNilObject
+			continue
+		}
+		if err := v.checkAssembly(objects[i], icheck); err != nil {
+			skipObject[i] = true
+			errs[i] = err
+			continue
+		}
+		objectCount++
+		if !prefetch {
+			texts[i] = assembleInput(objects[i], icheck, propertyTokenCounter(icheck, tke))
+		}
+	}
+
+	// with a section delimiter or the combine strategy average every section is vectorized like a separate object and
+	// the results are joined per object at the end
+	var sections *batchSections
+	objectErrs := errs
+	if split {
+		sections = inputSections(objects, texts, skipObject, icheck, tke)
+		objects, texts, skipObject = sections.objects, sections.texts, sections.skipObject
+		objectCount = len(texts)
+		errs = make(map[int]error)
+		tokens = make([]int, len(texts))
+		vecs = make([][]float32, len(texts))
+	}
+	if !prefetch {
+		for i := range texts {
+			if skipObject[i] {
+				continue
+			}
+			var err error
+			if texts[i], tokens[i], err = v.prepareInput(texts[i], icheck, conf.Model, tke); err != nil {
+				if !skipInput(err, icheck) {
+					errs[i] = err
+				}
+				skipObject[i] = true
+				objectCount--
+				continue
+			}
+		}
 	}
 
-	if skipAll {
-		return vecs, errs
+	// reasons are kept per object, they are nil if no object was skipped with a reason
+	var cacheKeys []string
+	var reasons []SkipReason
+	if len(caches) > 0 {
+		uncached := skipObject
+		cacheKeys, skipObject, objectCount = v.fromCache(caches, conf, texts, skipObject, vecs, tokens)
+		cacheHits := make([]bool, len(skipObject))
+		for i := range cacheHits {
+			cacheHits[i] = skipObject[i] && !uncached[i]
+		}
+		if sections != nil {
+			cacheHits = sections.objectCacheHits(cacheHits, uncached)
+		}
+		reasons = make([]SkipReason, len(cacheHits))
+		for i := range cacheHits {
+			if cacheHits[i] {
+				reasons[i] = SkipReasonCacheHit
+			}
+		}
 	}
 
-	v.jobQueueCh <- batchJob{
-		ctx:        ctx,
-		wg:         &wg,
-		errs:       errs,
-		cfg:        cfg,
-		texts:      texts,
-		tokens:     tokens,
-		vecs:       vecs,
-		skipObject: skipObject,
-		startTime:  time.Now(),
+	var duplicates map[int]int
+	if icheck.DedupeInputs() {
+		skipObject, duplicates, objectCount = dedupeInputs(texts, skipObject, tokens, objectCount)
+		// duplicate sections don't make their objects duplicates
+		if sections == nil && len(duplicates) > 0 {
+			if reasons == nil {
+				reasons = make([]SkipReason, len(skipObject))
+			}
+			for duplicate := range duplicates {
+				reasons[duplicate] = SkipReasonDedupeAlias
+			}
+		}
 	}
 
-	wg.Wait()
+	if objectCount == 0 {
+		if sections != nil {
+			vecs, errs, tokens, sectionVecs := sections.join(vecs, errs, tokens, objectErrs)
+			return vecs, errs, tokens, sectionVecs, reasons, vectorModels(vecs, nil, conf.Model)
+		}
+		return vecs, errs, tokens, nil, reasons, vectorModels(vecs, nil, conf.Model)
+	}
 
-	return vecs, errs
+	var assembled *assembly
+	if prefetch {
+		assembled = newAssembly(len(texts))
+		enterrors.GoWrapper(func() {
+			// waiting jobs must not block forever, even if the assembly fails
+			defer assembled.advance(len(texts))
+			tke, err := tokenEncoder(conf.Model)
+			if err != nil {
+				assembled.fail(err)
+				return
+			}
+			for i := range objects {
+				if ctx.Err() != nil {
+					// the job fails without the remaining inputs
+					assembled.fail(contextError(ctx))
+					return
+				}
+				if !skipObject[i] {
+					text, count, err := v.prepareInput(assembleInput(objects[i], icheck, propertyTokenCounter(icheck, tke)),
+						icheck, conf.Model, tke)
+					if skipInput(err, icheck) {
+						assembled.failObject(i, errSkippedInput)
+					} else if err != nil {
+						assembled.failObject(i, err)
+					} else {
+						texts[i] = text
+						tokens[i] = count
+					}
+				}
+				assembled.advance(i + 1)
+			}
+		}, v.logger)
+	}
+
+	job := batchJob{
+		ctx:          ctx,
+		wg:           &wg,
+		errs:         errs,
+		cfg:          cfg,
+		texts:        texts,
+		tokens:       tokens,
+		vecs:         vecs,
+		models:       make([]string, len(texts)),
+		skipObject:   skipObject,
+		startTime:    time.Now(),
+		objects:      objects,
+		maxBatchTime: v.batchTime(ctx),
+		highPriority: BatchPriorityFromContext(ctx) == BatchPriorityHigh,
+		assembly:     assembled,
+		subBatch:     isSubBatch(ctx),
+		claimed:      &atomic.Bool{},
+	}
+	if v.modelCacheInvalidation {
+		job.reportedModels = make([]string, len(texts))
+	}
+	// float64 vectors are only kept as they are returned, which the vectors of sections are not
+	collector := highPrecisionFromContext(ctx)
+	if collector != nil && !split {
+		job.vecs64 = make([][]float64, len(texts))
+	}
+	// the results of objects with sections are only known once all their sections are vectorized
+	if !split {
+		job.stream = stream
+	}
+	v.dispatch(job, objectCount)
+	// the job can end before all inputs are assembled, e.g. if the context is cancelled
+	assembled.waitAll()
+
+	for _, cache := range caches {
+		for i := range objects {
+			// vectors of fallback models are not cached, so the model of the class is tried again once it is available
+			if !skipObject[i] && errs[i] == nil && vecs[i] != nil && job.models[i] == conf.Model &&
+				!v.outdatedModel(conf, job, i) {
+				cache.add(cacheKeys[i], vecs[i])
+			}
+		}
+	}
+	fanOutDuplicates(duplicates, vecs, errs, job.models)
+	if job.vecs64 != nil {
+		collector.vecs = job.vecs64
+	}
+
+	if sections != nil {
+		models := sections.objectModels(vectorModels(vecs, job.models, conf.Model), objectErrs)
+		vecs, errs, tokens, sectionVecs := sections.join(vecs, errs, tokens, objectErrs)
+		return vecs, errs, tokens, sectionVecs, reasons, vectorModels(vecs, models, conf.Model)
+	}
+	return vecs, errs, tokens, nil, reasons, vectorModels(vecs, job.models, conf.Model)
+}
+
+// outdatedModel returns whether OpenAI reported another model for conf after it returned the vector of the object with
+// index i. Such vectors are not cached, as the cache only holds vectors of the latest model, see
+// WithModelCacheInvalidation.
+func (v *Vectorizer) outdatedModel(conf ent.VectorizationConfig, job batchJob, i int) bool {
+	if job.reportedModels == nil || job.reportedModels[i] == "" {
+		return false
+	}
+	for _, cache := range v.vectorCaches() {
+		if latest, ok := cache.observedModel(conf); ok && latest != job.reportedModels[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// vectorLookups returns all caches that batches consult in lookup order, the in-memory caches of vectorCaches first
+func (v *Vectorizer) vectorLookups() []vectorLookup {
+	var lookups []vectorLookup
+	for _, cache := range v.vectorCaches() {
+		lookups = append(lookups, cache)
+	}
+	if v.externalCache != nil {
+		lookups = append(lookups, externalCache{cache: v.externalCache})
+	}
+	return lookups
+}
+
+// vectorCaches returns the enabled in-memory caches in lookup order
+func (v *Vectorizer) vectorCaches() []*vectorCache {
+	var caches []*vectorCache
+	if v.dedupWindow != nil {
+		caches = append(caches, v.dedupWindow)
+	}
+	if v.cache != nil {
+		caches = append(caches, v.cache)
+	}
+	return caches
+}
+
+// fromCache fills in the vectors of all objects that are cached. It returns the cache keys of all objects and a copy
+// of the skip list in which the cached objects are skipped, together with the number of objects that still need to
+// be vectorized.
+func (v *Vectorizer) fromCache(caches []vectorLookup, conf ent.VectorizationConfig, texts []string, skipObject []bool,
+	vecs [][]float32, tokens []int,
+) ([]string, []bool, int) {
+	keys := make([]string, len(texts))
+	skip := make([]bool, len(skipObject))
+	copy(skip, skipObject)
+	objectCount := 0
+	for i := range texts {
+		if skip[i] {
+			continue
+		}
+		keys[i] = vectorCacheKey(conf, texts[i])
+		for _, cache := range caches {
+			if vec, ok := cache.get(keys[i]); ok {
+				vecs[i] = vec
+				// cached vectors don't cost any tokens
+				tokens[i] = 0
+				skip[i] = true
+				break
+			}
+		}
+		if !skip[i] {
+			objectCount++
+		}
+	}
+	return keys, skip, objectCount
 }
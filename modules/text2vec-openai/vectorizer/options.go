@@ -0,0 +1,401 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// Option configures optional behavior of the vectorizer created by New
+type Option func(v *Vectorizer)
+
+// WithMaxInputAge drops batches that waited longer than maxAge in the batch queue before the worker reached them.
+// All non-skipped objects of such a batch fail with ErrStale. A value of 0 disables the check.
+func WithMaxInputAge(maxAge time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.maxInputAge = maxAge
+	}
+}
+
+// WithAllOrNothingSubBatches fails every object of a request to OpenAI if the response contains an error for any of
+// its inputs. By default only the affected objects fail and the rest of the request succeeds.
+func WithAllOrNothingSubBatches() Option {
+	return func(v *Vectorizer) {
+		v.allOrNothingSubBatches = true
+	}
+}
+
+// WithVectorFingerprints adds a stable fingerprint of every returned vector to the results of ObjectBatchResults
+func WithVectorFingerprints() Option {
+	return func(v *Vectorizer) {
+		v.vectorFingerprints = true
+	}
+}
+
+// WithPreemption allows high priority batches (see ContextWithBatchPriority) to pause a running normal priority batch.
+// The normal batch finishes its current request to the vectorizer, then all queued high priority batches run and
+// afterwards the normal batch resumes.
+func WithPreemption() Option {
+	return func(v *Vectorizer) {
+		v.preemption = true
+	}
+}
+
+// WithOverloadRetries retries requests that OpenAI rejected because the model is overloaded (see
+// clients.ErrModelOverloaded) or failed with another server error (a clients.ProviderError with a 5xx status).
+// Overloads usually take longer to clear than other transient errors, so the backoff should be chosen accordingly.
+// Retries are only attempted if they fit into the batch time.
+func WithOverloadRetries(cfg RetryConfig) Option {
+	return func(v *Vectorizer) {
+		v.overloadRetries = cfg
+	}
+}
+
+// WithDNSRetries retries requests that failed because the host of the API could not be resolved (see
+// clients.ErrDNS). DNS failures tend to clear quickly, so a short backoff is usually sufficient. Retries are only
+// attempted if they fit into the batch time.
+func WithDNSRetries(cfg RetryConfig) Option {
+	return func(v *Vectorizer) {
+		v.dnsRetries = cfg
+	}
+}
+
+// WithRateLimitRetries retries requests that OpenAI rejected with 429 Too Many Requests (see clients.ErrRateLimited),
+// for example because other clients of the same organization used up the shared rate limit. If the response has a
+// Retry-After header, its wait is used instead of the backoff. Retries are only attempted if they fit into the batch
+// time and the context deadline.
+func WithRateLimitRetries(cfg RetryConfig) Option {
+	return func(v *Vectorizer) {
+		v.rateLimitRetries = cfg
+	}
+}
+
+// WithMalformedResponseRetries retries requests whose response body is not valid JSON (see
+// clients.ErrMalformedResponse), e.g. the truncated bodies or HTML error pages of a flaky gateway. If all retries fail,
+// only the objects of the request fail with the error, which contains the start of the body. Retries are only
+// attempted if they fit into the batch time.
+func WithMalformedResponseRetries(cfg RetryConfig) Option {
+	return func(v *Vectorizer) {
+		v.malformedResponseRetries = cfg
+	}
+}
+
+// LatestVersionFunc returns the latest known version (see WithLatestVersionCheck) of the given object and false if
+// the version is not known.
+type LatestVersionFunc func(ctx context.Context, object *models.Object) (int64, bool)
+
+// WithLatestVersionCheck compares the version of every object with the latest version right before it is sent to
+// the vectorizer. The version of an object is its LastUpdateTimeUnix. Objects that have been superseded by a newer
+// version in the meantime are not vectorized and fail with ErrSuperseded.
+func WithLatestVersionCheck(latestVersion LatestVersionFunc) Option {
+	return func(v *Vectorizer) {
+		v.latestVersion = latestVersion
+	}
+}
+
+// WithVectorCache caches the vectors of up to capacity inputs in memory, so batches don't vectorize inputs again that
+// were vectorized before with the same settings. The least recently used vectors are evicted first.
+//
+// With compress the cached vectors are quantized to int8, which reduces the memory per vector to about a quarter.
+// Cached vectors then differ from the original vectors by at most max(|v|)/254 per dimension.
+func WithVectorCache(capacity int, compress bool) Option {
+	return func(v *Vectorizer) {
+		v.cache = newVectorCache(capacity, compress, 0)
+	}
+}
+
+// WithExternalCache looks up the vectors of all inputs in the given cache before they are vectorized and stores the
+// vectors of the vectorized inputs in it, which avoids vectorizing unchanged objects again when they are re-imported.
+// The keys are the inputs together with all settings that change their vector, such as the model and the dimensions.
+// The cache is consulted after WithDedupWindow and WithVectorCache. BatchResult.CacheHit tells which vectors came
+// from a cache.
+func WithExternalCache(cache ExternalCache) Option {
+	return func(v *Vectorizer) {
+		v.externalCache = cache
+	}
+}
+
+// WithModelCacheInvalidation removes the cached vectors of WithVectorCache and WithDedupWindow whenever the model that
+// OpenAI reports in its responses changes, for example because a model was silently updated to a new snapshot. This
+// keeps vectors of different model versions from ending up in the same index.
+func WithModelCacheInvalidation() Option {
+	return func(v *Vectorizer) {
+		v.modelCacheInvalidation = true
+	}
+}
+
+// DimensionMismatch decides what happens to vectors that have more dimensions than requested with the dimensions
+// setting
+type DimensionMismatch int
+
+const (
+	// DimensionMismatchFail fails the object with ErrDimensionMismatch
+	DimensionMismatchFail DimensionMismatch = iota
+	// DimensionMismatchTruncate shortens the vector to the requested dimensions and normalizes it again, which is what
+	// OpenAI does for the text-embedding-3 models
+	DimensionMismatchTruncate
+)
+
+// WithDimensionMismatch configures how vectors are handled that have more dimensions than requested. Vectors with
+// fewer dimensions than requested always fail with ErrDimensionMismatch.
+func WithDimensionMismatch(handling DimensionMismatch) Option {
+	return func(v *Vectorizer) {
+		v.dimensionMismatch = handling
+	}
+}
+
+// WithModelLimits seeds the rate limits of the batch worker with the per-minute quotas of the model of the first batch
+// instead of sending a single object first to discover them. Models that are missing in limits get conservative
+// default quotas and a warning is logged. The rate limits reported by OpenAI replace the seeded ones with every
+// response. See DefaultModelLimits for the quotas of the first usage tier.
+func WithModelLimits(limits map[string]ModelLimits) Option {
+	return func(v *Vectorizer) {
+		v.modelLimits = limits
+	}
+}
+
+// WithMaxObjectsPerRequest limits the number of inputs of a single request to OpenAI, regardless of how many more
+// would fit into the token budget. Classes with many small objects otherwise end up with requests that OpenAI rejects
+// for having too many inputs. The default is MaxObjectsPerBatch.
+func WithMaxObjectsPerRequest(maxObjects int) Option {
+	return func(v *Vectorizer) {
+		v.maxObjectsPerRequest = maxObjects
+	}
+}
+
+// WithOnBatchComplete calls onBatchComplete with a summary of every batch call once its results are known, e.g. to log
+// a single line per batch. This is cheaper than WithMetrics and WithEventSink, which report every request and object.
+func WithOnBatchComplete(onBatchComplete func(BatchStats)) Option {
+	return func(v *Vectorizer) {
+		v.onBatchComplete = onBatchComplete
+	}
+}
+
+// WithoutRateLimit turns off the rate limit handling for servers without rate limits, such as self-hosted OpenAI
+// compatible embedding servers. The objects of a batch are sent in requests of WithMaxObjectsPerRequest objects right
+// after each other, instead of splitting them by the token limits and waiting for the limits to refresh. The batch
+// time and the deadline of the context still apply.
+func WithoutRateLimit() Option {
+	return func(v *Vectorizer) {
+		v.disableRateLimit = true
+	}
+}
+
+// TokenCounter returns the number of tokens of the input text for the model setting of the class, see WithTokenCounter
+type TokenCounter func(text string, model string) int
+
+// WithTokenCounter replaces the built-in token estimate of the inputs of a batch with counter. The token counts decide
+// how inputs are split into requests so they fit into the rate limits, and they are reported with the results. By
+// default the tiktoken encoding of the model plus a fixed overhead per input is used.
+func WithTokenCounter(counter TokenCounter) Option {
+	return func(v *Vectorizer) {
+		v.tokenCounter = counter
+	}
+}
+
+// WithRequestTimeout aborts every single request to OpenAI that takes longer than timeout, so a hung request doesn't
+// use up the whole batch time. The objects of an aborted request fail with ErrRequestTimeout unless the request is
+// retried with retries, the other requests of the batch are not affected. Retries are only attempted if they fit into
+// the batch time and the context deadline.
+func WithRequestTimeout(timeout time.Duration, retries RetryConfig) Option {
+	return func(v *Vectorizer) {
+		v.requestTimeout = timeout
+		v.requestTimeoutRetries = retries
+	}
+}
+
+// WithCircuitBreaker fails fast once failures consecutive requests to OpenAI failed, e.g. because it is down, instead
+// of letting every request of a large import time out one after the other. The remaining objects of the batch and all
+// objects of further batches within the cooldown fail with ErrCircuitOpen without being sent. After the cooldown a
+// single probe request of at most probeSize inputs (1 if probeSize is 0) is sent, which closes the breaker if it
+// succeeds and opens it again for another cooldown if it fails. The other inputs of the request follow the probe once
+// it closed the breaker. Requests that fail because their batch ends or with an error that fails the whole batch anyway
+// don't count.
+func WithCircuitBreaker(failures int, cooldown time.Duration, probeSize int) Option {
+	return func(v *Vectorizer) {
+		if probeSize <= 0 {
+			probeSize = 1
+		}
+		v.breaker = &circuitBreaker{threshold: failures, cooldown: cooldown, probeSize: probeSize}
+	}
+}
+
+// WithPreprocess applies preprocess to every assembled input of an object right before it is tokenized and sent, e.g.
+// to strip markdown or URLs. With sections it is applied to every section. It runs after normalizeInput, and inputs
+// that are empty afterwards are treated like objects without any text. Queries are not preprocessed.
+func WithPreprocess(preprocess func(string) string) Option {
+	return func(v *Vectorizer) {
+		v.preprocess = preprocess
+	}
+}
+
+// WithHighPrecision keeps the vectors of ObjectBatchHighPrecision in the full precision of the responses of OpenAI
+// instead of rounding them to float32 like for HNSW. The responses of these batches are decoded twice.
+func WithHighPrecision() Option {
+	return func(v *Vectorizer) {
+		v.highPrecision = true
+	}
+}
+
+// WithDeadlineGrace lets a request to OpenAI that is in flight when the context deadline of its batch passes finish
+// within grace, instead of cancelling it and losing the tokens it already used. The vectors of requests that finish
+// are always part of the results, only objects that were not sent before the deadline fail. Cancelling the context of
+// a batch still cancels its requests right away.
+func WithDeadlineGrace(grace time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.deadlineGrace = grace
+	}
+}
+
+// WithRateLimitLanes processes the batches of different accounts concurrently, each with its own rate limits, instead
+// of one after the other. Accounts are told apart by the API key, the organization, the project and the endpoint of
+// the requests (see AccountKeyer), so batches of classes that use the same account still share its rate limits and
+// queue behind each other.
+func WithRateLimitLanes() Option {
+	return func(v *Vectorizer) {
+		v.rateLimitLanes = true
+	}
+}
+
+// WithQueryBatchTime sets the maximum batch time for calls of kind CallKindQuery (see ContextWithCallKind). Queries
+// are usually latency sensitive and should rather fail than wait for rate limits for a long time. Import calls keep
+// using the batch time passed to New.
+func WithQueryBatchTime(maxBatchTime time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.queryBatchTime = maxBatchTime
+	}
+}
+
+// WithEventSink sends an ObjectEvent for every object of every batch to sink. Events are buffered for up to
+// bufferSize events and dropped if the sink falls behind, so a slow sink never blocks vectorization.
+func WithEventSink(sink EventSink, bufferSize int) Option {
+	return func(v *Vectorizer) {
+		v.eventSink = sink
+		v.eventBufferSize = bufferSize
+	}
+}
+
+// WithDedupWindow reuses the vectors of inputs that were vectorized less than window ago, also if they were part of
+// an earlier batch. This avoids vectorizing duplicates again that are common in consecutive batches of a streaming
+// import. At most size inputs are remembered. In contrast to WithVectorCache the vectors are never compressed.
+func WithDedupWindow(size int, window time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.dedupWindow = newVectorCache(size, false, window)
+	}
+}
+
+// WithMetrics records the number of objects and tokens of every request to the vectorizer in metrics
+func WithMetrics(metrics *Metrics) Option {
+	return func(v *Vectorizer) {
+		v.metrics = metrics
+	}
+}
+
+// WithTenantUsage attributes the tokens of all requests to the tenants of the objects in usage. Requests still mix
+// objects of different tenants, so batching is as efficient as without attribution. The tenant of an object is its
+// own tenant or the tenant of the class config if the object has none.
+func WithTenantUsage(usage *TenantUsage) Option {
+	return func(v *Vectorizer) {
+		v.tenantUsage = usage
+	}
+}
+
+// WithBatchRetry vectorizes a whole batch once more after backoff if all of its objects failed with retryable errors,
+// for example because the account is rate limited or the API cannot be reached. This comes on top of the retries of
+// single requests, like WithOverloadRetries.
+func WithBatchRetry(backoff time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.batchRetryBackoff = backoff
+	}
+}
+
+// WithMaxInFlightTokens limits the total number of tokens of all requests to the vectorizer that are in flight at the
+// same time, across batches and single objects. Requests wait until their tokens fit into the limit, so fewer large
+// requests or more small requests run concurrently.
+func WithMaxInFlightTokens(maxTokens int64) Option {
+	return func(v *Vectorizer) {
+		v.maxInFlightTokens = maxTokens
+		v.inFlightTokens = semaphore.NewWeighted(maxTokens)
+	}
+}
+
+// WithProactivePacing spaces out the requests of a batch once the remaining token budget falls below threshold, a
+// fraction of the token limit between 0 and 1. The lower the budget gets, the longer the pause between requests, so
+// batches glide into the reset of the token limit instead of running into it. Pauses are only taken if they fit into
+// the batch time.
+func WithProactivePacing(threshold float64) Option {
+	return func(v *Vectorizer) {
+		v.pacingThreshold = threshold
+	}
+}
+
+// WithRateLimitJitter lengthens every wait for a rate limit reset by a random fraction of up to jitter, e.g. 0.2 for up
+// to 20%. Nodes that share an account and run into its limits at the same time then don't all send their next
+// requests at the same time again. Jitter never pushes a wait past the context deadline or the batch time.
+func WithRateLimitJitter(jitter float64) Option {
+	return func(v *Vectorizer) {
+		v.rateLimitJitter = jitter
+	}
+}
+
+// WithMaxBatchDuration caps the total time of a single batch call, including the time it waits in the queue, for rate
+// limits and for retries, independently of the deadline of its context. Objects that are not vectorized once the
+// duration has passed fail with ErrBatchTimeBudgetExceeded, so callers can fail fast and requeue them.
+func WithMaxBatchDuration(maxDuration time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.maxBatchDuration = maxDuration
+	}
+}
+
+// WithMinRequestInterval spaces out the requests of a batch so that at least interval passes between the starts of two
+// of its requests, regardless of the remaining rate limits. This avoids bursts of requests that trip the burst
+// protection of some providers. The waits count towards the batch time, objects whose request can't wait within the
+// batch time fail.
+func WithMinRequestInterval(interval time.Duration) Option {
+	return func(v *Vectorizer) {
+		v.minRequestInterval = interval
+	}
+}
+
+// WithWaitLogSampling only logs one in rate waits for rate limits, so large imports don't flood the logs. The first
+// wait is always logged and every log entry contains the number and total duration of the waits since the previous
+// entry. By default every wait is logged.
+func WithWaitLogSampling(rate int) Option {
+	return func(v *Vectorizer) {
+		v.waitLogRate = rate
+	}
+}
+
+// WithAssemblyPrefetch assembles and tokenizes the inputs of a batch in the background while its first requests are
+// already being sent, which overlaps the CPU work of large batches with waiting for OpenAI. Requests and results are
+// the same as without prefetching. Batches that use a cache (see WithVectorCache, WithDedupWindow and
+// WithExternalCache), a sectionDelimiter or the combineStrategy average need all inputs upfront and are not
+// prefetched.
+func WithAssemblyPrefetch() Option {
+	return func(v *Vectorizer) {
+		v.assemblyPrefetch = true
+	}
+}
+
+// WithSmallBatchFastPath processes batches with at most maxObjects (non-skipped) objects directly on the calling go
+// routine instead of queueing them for the batch worker. This only happens if no other batch is queued or in progress,
+// so rate limits, ordering and errors are the same as on the queued path.
+func WithSmallBatchFastPath(maxObjects int) Option {
+	return func(v *Vectorizer) {
+		v.smallBatchSize = maxObjects
+	}
+}
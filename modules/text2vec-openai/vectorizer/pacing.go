@@ -0,0 +1,83 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// errRequestIntervalTimeout fails the objects of a batch whose next request can't wait for the minimum request
+// interval within the batch time, see WithMinRequestInterval
+var errRequestIntervalTimeout = errors.New("minimum request interval does not fit into the batch time")
+
+// pacingDelay returns how long to wait before the next vectorizer-batch if pacing is enabled with
+// WithProactivePacing. Once the remaining token budget falls below threshold (as a fraction of the token limit), the
+// delay grows linearly from zero at the threshold to the full time until the token limit resets at an empty budget.
+func pacingDelay(rateLimit *ent.RateLimits, threshold float64) time.Duration {
+	if threshold <= 0 || rateLimit == nil || rateLimit.LimitTokens <= 0 || rateLimit.ResetTokens <= 0 {
+		return 0
+	}
+
+	remaining := float64(rateLimit.RemainingTokens) / float64(rateLimit.LimitTokens)
+	if remaining >= threshold {
+		return 0
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := time.Duration(rateLimit.ResetTokens) * time.Second
+	return time.Duration(float64(reset) * (threshold - remaining) / threshold)
+}
+
+// jitterRateLimitWait lengthens a wait of the job for a rate limit reset by the jitter of WithRateLimitJitter, as far
+// as both the context deadline and the batch time of the job allow
+func (v *Vectorizer) jitterRateLimitWait(job batchJob, wait time.Duration) time.Duration {
+	available := job.maxBatchTime - time.Since(job.startTime)
+	if deadline, ok := job.ctx.Deadline(); ok {
+		available = min(available, time.Until(deadline))
+	}
+	return jitterWait(wait, v.rateLimitJitter, available)
+}
+
+// jitterWait lengthens wait by a random fraction of up to jitter, but not beyond available. Waits are never shortened,
+// so a wait that is longer than available already is returned as is.
+func jitterWait(wait time.Duration, jitter float64, available time.Duration) time.Duration {
+	if jitter <= 0 || wait <= 0 {
+		return wait
+	}
+	jittered := wait + time.Duration(rand.Float64()*jitter*float64(wait))
+	return max(wait, min(jittered, available))
+}
+
+// awaitRequestInterval waits until the minimum request interval (see WithMinRequestInterval) passed since the
+// previous request of the job. A zero previous request means there was none. It returns false without waiting if the
+// wait doesn't fit into the batch time.
+func (v *Vectorizer) awaitRequestInterval(job batchJob, previous time.Time) bool {
+	if v.minRequestInterval <= 0 || previous.IsZero() {
+		return true
+	}
+	wait := v.minRequestInterval - time.Since(previous)
+	if wait <= 0 {
+		return true
+	}
+	if time.Since(job.startTime)+wait > job.maxBatchTime {
+		return false
+	}
+	// a cancelled context fails the request right away
+	sleepWithContext(job.ctx, wait)
+	return true
+}
@@ -0,0 +1,84 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+func TestPacingDelay(t *testing.T) {
+	rateLimit := func(remaining int) *ent.RateLimits {
+		return &ent.RateLimits{RemainingTokens: remaining, LimitTokens: 1000, ResetTokens: 10}
+	}
+
+	t.Run("no delay above the threshold", func(t *testing.T) {
+		assert.Zero(t, pacingDelay(rateLimit(1000), 0.5))
+		assert.Zero(t, pacingDelay(rateLimit(500), 0.5))
+		assert.Zero(t, pacingDelay(rateLimit(0), 0))
+		assert.Zero(t, pacingDelay(&ent.RateLimits{RemainingTokens: 0, LimitTokens: 1000}, 0.5))
+	})
+
+	t.Run("delay grows smoothly below the threshold", func(t *testing.T) {
+		previous := time.Duration(0)
+		for remaining := 490; remaining >= 0; remaining -= 10 {
+			delay := pacingDelay(rateLimit(remaining), 0.5)
+			assert.Greater(t, delay, previous, "remaining tokens: %d", remaining)
+			// every step of 10 tokens adds the same 200ms, there are no jumps
+			assert.InDelta(t, 200*time.Millisecond, delay-previous, float64(time.Millisecond), "remaining tokens: %d", remaining)
+			previous = delay
+		}
+		assert.Equal(t, 10*time.Second, previous)
+		assert.Equal(t, 10*time.Second, pacingDelay(rateLimit(-5), 0.5))
+	})
+}
+
+func TestRateLimitJitter(t *testing.T) {
+	t.Run("waits are lengthened by up to the jitter", func(t *testing.T) {
+		wait := 10 * time.Second
+		lengthened := false
+		for i := 0; i < 1000; i++ {
+			jittered := jitterWait(wait, 0.2, time.Minute)
+			assert.GreaterOrEqual(t, jittered, wait)
+			assert.LessOrEqual(t, jittered, 12*time.Second)
+			lengthened = lengthened || jittered > wait
+		}
+		assert.True(t, lengthened)
+	})
+
+	t.Run("jitter stays within the available time", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			assert.LessOrEqual(t, jitterWait(10*time.Second, 1, 11*time.Second), 11*time.Second)
+		}
+		// waits are never shortened
+		assert.Equal(t, 10*time.Second, jitterWait(10*time.Second, 1, 5*time.Second))
+		assert.Equal(t, 10*time.Second, jitterWait(10*time.Second, 0, time.Minute))
+	})
+
+	t.Run("jitter never passes the context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 11*time.Second)
+		defer cancel()
+		job := batchJob{ctx: ctx, startTime: time.Now(), maxBatchTime: time.Minute}
+		v := &Vectorizer{rateLimitJitter: 1}
+
+		for i := 0; i < 1000; i++ {
+			jittered := v.jitterRateLimitWait(job, 10*time.Second)
+			assert.GreaterOrEqual(t, jittered, 10*time.Second)
+			assert.LessOrEqual(t, jittered, 11*time.Second)
+		}
+	})
+}
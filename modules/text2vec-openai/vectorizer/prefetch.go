@@ -0,0 +1,88 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import "sync"
+
+// assembly tracks how many inputs of a batch have been assembled in the background, see WithAssemblyPrefetch. The
+// inputs are assembled in order, so all inputs before done are ready. A nil assembly means that all inputs were
+// assembled before the batch was dispatched.
+type assembly struct {
+	sync.Mutex
+	cond  *sync.Cond
+	done  int
+	total int
+	// err fails all objects of the batch, e.g. if the tokenizer of the model cannot be loaded
+	err error
+	// objectErrs fails single objects, e.g. if their input is too long
+	objectErrs map[int]error
+}
+
+func newAssembly(total int) *assembly {
+	a := &assembly{total: total}
+	a.cond = sync.NewCond(&a.Mutex)
+	return a
+}
+
+func (a *assembly) advance(done int) {
+	a.Lock()
+	if done > a.done {
+		a.done = done
+	}
+	a.Unlock()
+	a.cond.Broadcast()
+}
+
+func (a *assembly) failObject(index int, err error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.objectErrs == nil {
+		a.objectErrs = make(map[int]error)
+	}
+	a.objectErrs[index] = err
+}
+
+func (a *assembly) fail(err error) {
+	a.Lock()
+	a.err = err
+	a.done = a.total
+	a.Unlock()
+	a.cond.Broadcast()
+}
+
+// wait blocks until the input at index is assembled and returns the error of the assembly, if any
+func (a *assembly) wait(index int) error {
+	if a == nil {
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	for a.done <= index {
+		a.cond.Wait()
+	}
+	if a.err != nil {
+		return a.err
+	}
+	return a.objectErrs[index]
+}
+
+// waitAll blocks until the background assembly is finished
+func (a *assembly) waitAll() {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	for a.done < a.total {
+		a.cond.Wait()
+	}
+	a.Unlock()
+}
@@ -0,0 +1,147 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	enterrors "github.com/weaviate/weaviate/entities/errors"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/entities/moduletools"
+)
+
+// propertyModelConfig is the class config of the properties that propertyModels routes to the same model. The
+// properties that are not routed to any model belong to the config with an empty model, which vectorizes them with
+// the model of the class.
+type propertyModelConfig struct {
+	moduletools.ClassConfig
+	model          string
+	propertyModels map[string]string
+}
+
+// Class returns the settings of the class with the model of the routed properties. The model specific settings of the
+// class don't apply to other models.
+func (c propertyModelConfig) Class() map[string]interface{} {
+	class := make(map[string]interface{}, len(c.ClassConfig.Class()))
+	for name, value := range c.ClassConfig.Class() {
+		class[name] = value
+	}
+	delete(class, "propertyModels")
+	if c.model != "" {
+		class["model"] = c.model
+		delete(class, "modelVersion")
+		delete(class, "dimensions")
+		delete(class, "fallbackModels")
+	}
+	return class
+}
+
+// PropertyNames returns the schema order of the properties of the class, see SchemaPropertyNames
+func (c propertyModelConfig) PropertyNames() []string {
+	return NewClassSettings(c.ClassConfig).SchemaPropertyNames()
+}
+
+// routes returns whether the property is vectorized with the model of the config
+func (c propertyModelConfig) routes(propName string) bool {
+	return c.propertyModels[propName] == c.model
+}
+
+// routedSkipObject returns a copy of the skip list in which all objects without a property that is routed to the model
+// of the config are skipped, so they don't fall back to the class name
+func (c propertyModelConfig) routedSkipObject(objects []*models.Object, skipObject []bool) []bool {
+	skip := append([]bool{}, skipObject...)
+	for i := range objects {
+		if skip[i] || objects[i] == nil {
+			continue
+		}
+		properties, _ := objects[i].Properties.(map[string]interface{})
+		skip[i] = true
+		for propName := range properties {
+			if c.routes(propName) {
+				skip[i] = false
+				break
+			}
+		}
+	}
+	return skip
+}
+
+// routesAllProperties returns whether every property of the schema is vectorized with another model than the model of
+// the class. The objects then have no vector of the class model.
+func (c propertyModelConfig) routesAllProperties() bool {
+	names := NewClassSettings(c.ClassConfig).SchemaPropertyNames()
+	for _, name := range names {
+		if c.propertyModels[name] == "" {
+			return false
+		}
+	}
+	return len(names) > 0
+}
+
+// namedVectors vectorizes the routed properties of all objects with their models, see propertyModels, and adds the
+// vectors to the results keyed by the model. Every model is vectorized in its own batch with its own rate limits. An
+// object fails if it fails for any of the models.
+func (v *Vectorizer) namedVectors(ctx context.Context, objects []*models.Object, skipObject []bool,
+	cfg propertyModelConfig, results []BatchResult,
+) {
+	var routedModels []string
+	for _, model := range cfg.propertyModels {
+		if !slices.Contains(routedModels, model) {
+			routedModels = append(routedModels, model)
+		}
+	}
+	slices.Sort(routedModels)
+
+	type modelBatch struct {
+		vecs   [][]float32
+		errs   map[int]error
+		tokens []int
+	}
+	batches := make([]modelBatch, len(routedModels))
+	wg := sync.WaitGroup{}
+	for i, model := range routedModels {
+		i, routed := i, propertyModelConfig{ClassConfig: cfg.ClassConfig, model: model, propertyModels: cfg.propertyModels}
+		wg.Add(1)
+		enterrors.GoWrapper(func() {
+			defer wg.Done()
+			vecs, errs, tokens, _, _, _ := v.objectBatch(ctx, objects, routed.routedSkipObject(objects, skipObject), routed, nil)
+			batches[i] = modelBatch{vecs: vecs, errs: errs, tokens: tokens}
+		}, v.logger)
+	}
+	wg.Wait()
+
+	for i, model := range routedModels {
+		for j := range results {
+			if skipObject[j] {
+				continue
+			}
+			if err := batches[i].errs[j]; err != nil {
+				if results[j].Err == nil {
+					results[j].Err = fmt.Errorf("vectorize with model %s: %w", model, err)
+				}
+				continue
+			}
+			if batches[i].vecs != nil && batches[i].vecs[j] != nil {
+				if results[j].NamedVectors == nil {
+					results[j].NamedVectors = make(map[string][]float32, len(routedModels))
+				}
+				results[j].NamedVectors[model] = batches[i].vecs[j]
+			}
+			if batches[i].tokens != nil {
+				results[j].Tokens += batches[i].tokens[j]
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// schemaClassConfig is a class config that knows the properties of the schema
+type schemaClassConfig struct {
+	fakeClassConfig
+	propertyNames []string
+}
+
+func (c schemaClassConfig) PropertyNames() []string {
+	return c.propertyNames
+}
+
+func TestBatchPropertyModels(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	classConfig := map[string]interface{}{
+		"vectorizeClassName": false,
+		"propertyModels":     map[string]interface{}{"code": "babbage", "prose": "Curie"},
+	}
+	objects := []*models.Object{
+		{Class: "Snippet", Properties: map[string]interface{}{"code": "func main()", "prose": "entry point", "title": "main"}},
+		{Class: "Snippet", Properties: map[string]interface{}{"code": "error broken", "prose": "fails", "title": "broken"}},
+		{Class: "Snippet", Properties: map[string]interface{}{"prose": "no code", "title": "prose only"}},
+	}
+	skip := make([]bool, len(objects))
+
+	client := &fakeBatchClient{echoVectors: true}
+	v := New(client, 40*time.Second, logger)
+	results := v.ObjectBatchResults(context.Background(), objects, skip, &fakeClassConfig{classConfig: classConfig})
+
+	// the properties that are not routed are vectorized with the model of the class
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, echoVector("main"), results[0].Vector)
+	assert.Equal(t, map[string][]float32{
+		"babbage": echoVector("func main()"),
+		"curie":   echoVector("entry point"),
+	}, results[0].NamedVectors)
+	assert.Greater(t, results[0].Tokens, 0)
+
+	// an object fails if it fails for any model
+	require.Error(t, results[1].Err)
+	assert.Equal(t, "vectorize with model babbage: broken", results[1].Err.Error())
+
+	// objects without a routed property have no named vector of its model
+	require.NoError(t, results[2].Err)
+	assert.Equal(t, map[string][]float32{"curie": echoVector("no code")}, results[2].NamedVectors)
+
+	// every request only contains the inputs of a single model
+	client.Lock()
+	history, requestModels := client.history, client.requestModels
+	client.Unlock()
+	inputs := map[string][]string{}
+	for i := range history {
+		inputs[requestModels[i]] = append(inputs[requestModels[i]], history[i]...)
+	}
+	assert.ElementsMatch(t, []string{"main", "broken", "prose only"}, inputs[DefaultOpenAIModel])
+	assert.ElementsMatch(t, []string{"func main()", "error broken"}, inputs["babbage"])
+	assert.ElementsMatch(t, []string{"entry point", "fails", "no code"}, inputs["curie"])
+
+	t.Run("no vector of the class model if all properties are routed", func(t *testing.T) {
+		client := &fakeBatchClient{echoVectors: true}
+		cfg := schemaClassConfig{
+			fakeClassConfig: fakeClassConfig{classConfig: map[string]interface{}{
+				"vectorizeClassName": false,
+				"propertyModels":     map[string]interface{}{"code": "babbage", "prose": "curie"},
+			}},
+			propertyNames: []string{"code", "prose"},
+		}
+		results := New(client, 40*time.Second, logger).ObjectBatchResults(context.Background(), objects[:1], skip[:1], cfg)
+
+		require.NoError(t, results[0].Err)
+		assert.Nil(t, results[0].Vector)
+		assert.Len(t, results[0].NamedVectors, 2)
+		assert.NotContains(t, client.requestModels, DefaultOpenAIModel)
+	})
+}
@@ -0,0 +1,163 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// BatchResult is the outcome of vectorizing a single object of a batch
+type BatchResult struct {
+	// Index is the index of the object in the batch
+	Index  int
+	Vector []float32
+	Err    error
+	// Tokens is the estimated number of tokens that the input of the object consumed. It is 0 for skipped and failed
+	// objects and for objects whose vector came from a cache (see WithVectorCache).
+	Tokens int
+	// Fingerprint is a stable hash of Vector that can be used to detect no-op updates. It is only set if enabled with
+	// WithVectorFingerprints.
+	Fingerprint string
+	// DeadlineConsumed is the fraction of the effective deadline of the call that had passed when the batch finished.
+	// The effective deadline is the earlier of the context deadline and the maximum batch time. Values close to or
+	// above 1 mean the call ran at the edge of its deadline.
+	DeadlineConsumed float64
+	// Sections holds one vector per section of the input in section order if the class has a sectionDelimiter, or one
+	// vector per property with the combineStrategy average. Vector is then the normalized mean of the section vectors.
+	Sections [][]float32
+	// Metadata is the caller-provided metadata of the object, see ObjectBatchWithMetadata
+	Metadata interface{}
+	// NamedVectors holds the vectors of the properties that propertyModels routes to other models than the model of
+	// the class, keyed by the model. Vector then only covers the remaining properties, it is nil if all properties
+	// of the schema are routed.
+	NamedVectors map[string][]float32
+	// CacheHit is set if Vector came from a cache instead of a request to OpenAI, see WithVectorCache,
+	// WithDedupWindow and WithExternalCache
+	CacheHit bool
+	// Model is the model that produced Vector. It is one of the fallbackModels of the class if the model of the class
+	// is not available, vectors of fallback models are not cached.
+	Model string
+	// SkipReason tells why the object was not vectorized with a request of its own, SkipReasonNone if it was
+	// vectorized or failed
+	SkipReason SkipReason
+}
+
+// SkipReason tells why the vectorizer didn't send the input of an object to OpenAI, see BatchResult.SkipReason
+type SkipReason int
+
+const (
+	SkipReasonNone SkipReason = iota
+	// SkipReasonCallerRequested objects were skipped with the skip list of the caller
+	SkipReasonCallerRequested
+	// SkipReasonEmptyInput objects had nothing to vectorize, see vectorizeEmptyObjects
+	SkipReasonEmptyInput
+	// SkipReasonCacheHit objects got their vector from a cache, see BatchResult.CacheHit
+	SkipReasonCacheHit
+	// SkipReasonDedupeAlias objects got the vector of an earlier object of the batch with the same input, see
+	// dedupeInputs
+	SkipReasonDedupeAlias
+)
+
+// checkSkipObject returns an error matching ErrSkipObjectMismatch if skipObject isn't parallel to the objects
+func checkSkipObject(objects []*models.Object, skipObject []bool) error {
+	if len(skipObject) != len(objects) {
+		return fmt.Errorf("%w: got %d entries for %d objects", ErrSkipObjectMismatch, len(skipObject), len(objects))
+	}
+	return nil
+}
+
+// mismatchResults fails all objects of a batch with the error of checkSkipObject, which leaves no skip list to tell
+// skipped objects apart
+func mismatchResults(objects []*models.Object, err error) []BatchResult {
+	results := make([]BatchResult, len(objects))
+	for i := range results {
+		results[i].Index = i
+		results[i].Err = err
+	}
+	return results
+}
+
+// failedResults returns the results of a batch in which all objects that are not skipped fail with err
+func failedResults(skipObject []bool, err error) []BatchResult {
+	results := make([]BatchResult, len(skipObject))
+	for i := range results {
+		results[i].Index = i
+		if skipObject[i] {
+			results[i].SkipReason = SkipReasonCallerRequested
+		} else {
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+// setSkipReason sets the SkipReason of a result from the reason of the batch, which is SkipReasonNone for objects
+// whose empty input was skipped
+func setSkipReason(result *BatchResult, skipped bool, reason SkipReason) {
+	switch {
+	case skipped:
+		result.SkipReason = SkipReasonCallerRequested
+	case result.Err != nil:
+		result.SkipReason = SkipReasonNone
+	case reason != SkipReasonNone:
+		result.SkipReason = reason
+	case result.Vector == nil && len(result.NamedVectors) == 0:
+		result.SkipReason = SkipReasonEmptyInput
+	}
+}
+
+// finishResult sets the fields of a result that don't depend on how the object was vectorized and reports the object
+// to the event sink. Objects that failed report the tokens of their input as well.
+func (v *Vectorizer) finishResult(result *BatchResult, skipped bool, tokens int, consumed float64, duration time.Duration) {
+	result.DeadlineConsumed = consumed
+	if v.vectorFingerprints && result.Vector != nil {
+		result.Fingerprint = vectorFingerprint(result.Vector)
+	}
+	if v.events != nil {
+		v.events.emit(ObjectEvent{Index: result.Index, Skipped: skipped, Err: result.Err, Tokens: tokens, Duration: duration})
+	}
+}
+
+// vectorFingerprint hashes the little-endian IEEE 754 representation of all vector entries, so the same vector
+// produces the same fingerprint on every platform. Negative zero is hashed as zero, as both compare equal.
+func vectorFingerprint(vector []float32) string {
+	h := fnv.New64a()
+	buf := make([]byte, 4)
+	for _, f := range vector {
+		if f == 0 {
+			f = 0
+		}
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(f))
+		h.Write(buf)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// deadlineConsumed returns the fraction of the time between start and the effective deadline that has passed
+func deadlineConsumed(ctx context.Context, start time.Time, maxBatchTime time.Duration) float64 {
+	deadline := start.Add(maxBatchTime)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	budget := deadline.Sub(start)
+	if budget <= 0 {
+		return 1
+	}
+	return float64(time.Since(start)) / float64(budget)
+}
@@ -0,0 +1,257 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+func TestVectorFingerprint(t *testing.T) {
+	// fixed values guarantee that fingerprints are stable across runs and platforms
+	assert.Equal(t, "62552b9ea71e5908", vectorFingerprint([]float32{0, 1, 2, 3}))
+	assert.Equal(t, "0de852747100b196", vectorFingerprint([]float32{0.1, -0.5, 3.25}))
+
+	assert.Equal(t, vectorFingerprint([]float32{0.1, -0.5, 3.25}), vectorFingerprint([]float32{0.1, -0.5, 3.25}))
+	assert.Equal(t, vectorFingerprint([]float32{0, 1}), vectorFingerprint([]float32{float32(math.Copysign(0, -1)), 1}))
+	assert.NotEqual(t, vectorFingerprint([]float32{0, 1}), vectorFingerprint([]float32{1, 0}))
+}
+
+func TestBatchResultsFingerprints(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "second"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}
+	skip := []bool{false, false, false, true}
+
+	t.Run("enabled", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithVectorFingerprints())
+
+		results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+		require.Len(t, results, len(objects))
+		// the fake client returns the same vector for every object
+		assert.Equal(t, vectorFingerprint([]float32{0, 1, 2, 3}), results[0].Fingerprint)
+		assert.Equal(t, results[0].Fingerprint, results[1].Fingerprint)
+		assert.Error(t, results[2].Err)
+		assert.Empty(t, results[2].Fingerprint)
+		assert.Nil(t, results[3].Vector)
+		assert.Empty(t, results[3].Fingerprint)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		v := New(&fakeBatchClient{}, 40*time.Second, logger)
+
+		results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+		require.Len(t, results, len(objects))
+		assert.NotNil(t, results[0].Vector)
+		assert.Empty(t, results[0].Fingerprint)
+	})
+}
+
+func TestBatchResultsDeadlineConsumed(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "wait 50"}},
+	}
+	skip := []bool{false}
+	v := New(&fakeBatchClient{}, time.Second, logger)
+
+	consumed := func(timeout time.Duration) float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		results := v.ObjectBatchResults(ctx, objects, skip, cfg)
+		require.NoError(t, results[0].Err)
+		return results[0].DeadlineConsumed
+	}
+
+	// the batch time is the effective deadline if it is earlier than the context deadline
+	loose := consumed(time.Minute)
+	assert.Greater(t, loose, 0.0)
+	assert.Less(t, loose, 1.0)
+
+	tight := consumed(250 * time.Millisecond)
+	assert.Greater(t, tight, loose)
+	assert.Less(t, tight, 1.0)
+}
+
+func TestBatchResultsMetadata(t *testing.T) {
+	type rowMetadata struct {
+		row  int
+		text string
+	}
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{echoVectors: true}
+	v := New(client, 40*time.Second, logger, WithVectorCache(10, false))
+
+	// the cached object is not sent again, so the remaining objects are dispatched in a different order
+	_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "cached"}},
+	}, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "cached"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "last"}},
+	}
+	metadata := []interface{}{
+		rowMetadata{row: 10, text: "first"},
+		rowMetadata{row: 11, text: "cached"},
+		rowMetadata{row: 12},
+		rowMetadata{row: 13},
+		rowMetadata{row: 14, text: "last"},
+	}
+	results := v.ObjectBatchWithMetadata(context.Background(), objects, []bool{false, false, true, false, false}, metadata, cfg)
+	require.Len(t, results, len(objects))
+	requests := client.requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, []string{"first", "error something", "last"}, requests[1])
+
+	for i := range results {
+		meta, ok := results[i].Metadata.(rowMetadata)
+		require.True(t, ok)
+		assert.Equal(t, 10+i, meta.row)
+		if meta.text != "" {
+			assert.Equal(t, echoVector(meta.text), results[i].Vector)
+		} else {
+			assert.Nil(t, results[i].Vector)
+		}
+	}
+	assert.Error(t, results[3].Err)
+
+	t.Run("without metadata", func(t *testing.T) {
+		results := v.ObjectBatchWithMetadata(context.Background(), objects[:2], []bool{false, false}, nil, cfg)
+		require.Len(t, results, 2)
+		for i := range results {
+			assert.NoError(t, results[i].Err)
+			assert.Nil(t, results[i].Metadata)
+		}
+	})
+
+	t.Run("metadata of a different length", func(t *testing.T) {
+		results := v.ObjectBatchWithMetadata(context.Background(), objects, []bool{false, false, false, false, false}, metadata[:2], cfg)
+		require.Len(t, results, len(objects))
+		for i := range results {
+			assert.EqualError(t, results[i].Err, "got metadata for 2 objects, expected 5")
+		}
+	})
+}
+
+func TestBatchResultsTokens(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "first"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "a somewhat longer second text"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+	}
+	skip := []bool{false, false, false, true}
+	tke, err := tokenEncoder(DefaultOpenAIModel)
+	require.NoError(t, err)
+
+	v := New(&fakeBatchClient{}, 40*time.Second, logger, WithVectorCache(10, false))
+	results := v.ObjectBatchResults(context.Background(), objects, skip, cfg)
+
+	require.Len(t, results, len(objects))
+	assert.Equal(t, clients.GetTokensCount(DefaultOpenAIModel, "first", tke), results[0].Tokens)
+	assert.Equal(t, clients.GetTokensCount(DefaultOpenAIModel, "a somewhat longer second text", tke), results[1].Tokens)
+	assert.Greater(t, results[1].Tokens, results[0].Tokens)
+	require.Error(t, results[2].Err)
+	assert.Zero(t, results[2].Tokens)
+	assert.Zero(t, results[3].Tokens)
+
+	t.Run("cached vectors don't consume tokens", func(t *testing.T) {
+		results := v.ObjectBatchResults(context.Background(), objects[:2], skip[:2], cfg)
+		require.NoError(t, results[0].Err)
+		assert.NotNil(t, results[0].Vector)
+		assert.Zero(t, results[0].Tokens)
+		assert.Zero(t, results[1].Tokens)
+	})
+}
+
+func TestBatchResultsSkipReasons(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{
+		"vectorizeClassName": false, "dedupeInputs": true,
+	}}
+	logger, _ := test.NewNullLogger()
+	v := New(&fakeBatchClient{}, 40*time.Second, logger, WithVectorCache(10, false))
+	require.Equal(t, SkipReasonNone, v.ObjectBatchResults(context.Background(), []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "cached"}},
+	}, []bool{false}, cfg)[0].SkipReason)
+
+	objects := []*models.Object{
+		{Class: "Car", Properties: map[string]interface{}{"test": "cached"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fresh"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "fresh"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": " "}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "skipped"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+		{Class: "Car", Properties: map[string]interface{}{"test": "error something"}},
+	}
+	results := v.ObjectBatchResults(context.Background(), objects, []bool{false, false, false, false, true, false, false}, cfg)
+
+	reasons := make([]SkipReason, len(results))
+	for i := range results {
+		reasons[i] = results[i].SkipReason
+	}
+	assert.Equal(t, []SkipReason{
+		SkipReasonCacheHit,
+		SkipReasonNone,
+		SkipReasonDedupeAlias,
+		SkipReasonEmptyInput,
+		SkipReasonCallerRequested,
+		// failed objects have no reason, even if they are duplicates
+		SkipReasonNone,
+		SkipReasonNone,
+	}, reasons)
+	assert.True(t, results[0].CacheHit)
+	assert.NotNil(t, results[2].Vector)
+
+	t.Run("empty inputs that are assembled in the background", func(t *testing.T) {
+		cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+		v := New(&fakeBatchClient{}, 40*time.Second, logger, WithAssemblyPrefetch())
+
+		results := v.ObjectBatchResults(context.Background(), objects[1:4], []bool{false, false, false}, cfg)
+
+		assert.Equal(t, SkipReasonNone, results[0].SkipReason)
+		assert.Equal(t, SkipReasonNone, results[1].SkipReason)
+		assert.Equal(t, SkipReasonEmptyInput, results[2].SkipReason)
+	})
+
+	t.Run("failed batches", func(t *testing.T) {
+		ctx := ContextWithImportBudget(context.Background(), NewImportBudget(0))
+		results := v.ObjectBatchResults(ctx, objects[:2], []bool{true, false}, cfg)
+
+		assert.Equal(t, SkipReasonCallerRequested, results[0].SkipReason)
+		assert.Equal(t, SkipReasonNone, results[1].SkipReason)
+		assert.ErrorIs(t, results[1].Err, ErrImportTimeBudgetExceeded)
+	})
+}
@@ -0,0 +1,192 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// RetryConfig configures how often a failed request to the vectorizer is retried. The wait before the n-th retry is
+// BaseBackoff * 2^(n-1), capped at MaxBackoff if it is set.
+type RetryConfig struct {
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// backoff returns how long to wait before the given retry (starting at 0) and false if no retries are left
+func (c RetryConfig) backoff(retry int) (time.Duration, bool) {
+	if retry >= c.MaxRetries {
+		return 0, false
+	}
+	wait := c.BaseBackoff << retry
+	if c.MaxBackoff > 0 && (wait > c.MaxBackoff || wait < c.BaseBackoff) {
+		wait = c.MaxBackoff
+	}
+	return wait, true
+}
+
+// vectorize sends a single request to the vectorizer and retries it according to the retry policy of the error class
+// as long as the wait fits into both the context deadline and the batch time of the job.
+func (v *Vectorizer) vectorize(job batchJob, texts []string, conf ent.VectorizationConfig,
+) (*ent.VectorizationResult, *ent.RateLimits, error) {
+	for retry := 0; ; retry++ {
+		if v.metrics != nil {
+			v.metrics.observeAttempt(conf.Model, batchClassName(job.objects))
+		}
+		batchCountersFromContext(job.ctx).observeRequest()
+		v.usage.requests.Add(1)
+		ctx, cancel := v.requestContext(job.ctx)
+		res, rateLimit, err := v.client.Vectorize(ctx, texts, conf)
+		if err != nil && errors.Is(context.Cause(ctx), ErrRequestTimeout) {
+			err = fmt.Errorf("%w after %s: %v", ErrRequestTimeout, v.requestTimeout, err)
+		}
+		cancel()
+		if err == nil {
+			return res, rateLimit, nil
+		}
+
+		var wait time.Duration
+		var ok bool
+		switch {
+		case errors.Is(err, clients.ErrModelOverloaded), isServerError(err):
+			wait, ok = v.overloadRetries.backoff(retry)
+		case errors.Is(err, clients.ErrDNS):
+			wait, ok = v.dnsRetries.backoff(retry)
+		case errors.Is(err, ErrRequestTimeout):
+			wait, ok = v.requestTimeoutRetries.backoff(retry)
+		case errors.Is(err, clients.ErrMalformedResponse):
+			wait, ok = v.malformedResponseRetries.backoff(retry)
+		case errors.Is(err, clients.ErrRateLimited):
+			wait, ok = v.rateLimitRetries.backoff(retry)
+			if retryAfter, hasRetryAfter := clients.RetryAfter(err); ok && hasRetryAfter {
+				wait = retryAfter
+			}
+		}
+		if !ok || time.Since(job.startTime)+wait > job.maxBatchTime {
+			return res, rateLimit, err
+		}
+		if deadline, hasDeadline := job.ctx.Deadline(); hasDeadline && time.Now().Add(wait).After(deadline) {
+			return res, rateLimit, err
+		}
+		batchCountersFromContext(job.ctx).observeWait(wait)
+		if sleepWithContext(job.ctx, wait) != nil {
+			return res, rateLimit, err
+		}
+	}
+}
+
+// requestContext returns the context of a single request to the vectorizer, which ends with ErrRequestTimeout as its
+// cause once the timeout of WithRequestTimeout passes
+func (v *Vectorizer) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	requestCtx, cancel := v.graceContext(ctx)
+	if v.requestTimeout <= 0 {
+		return requestCtx, cancel
+	}
+	timeoutCtx, cancelTimeout := context.WithTimeoutCause(requestCtx, v.requestTimeout, ErrRequestTimeout)
+	return timeoutCtx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// graceContext returns the context of a single request to the vectorizer before its timeout. With WithDeadlineGrace a
+// request that is in flight when the deadline of ctx passes may still finish within the grace period. Cancelling ctx
+// still cancels the request right away.
+func (v *Vectorizer) graceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if v.deadlineGrace <= 0 || !ok {
+		return ctx, func() {}
+	}
+
+	requestCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline.Add(v.deadlineGrace))
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	return requestCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// isRetryable returns whether the request might succeed if it is sent again later
+func isRetryable(err error) bool {
+	if errors.Is(err, clients.ErrModelOverloaded) || errors.Is(err, clients.ErrDNS) ||
+		errors.Is(err, clients.ErrRateLimited) || errors.Is(err, ErrRequestTimeout) ||
+		errors.Is(err, clients.ErrMalformedResponse) {
+		return true
+	}
+	var provider *clients.ProviderError
+	return errors.As(err, &provider) && provider.Retryable()
+}
+
+// isTerminal returns whether all further requests would fail in the same way, so the batch can fail right away
+func isTerminal(err error) bool {
+	if errors.Is(err, clients.ErrMissingAPIKey) || errors.Is(err, clients.ErrQuotaExhausted) ||
+		errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var provider *clients.ProviderError
+	return errors.As(err, &provider) && provider.AuthFailure()
+}
+
+// isServerError returns whether OpenAI failed the request because of an error on its side (5xx)
+func isServerError(err error) bool {
+	var provider *clients.ProviderError
+	return errors.As(err, &provider) && provider.HTTPStatus >= http.StatusInternalServerError
+}
+
+// retryBatch returns whether the whole batch should be vectorized again, see WithBatchRetry. That is the case if all
+// objects that were not skipped failed with retryable errors and the backoff fits into the context deadline.
+func (v *Vectorizer) retryBatch(ctx context.Context, skipObject []bool, errs map[int]error) bool {
+	if v.batchRetryBackoff <= 0 {
+		return false
+	}
+	failed := false
+	for i := range skipObject {
+		if skipObject[i] {
+			continue
+		}
+		if !isRetryable(errs[i]) {
+			return false
+		}
+		failed = true
+	}
+	if !failed {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(v.batchRetryBackoff).After(deadline) {
+		return false
+	}
+	return sleepWithContext(ctx, v.batchRetryBackoff) == nil
+}
+
+// sleepWithContext waits for the given duration and returns early with the context error if ctx is done before
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,30 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryConfigBackoff(t *testing.T) {
+	cfg := RetryConfig{MaxRetries: 4, BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	for retry, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		wait, ok := cfg.backoff(retry)
+		require.True(t, ok)
+		require.Equal(t, expected, wait)
+	}
+	_, ok := cfg.backoff(4)
+	require.False(t, ok)
+}
@@ -0,0 +1,225 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/weaviate/tiktoken-go"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// batchSections holds the sections of the inputs of a batch, see the sectionDelimiter and combineStrategy settings.
+// Sections are vectorized like separate objects, owners maps every section back to the index of its object.
+type batchSections struct {
+	objectCount int
+	// byTokens weights the section vectors of an object by their tokens, see PoolingWeightByTokens
+	byTokens   bool
+	owners     []int
+	objects    []*models.Object
+	texts      []string
+	skipObject []bool
+}
+
+// inputSections splits the inputs of the batch into sections, one per property with the combineStrategy average or at
+// the sectionDelimiter. It returns nil if every object is vectorized as a single input.
+func inputSections(objects []*models.Object, texts []string, skipObject []bool, settings ClassSettings,
+	tke *tiktoken.Tiktoken,
+) *batchSections {
+	var sections *batchSections
+	if settings.CombineStrategy() == CombineStrategyAverage {
+		sections = propertySections(objects, skipObject, settings, propertyTokenCounter(settings, tke))
+	} else if delimiter := settings.SectionDelimiter(); delimiter != "" {
+		// the delimiter needs to match the normalized values
+		if settings.NormalizeInput() {
+			delimiter = normalizeText(delimiter)
+		}
+		sections = splitSections(objects, texts, skipObject, delimiter)
+	}
+	if sections != nil {
+		sections.byTokens = settings.PoolingWeight() == PoolingWeightByTokens
+	}
+	return sections
+}
+
+// splitSections splits the inputs of all objects that are not skipped at the delimiter. Empty sections are dropped,
+// an input without any non-empty section is kept as a single section.
+func splitSections(objects []*models.Object, texts []string, skipObject []bool, delimiter string) *batchSections {
+	s := &batchSections{objectCount: len(objects)}
+	for i := range texts {
+		if skipObject[i] {
+			continue
+		}
+		before := len(s.texts)
+		for _, section := range strings.Split(texts[i], delimiter) {
+			if section = strings.TrimSpace(section); section != "" {
+				s.add(i, objects[i], section)
+			}
+		}
+		if len(s.texts) == before {
+			s.add(i, objects[i], texts[i])
+		}
+	}
+	s.skipObject = make([]bool, len(s.texts))
+	return s
+}
+
+// propertySections splits the objects that are not skipped into one section per property, see
+// assemblePropertyInputs
+func propertySections(objects []*models.Object, skipObject []bool, settings ClassSettings, countTokens func(string) int,
+) *batchSections {
+	s := &batchSections{objectCount: len(objects)}
+	for i := range objects {
+		if skipObject[i] {
+			continue
+		}
+		for _, input := range assemblePropertyInputs(objects[i], settings, countTokens) {
+			s.add(i, objects[i], input)
+		}
+	}
+	s.skipObject = make([]bool, len(s.texts))
+	return s
+}
+
+func (s *batchSections) add(owner int, object *models.Object, text string) {
+	s.owners = append(s.owners, owner)
+	s.objects = append(s.objects, object)
+	s.texts = append(s.texts, text)
+}
+
+// join maps the results of the sections back to their objects. An object fails with the first error of its sections,
+// otherwise its vector is the normalized mean of its section vectors, weighted by their tokens with
+// PoolingWeightByTokens. objectErrs are the errors of the objects that failed before they were split.
+func (s *batchSections) join(vecs [][]float32, errs map[int]error, tokens []int, objectErrs map[int]error,
+) ([][]float32, map[int]error, []int, [][][]float32) {
+	objectVecs := make([][]float32, s.objectCount)
+	objectTokens := make([]int, s.objectCount)
+	sections := make([][][]float32, s.objectCount)
+	var weights [][]int
+	if s.byTokens {
+		weights = make([][]int, s.objectCount)
+	}
+	for j, owner := range s.owners {
+		objectTokens[owner] += tokens[j]
+		if errs[j] != nil && objectErrs[owner] == nil {
+			objectErrs[owner] = errs[j]
+		}
+		sections[owner] = append(sections[owner], vecs[j])
+		if weights != nil {
+			weights[owner] = append(weights[owner], tokens[j])
+		}
+	}
+
+	for i := range sections {
+		if objectErrs[i] != nil {
+			sections[i] = nil
+			continue
+		}
+		if len(sections[i]) > 0 && weights != nil {
+			objectVecs[i] = weightedMeanVector(sections[i], weights[i])
+		} else if len(sections[i]) > 0 {
+			objectVecs[i] = meanVector(sections[i])
+		}
+	}
+	return objectVecs, objectErrs, objectTokens, sections
+}
+
+// objectModels returns the model of every object, which is the model of all its sections. The vectors of different
+// models can't be combined, so objects whose sections were vectorized with different models fail.
+func (s *batchSections) objectModels(models []string, objectErrs map[int]error) []string {
+	objectModels := make([]string, s.objectCount)
+	for j, owner := range s.owners {
+		switch {
+		case models[j] == "":
+		case objectModels[owner] == "":
+			objectModels[owner] = models[j]
+		case objectModels[owner] != models[j] && objectErrs[owner] == nil:
+			objectErrs[owner] = fmt.Errorf("sections were vectorized with different models %s and %s",
+				objectModels[owner], models[j])
+		}
+	}
+	return objectModels
+}
+
+// objectCacheHits returns for every object whether the vectors of all its sections came from a cache. Sections that
+// were skipped before the cache was consulted don't count.
+func (s *batchSections) objectCacheHits(hits, skipped []bool) []bool {
+	objectHits := make([]bool, s.objectCount)
+	missed := make([]bool, s.objectCount)
+	for j, owner := range s.owners {
+		switch {
+		case skipped[j]:
+		case hits[j]:
+			objectHits[owner] = true
+		default:
+			missed[owner] = true
+		}
+	}
+	for i := range objectHits {
+		objectHits[i] = objectHits[i] && !missed[i]
+	}
+	return objectHits
+}
+
+// meanVector returns the mean of the given vectors normalized to unit length. A single vector is returned as is. Nil
+// vectors of skipped sections are left out.
+func meanVector(vectors [][]float32) []float32 {
+	return weightedMeanVector(vectors, nil)
+}
+
+// weightedMeanVector is meanVector with a weight per vector, nil weights weigh all vectors the same. Weights below 1,
+// e.g. of sections without tokens, count as 1.
+func weightedMeanVector(vectors [][]float32, weights []int) []float32 {
+	var kept [][]float32
+	var keptWeights []int
+	for i, vector := range vectors {
+		if vector == nil {
+			continue
+		}
+		kept = append(kept, vector)
+		if i < len(weights) {
+			keptWeights = append(keptWeights, max(weights[i], 1))
+		} else {
+			keptWeights = append(keptWeights, 1)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	if len(kept) == 1 {
+		return append([]float32(nil), kept[0]...)
+	}
+
+	mean := make([]float32, len(kept[0]))
+	for j, vector := range kept {
+		for i := range mean {
+			if i < len(vector) {
+				mean[i] += float32(keptWeights[j]) * vector[i]
+			}
+		}
+	}
+	norm := float64(0)
+	for _, f := range mean {
+		norm += float64(f) * float64(f)
+	}
+	if norm == 0 {
+		return mean
+	}
+	norm = math.Sqrt(norm)
+	for i := range mean {
+		mean[i] = float32(float64(mean[i]) / norm)
+	}
+	return mean
+}
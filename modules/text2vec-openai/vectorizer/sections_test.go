@@ -0,0 +1,157 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+func TestBatchSections(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "sectionDelimiter": "<SECTION>"}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	v := New(client, 40*time.Second, logger)
+
+	results := v.ObjectBatchResults(context.Background(), []*models.Object{
+		{Class: "Doc", Properties: map[string]interface{}{"test": "dimensions 4 <section> dimensions 3 <section><section> dimensions 5"}},
+		{Class: "Doc", Properties: map[string]interface{}{"test": "without sections"}},
+		{Class: "Doc", Properties: map[string]interface{}{"test": "skipped <section> object"}},
+		{Class: "Doc", Properties: map[string]interface{}{"test": "first <section> error broken"}},
+	}, []bool{false, false, true, false}, cfg)
+	require.Len(t, results, 4)
+
+	// every section is vectorized separately in section order, empty sections are dropped
+	var inputs []string
+	for _, request := range client.requests() {
+		inputs = append(inputs, request...)
+	}
+	assert.Equal(t, []string{"dimensions 4", "dimensions 3", "dimensions 5", "without sections", "first", "error broken"}, inputs)
+
+	require.NoError(t, results[0].Err)
+	require.Len(t, results[0].Sections, 3)
+	for i, dimensions := range []int{4, 3, 5} {
+		assert.Len(t, results[0].Sections[i], dimensions)
+	}
+
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, [][]float32{{0, 1, 2, 3}}, results[1].Sections)
+	assert.Equal(t, []float32{0, 1, 2, 3}, results[1].Vector)
+
+	assert.NoError(t, results[2].Err)
+	assert.Nil(t, results[2].Sections)
+
+	// an object fails if any of its sections fails
+	assert.EqualError(t, results[3].Err, "broken")
+	assert.Nil(t, results[3].Vector)
+	assert.Nil(t, results[3].Sections)
+}
+
+func TestBatchCombineStrategyAverage(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	objects := []*models.Object{
+		{Class: "Doc", Properties: map[string]interface{}{"a": "dimensions 4", "b": "other", "c": " "}},
+		{Class: "Doc", Properties: map[string]interface{}{"a": "single"}},
+	}
+	tke, err := tokenEncoder("ada")
+	require.NoError(t, err)
+
+	concatClient := &fakeBatchClient{}
+	concatCfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	concat := New(concatClient, 40*time.Second, logger).ObjectBatchResults(context.Background(), objects, []bool{false, false}, concatCfg)
+
+	client := &fakeBatchClient{}
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "combineStrategy": "average"}}
+	results := New(client, 40*time.Second, logger).ObjectBatchResults(context.Background(), objects, []bool{false, false}, cfg)
+
+	// every non-blank property is a separate input
+	var inputs []string
+	for _, request := range client.requests() {
+		inputs = append(inputs, request...)
+	}
+	assert.Equal(t, []string{"dimensions 4", "other", "single"}, inputs)
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, []float32{1, 1, 1, 1}, concat[0].Vector)
+	assert.Equal(t, [][]float32{{1, 1, 1, 1}, {0, 1, 2, 3}}, results[0].Sections)
+	assert.Equal(t, meanVector(results[0].Sections), results[0].Vector)
+	assert.NotEqual(t, concat[0].Vector, results[0].Vector)
+	// the tokens of all inputs of an object count
+	assert.Equal(t, clients.GetTokensCount("ada", "dimensions 4", tke)+clients.GetTokensCount("ada", "other", tke),
+		results[0].Tokens)
+	assert.Greater(t, results[0].Tokens, concat[0].Tokens)
+
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, concat[1].Vector, results[1].Vector)
+}
+
+func TestBatchPoolingWeightByTokens(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	short, long := "short", "a much longer property value that has many more tokens than the other one"
+	objects := []*models.Object{{Class: "Doc", Properties: map[string]interface{}{"a": short, "b": long}}}
+	tke, err := tokenEncoder("ada")
+	require.NoError(t, err)
+
+	pool := func(poolingWeight string) BatchResult {
+		classConfig := map[string]interface{}{"vectorizeClassName": false, "combineStrategy": "average"}
+		if poolingWeight != "" {
+			classConfig["poolingWeight"] = poolingWeight
+		}
+		v := New(&fakeBatchClient{echoVectors: true}, 40*time.Second, logger)
+		results := v.ObjectBatchResults(context.Background(), objects, []bool{false}, &fakeClassConfig{classConfig: classConfig})
+		require.NoError(t, results[0].Err)
+		require.Equal(t, [][]float32{echoVector(short), echoVector(long)}, results[0].Sections)
+		return results[0]
+	}
+	equal, byTokens := pool(""), pool("byTokens")
+
+	shortTokens, longTokens := clients.GetTokensCount("ada", short, tke), clients.GetTokensCount("ada", long, tke)
+	require.Greater(t, longTokens, shortTokens)
+	expected := make([]float32, len(echoVector(short)))
+	for i := range expected {
+		expected[i] = float32(shortTokens)*echoVector(short)[i] + float32(longTokens)*echoVector(long)[i]
+	}
+	// the mean of the same vector twice is the normalized vector
+	assert.InDeltaSlice(t, meanVector([][]float32{expected, expected}), byTokens.Vector, 1e-6)
+	assert.Equal(t, meanVector(equal.Sections), equal.Vector)
+
+	// the long property dominates the token weighted vector
+	cosine := func(a, b []float32) float64 {
+		var dot, normA, normB float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+			normA += float64(a[i]) * float64(a[i])
+			normB += float64(b[i]) * float64(b[i])
+		}
+		return dot / math.Sqrt(normA*normB)
+	}
+	assert.Greater(t, cosine(byTokens.Vector, echoVector(long)), cosine(equal.Vector, echoVector(long)))
+}
+
+func TestMeanVector(t *testing.T) {
+	assert.Equal(t, []float32{1, 2}, meanVector([][]float32{{1, 2}}))
+	assert.Equal(t, []float32{1, 2}, meanVector([][]float32{nil, {1, 2}}))
+	assert.Nil(t, meanVector([][]float32{nil}))
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, meanVector([][]float32{{0.6, 0}, {0, 0.8}}), 1e-6)
+	assert.Equal(t, []float32{0, 0}, meanVector([][]float32{{1, -1}, {-1, 1}}))
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, weightedMeanVector([][]float32{{1, 0}, {0, 1}}, []int{3, 4}), 1e-6)
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, weightedMeanVector([][]float32{{1, 0}, nil, {0, 1}}, []int{3, 9, 4}), 1e-6)
+}
@@ -0,0 +1,75 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// the limits that end a vectorizer-batch, see splitLimit
+const (
+	splitLimitTokens  = "tokens"
+	splitLimitTime    = "time"
+	splitLimitObjects = "objects"
+	// splitLimitEnd is used for the last vectorizer-batch of a job, which ends with the objects of the job
+	splitLimitEnd = "end"
+)
+
+// splitLimit returns the limit that keeps the next object with the given tokens from being added to the current
+// vectorizer-batch, "" if it still fits. A token budget (see tokenBudget) raises the tokens of the vectorizer-batch.
+func (v *Vectorizer) splitLimit(state *batchWorkerState, budget, tokensInCurrentBatch, tokens, objects int) string {
+	maxTokens := max(0.95*float32(state.rateLimit.RemainingTokens), float32(budget))
+	switch {
+	case float32(tokensInCurrentBatch+tokens) >= maxTokens:
+		return splitLimitTokens
+	case state.timePerToken*float64(tokensInCurrentBatch) >= OpenAiMaxTimePerBatch:
+		return splitLimitTime
+	case objects >= v.maxObjectsPerRequest:
+		return splitLimitObjects
+	default:
+		return ""
+	}
+}
+
+// logSplit logs at debug level why the batch worker ends a vectorizer-batch with the objects of origIndex, or waits
+// before the object at origIndex if the batch is empty
+func (v *Vectorizer) logSplit(state *batchWorkerState, limit string, tokens int, origIndex []int, wait time.Duration) {
+	if !debugEnabled(v.logger) || len(origIndex) == 0 {
+		return
+	}
+	v.logger.WithField("action", "text2vec_openai_batch_split").
+		WithField("limit", limit).
+		WithField("tokens", tokens).
+		WithField("remaining_tokens", state.rateLimit.RemainingTokens).
+		WithField("objects", len(origIndex)).
+		WithField("first_index", origIndex[0]).
+		WithField("last_index", origIndex[len(origIndex)-1]).
+		WithField("wait", wait).
+		Debug("split batch into a separate request to the vectorizer")
+}
+
+// debugEnabled returns whether the logger logs at debug level, so the fields of debug entries are only collected if
+// they are logged
+func debugEnabled(logger logrus.FieldLogger) bool {
+	switch l := logger.(type) {
+	case nil:
+		return false
+	case *logrus.Logger:
+		return l.IsLevelEnabled(logrus.DebugLevel)
+	case *logrus.Entry:
+		return l.Logger.IsLevelEnabled(logrus.DebugLevel)
+	default:
+		return true
+	}
+}
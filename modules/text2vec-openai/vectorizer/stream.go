@@ -0,0 +1,110 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"time"
+
+	enterrors "github.com/weaviate/weaviate/entities/errors"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/entities/moduletools"
+)
+
+// ObjectBatchStream vectorizes the given objects like ObjectBatchResults, but sends the result of every object to the
+// returned channel as soon as it is known, so indexing can start before the whole batch is done. The result of every
+// object is sent exactly once, including skipped objects, in no particular order. The channel is closed once the
+// batch is done.
+//
+// The channel buffers the results of all objects, so the batch never waits for the receiver. Results that depend on the
+// whole batch are sent once the batch is done: those of cache hits, of duplicates with dedupeInputs, of objects with
+// sections and of all objects of classes with propertyModels or with WithBatchRetry. The vectors of all objects need to
+// have the dimensions of the first vector that was sent, instead of the dimensions of most vectors of the batch (see
+// ErrMixedDimensions).
+func (v *Vectorizer) ObjectBatchStream(ctx context.Context, objects []*models.Object, skipObject []bool,
+	cfg moduletools.ClassConfig,
+) <-chan BatchResult {
+	results := make(chan BatchResult, len(objects))
+	if err := checkSkipObject(objects, skipObject); err != nil || len(objects) == 0 {
+		for _, result := range mismatchResults(objects, err) {
+			results <- result
+		}
+		close(results)
+		return results
+	}
+	stream := &batchStream{
+		sent: make([]bool, len(objects)),
+		send: func(result BatchResult) { results <- result },
+	}
+	var counters *batchCounters
+	if v.onBatchComplete != nil {
+		ctx, counters = contextWithBatchCounters(ctx, len(objects))
+		stream.send = func(result BatchResult) {
+			counters.observeResult(result, skipObject[result.Index])
+			results <- result
+		}
+	}
+	enterrors.GoWrapper(func() {
+		defer close(results)
+		for _, result := range v.objectBatchResults(ctx, objects, skipObject, cfg, stream) {
+			if !stream.sent[result.Index] {
+				if counters != nil {
+					counters.observeResult(result, skipObject[result.Index])
+				}
+				results <- result
+			}
+		}
+		if counters != nil {
+			v.onBatchComplete(counters.finish())
+		}
+	}, v.logger)
+	return results
+}
+
+// batchStream sends the results of a batch as soon as their requests are done, see ObjectBatchStream. It is only used
+// by the batch worker while the batch is processed, which sends the requests of a job one after the other.
+type batchStream struct {
+	send  func(BatchResult)
+	start time.Time
+	// sent is set for every object whose result was already sent
+	sent []bool
+	// dimensions are the dimensions of the first vector that was sent
+	dimensions int
+}
+
+// streamResults sends the results of the objects of a request once the request is done
+func (v *Vectorizer) streamResults(job batchJob, origIndex []int) {
+	stream := job.stream
+	consumed := deadlineConsumed(job.ctx, stream.start, job.maxBatchTime)
+	duration := time.Since(stream.start)
+	for _, i := range origIndex {
+		if job.errs[i] == nil && job.vecs[i] != nil {
+			if stream.dimensions == 0 {
+				stream.dimensions = len(job.vecs[i])
+			} else if len(job.vecs[i]) != stream.dimensions {
+				job.errs[i] = mixedDimensionsError(len(job.vecs[i]), stream.dimensions)
+				job.vecs[i] = nil
+			}
+		}
+
+		result := BatchResult{Index: i, Vector: job.vecs[i], Err: job.errs[i]}
+		if result.Err == nil {
+			result.Tokens = job.tokens[i]
+		}
+		if result.Vector != nil {
+			result.Model = job.models[i]
+		}
+		v.finishResult(&result, false, job.tokens[i], consumed, duration)
+		stream.sent[i] = true
+		stream.send(result)
+	}
+}
@@ -0,0 +1,162 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestBatchStream(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := make([]*models.Object, 5)
+	texts := make([]string, len(objects))
+	for i := range objects {
+		texts[i] = fmt.Sprintf("object %d", i)
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+	}
+	objects[3].Properties = map[string]interface{}{"test": "error broken"}
+	skip := []bool{false, false, true, false, false}
+
+	// every object is a separate request that takes 100ms
+	client := &fakeBatchClient{echoVectors: true, latency: 100 * time.Millisecond}
+	v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1))
+
+	start := time.Now()
+	var arrivals []time.Duration
+	received := make(map[int]BatchResult)
+	for result := range v.ObjectBatchStream(context.Background(), objects, skip, cfg) {
+		arrivals = append(arrivals, time.Since(start))
+		_, duplicate := received[result.Index]
+		require.False(t, duplicate, result.Index)
+		received[result.Index] = result
+	}
+
+	// every object is sent exactly once, the vectorized ones as soon as their request is done
+	require.Len(t, received, len(objects))
+	assert.Less(t, arrivals[0], 250*time.Millisecond)
+	assert.Greater(t, arrivals[len(arrivals)-1], 350*time.Millisecond)
+	for _, i := range []int{0, 1, 4} {
+		require.NoError(t, received[i].Err)
+		assert.Equal(t, echoVector(texts[i]), received[i].Vector)
+		assert.Greater(t, received[i].Tokens, 0)
+		assert.Equal(t, "ada", received[i].Model)
+	}
+	assert.NoError(t, received[2].Err)
+	assert.Nil(t, received[2].Vector)
+	assert.EqualError(t, received[3].Err, "broken")
+	assert.Nil(t, received[3].Vector)
+
+	t.Run("results of objects with sections are sent once the batch is done", func(t *testing.T) {
+		cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false, "sectionDelimiter": "<SECTION>"}}
+		objects := []*models.Object{
+			{Class: "Doc", Properties: map[string]interface{}{"test": "first <section> second"}},
+			{Class: "Doc", Properties: map[string]interface{}{"test": "third"}},
+		}
+
+		var results []BatchResult
+		for result := range v.ObjectBatchStream(context.Background(), objects, []bool{false, false}, cfg) {
+			results = append(results, result)
+		}
+
+		require.Len(t, results, 2)
+		for _, result := range results {
+			require.NoError(t, result.Err)
+			assert.Equal(t, v.ObjectBatchResults(context.Background(), objects, []bool{false, false}, cfg)[result.Index].Sections,
+				result.Sections)
+		}
+	})
+}
+
+func TestBatchStreamAbandoned(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	objects := make([]*models.Object, 20)
+	for i := range objects {
+		objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("object %d", i)}}
+	}
+	skip := make([]bool, len(objects))
+
+	// drain returns the results that are left once the producer closes the channel, and fails if it doesn't do so
+	// promptly
+	drain := func(t *testing.T, results <-chan BatchResult, within time.Duration) []BatchResult {
+		var left []BatchResult
+		timeout := time.After(within)
+		for {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					return left
+				}
+				left = append(left, result)
+			case <-timeout:
+				require.FailNow(t, "the producer did not stop after the context was cancelled")
+			}
+		}
+	}
+
+	t.Run("cancelled while vectorizing", func(t *testing.T) {
+		// every object is a separate request that takes 100ms, so the whole batch takes 2s
+		client := &fakeBatchClient{latency: 100 * time.Millisecond}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(1))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		results := v.ObjectBatchStream(ctx, objects, skip, cfg)
+		first := <-results
+		require.NoError(t, first.Err)
+		cancel()
+
+		left := drain(t, results, 500*time.Millisecond)
+		require.Len(t, left, len(objects)-1)
+		assert.Error(t, left[len(left)-1].Err)
+		assert.Less(t, len(client.requests()), len(objects))
+	})
+
+	t.Run("cancelled while queued", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		// another batch keeps the worker busy for longer than the consumer waits
+		blocked := make(chan struct{})
+		go func() {
+			defer close(blocked)
+			v.ObjectBatch(context.Background(), []*models.Object{
+				{Class: "Car", Properties: map[string]interface{}{"test": "wait 1000"}},
+			}, []bool{false}, cfg)
+		}()
+		require.Eventually(t, func() bool { return len(client.requests()) == 1 }, time.Second, time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		results := v.ObjectBatchStream(ctx, objects, skip, cfg)
+		require.Eventually(t, func() bool { return len(v.lane.jobQueueCh) == 1 }, time.Second, time.Millisecond)
+		cancel()
+
+		left := drain(t, results, 300*time.Millisecond)
+		require.Len(t, left, len(objects))
+		for _, result := range left {
+			assert.Error(t, result.Err)
+		}
+
+		// the worker skips the job that was given up
+		<-blocked
+		v.ObjectBatch(context.Background(), objects[:1], skip[:1], cfg)
+		assert.Equal(t, [][]string{{"wait 1000"}, {"object 0"}}, client.requests())
+	})
+}
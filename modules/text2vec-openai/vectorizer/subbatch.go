@@ -0,0 +1,132 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/entities/moduletools"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/ent"
+)
+
+// ObjectSubBatch vectorizes the given objects like ObjectBatch, but sends all their inputs in a single request instead
+// of splitting them, for callers that compose their requests themselves. Inputs are checked and the batch waits for
+// the rate limits like any other batch, but a sub-batch with more objects than a request may have or more tokens than
+// the token limit of the account fails as a whole with ErrSubBatchTooLarge. The limits are only known once a request
+// was sent, so the first sub-batch is sent as it is.
+func (v *Vectorizer) ObjectSubBatch(ctx context.Context, objects []*models.Object, skipObject []bool,
+	cfg moduletools.ClassConfig,
+) ([][]float32, map[int]error) {
+	return v.ObjectBatch(context.WithValue(ctx, subBatchKey, true), objects, skipObject, cfg)
+}
+
+// isSubBatch returns whether the batch of ctx is sent as a single request, see ObjectSubBatch
+func isSubBatch(ctx context.Context) bool {
+	subBatch, _ := ctx.Value(subBatchKey).(bool)
+	return subBatch
+}
+
+// processSubBatch sends all inputs of the job in a single request after waiting for the rate limits, see
+// ObjectSubBatch
+func (v *Vectorizer) processSubBatch(job batchJob, lane *batchLane, conf ent.VectorizationConfig) {
+	state := lane.workerState
+	var texts []string
+	var origIndex []int
+	tokens := 0
+	for i := range job.texts {
+		if job.skipObject[i] {
+			continue
+		}
+		if err := job.assembly.wait(i); err != nil {
+			if err != errSkippedInput {
+				job.errs[i] = err
+			}
+			continue
+		}
+		if !state.firstRequest && !v.disableRateLimit && job.tokens[i] > state.rateLimit.LimitTokens {
+			job.errs[i] = &TextTooLongError{Tokens: job.tokens[i], Limit: state.rateLimit.LimitTokens}
+			continue
+		}
+		texts = append(texts, job.texts[i])
+		origIndex = append(origIndex, i)
+		tokens += job.tokens[i]
+	}
+	if len(texts) == 0 {
+		return
+	}
+
+	fail := func(err error) {
+		for _, index := range origIndex {
+			job.errs[index] = err
+		}
+	}
+	if len(texts) > v.maxObjectsPerRequest {
+		fail(fmt.Errorf("%w: %d inputs, at most %d are allowed", ErrSubBatchTooLarge, len(texts), v.maxObjectsPerRequest))
+		return
+	}
+	if !state.firstRequest && !v.disableRateLimit {
+		if tokens > state.rateLimit.LimitTokens {
+			fail(fmt.Errorf("%w: %d tokens, the token limit is %d", ErrSubBatchTooLarge, tokens, state.rateLimit.LimitTokens))
+			return
+		}
+		if err := v.waitForSubBatch(job, state, conf, tokens); err != nil {
+			fail(err)
+			return
+		}
+	}
+	if job.ctx.Err() != nil {
+		fail(contextError(job.ctx))
+		return
+	}
+
+	v.logSplit(state, splitLimitEnd, tokens, origIndex, 0)
+	rateLimit, err := v.makeRequest(job, texts, conf, origIndex)
+	if err == nil && !v.disableRateLimit {
+		state.updateRateLimit(rateLimit)
+		state.firstRequest = false
+	}
+}
+
+// waitForSubBatch waits until the rate limits allow another request with the given tokens. It fails if they don't
+// refresh within the batch time.
+func (v *Vectorizer) waitForSubBatch(job batchJob, state *batchWorkerState, conf ent.VectorizationConfig, tokens int) error {
+	if state.rateLimit.RemainingRequests <= 0 && state.rateLimit.ResetRequests > 0 {
+		wait := time.Duration(state.rateLimit.ResetRequests) * time.Second
+		if time.Since(job.startTime)+wait > job.maxBatchTime {
+			return errors.New("request rate limit exceeded and will not refresh in time")
+		}
+		wait = v.jitterRateLimitWait(job, wait)
+		v.rateLimitWait(job, conf, "requests", wait)
+		if err := sleepWithContext(job.ctx, wait); err != nil {
+			return contextError(job.ctx)
+		}
+	}
+	if tokens > state.rateLimit.RemainingTokens && state.rateLimit.ResetTokens > 0 {
+		// like for single inputs that don't fit, the token limit is assumed to refresh linearly
+		wait := state.refillWait(tokens, time.Now())
+		if time.Since(job.startTime)+wait > job.maxBatchTime {
+			return errors.New("sub-batch has more tokens than remain. Cannot wait for token refresh due to time limit")
+		}
+		wait = v.jitterRateLimitWait(job, wait)
+		v.rateLimitWait(job, conf, "tokens", wait)
+		if err := sleepWithContext(job.ctx, wait); err != nil {
+			return contextError(job.ctx)
+		}
+		state.refill(time.Now())
+		state.rateLimit.RemainingTokens = max(state.rateLimit.RemainingTokens, tokens)
+	}
+	return nil
+}
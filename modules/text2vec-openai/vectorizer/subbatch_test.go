@@ -0,0 +1,93 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestObjectSubBatch(t *testing.T) {
+	cfg := &fakeClassConfig{vectorizePropertyName: false, classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	newObjects := func(texts ...string) ([]*models.Object, []bool) {
+		objects := make([]*models.Object, len(texts))
+		for i := range texts {
+			objects[i] = &models.Object{Class: "Car", Properties: map[string]interface{}{"test": texts[i]}}
+		}
+		return objects, make([]bool, len(objects))
+	}
+	texts := []string{"first", "second", "third", "fourth", "fifth"}
+
+	t.Run("all inputs are sent in a single request", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		objects, skip := newObjects(texts...)
+
+		for call := 1; call <= 2; call++ {
+			vecs, errs := v.ObjectSubBatch(context.Background(), objects, skip, cfg)
+			require.Len(t, errs, 0)
+			for i := range vecs {
+				require.NotNil(t, vecs[i])
+			}
+			// neither the probe of the first batch nor the rate limits split the sub-batch
+			require.Len(t, client.requests(), call)
+			assert.Equal(t, texts, client.requests()[call-1])
+		}
+
+		// a regular batch probes the rate limits with its first object
+		batchClient := &fakeBatchClient{}
+		New(batchClient, 40*time.Second, logger).ObjectBatch(context.Background(), objects, skip, cfg)
+		assert.Greater(t, len(batchClient.requests()), 1)
+	})
+
+	t.Run("too many objects", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger, WithMaxObjectsPerRequest(3))
+		objects, skip := newObjects(texts...)
+		skip[0] = true
+
+		_, errs := v.ObjectSubBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, len(texts)-1)
+		for i := 1; i < len(texts); i++ {
+			require.ErrorIs(t, errs[i], ErrSubBatchTooLarge)
+		}
+		require.Len(t, client.requests(), 0)
+	})
+
+	t.Run("more tokens than the token limit", func(t *testing.T) {
+		client := &fakeBatchClient{}
+		v := New(client, 40*time.Second, logger)
+		objects, skip := newObjects("first")
+		_, errs := v.ObjectSubBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 0)
+
+		// every input fits into the token limit of 200, but not all of them together
+		long := strings.Repeat("word ", 80)
+		objects, skip = newObjects(fmt.Sprintf("a %s", long), fmt.Sprintf("b %s", long), fmt.Sprintf("c %s", long))
+		_, errs = v.ObjectSubBatch(context.Background(), objects, skip, cfg)
+		require.Len(t, errs, 3)
+		for i := range objects {
+			require.ErrorIs(t, errs[i], ErrSubBatchTooLarge)
+		}
+		require.Len(t, client.requests(), 1)
+	})
+}
@@ -0,0 +1,92 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// usageCounters are the tokens and requests of a vectorizer since it was created or its usage was reset, see Usage
+type usageCounters struct {
+	tokens   atomic.Int64
+	requests atomic.Int64
+}
+
+// Usage returns the tokens and requests that the vectorizer used since it was created or since the last ResetUsage,
+// across all batches. Requests include retries and failed requests, tokens only count successful requests like OpenAI
+// bills them, with the tokens that OpenAI reports or the estimated tokens if it doesn't report any.
+func (v *Vectorizer) Usage() (tokens, requests int64) {
+	return v.usage.tokens.Load(), v.usage.requests.Load()
+}
+
+// ResetUsage resets the counters of Usage and returns their values before the reset
+func (v *Vectorizer) ResetUsage() (tokens, requests int64) {
+	return v.usage.tokens.Swap(0), v.usage.requests.Swap(0)
+}
+
+// TenantUsage attributes the tokens of all requests to the vectorizer to the tenants of the vectorized objects, see
+// WithTenantUsage. Requests can contain objects of several tenants, in which case the tokens that OpenAI reports for
+// the request are split between the tenants in proportion to the estimated tokens of their objects.
+type TenantUsage struct {
+	sync.Mutex
+	tokens map[string]int64
+}
+
+func NewTenantUsage() *TenantUsage {
+	return &TenantUsage{tokens: make(map[string]int64)}
+}
+
+// Tokens returns the tokens attributed to tenant so far. Objects without a tenant are attributed to "".
+func (u *TenantUsage) Tokens(tenant string) int64 {
+	u.Lock()
+	defer u.Unlock()
+	return u.tokens[tenant]
+}
+
+// Snapshot returns the tokens attributed to all tenants so far
+func (u *TenantUsage) Snapshot() map[string]int64 {
+	u.Lock()
+	defer u.Unlock()
+	snapshot := make(map[string]int64, len(u.tokens))
+	for tenant, tokens := range u.tokens {
+		snapshot[tenant] = tokens
+	}
+	return snapshot
+}
+
+// attribute splits the tokens of a single request between tenants in proportion to their estimated tokens. The
+// shares are rounded such that they always add up to total.
+func (u *TenantUsage) attribute(total int, estimated map[string]int) {
+	sum := 0
+	tenants := make([]string, 0, len(estimated))
+	for tenant, tokens := range estimated {
+		sum += tokens
+		tenants = append(tenants, tenant)
+	}
+	if sum == 0 {
+		return
+	}
+	sort.Strings(tenants)
+
+	u.Lock()
+	defer u.Unlock()
+	cumulative, allocated := 0, int64(0)
+	for _, tenant := range tenants {
+		cumulative += estimated[tenant]
+		upTo := int64(math.Round(float64(total) * float64(cumulative) / float64(sum)))
+		u.tokens[tenant] += upTo - allocated
+		allocated = upTo
+	}
+}
@@ -0,0 +1,158 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/weaviate/weaviate/entities/models"
+	"github.com/weaviate/weaviate/modules/text2vec-openai/clients"
+)
+
+func TestTenantUsage(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	client := &fakeBatchClient{tokensPerRequest: 1000}
+	usage := NewTenantUsage()
+	v := New(client, 40*time.Second, logger, WithTenantUsage(usage))
+
+	// the first request of a vectorizer only contains a single object
+	_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Tenant: "warmup", Properties: map[string]interface{}{"test": "warmup"}},
+	}, []bool{false}, cfg)
+	require.Len(t, errs, 0)
+
+	texts := []string{"one two three four five six seven", "one", "two three"}
+	_, errs = v.ObjectBatch(context.Background(), []*models.Object{
+		{Class: "Car", Tenant: "a", Properties: map[string]interface{}{"test": texts[0]}},
+		{Class: "Car", Tenant: "b", Properties: map[string]interface{}{"test": texts[1]}},
+		{Class: "Car", Tenant: "a", Properties: map[string]interface{}{"test": texts[2]}},
+	}, []bool{false, false, false}, cfg)
+	require.Len(t, errs, 0)
+	// all tenants share a single request
+	requests := client.requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, texts, requests[1])
+
+	tke, err := tokenEncoder(DefaultOpenAIModel)
+	require.NoError(t, err)
+	tokensA := clients.GetTokensCount(DefaultOpenAIModel, texts[0], tke) + clients.GetTokensCount(DefaultOpenAIModel, texts[2], tke)
+	tokensB := clients.GetTokensCount(DefaultOpenAIModel, texts[1], tke)
+	expectedA := int64(math.Round(1000 * float64(tokensA) / float64(tokensA+tokensB)))
+
+	assert.Equal(t, map[string]int64{"warmup": 1000, "a": expectedA, "b": 1000 - expectedA}, usage.Snapshot())
+	assert.Greater(t, usage.Tokens("a"), usage.Tokens("b"))
+
+	t.Run("estimated tokens without reported tokens", func(t *testing.T) {
+		client.Lock()
+		client.tokensPerRequest = 0
+		client.Unlock()
+
+		_, errs = v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Properties: map[string]interface{}{"test": texts[1]}},
+		}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		assert.Equal(t, int64(tokensB), usage.Tokens(""))
+	})
+}
+
+func TestTenantUsageRounding(t *testing.T) {
+	usage := NewTenantUsage()
+	usage.attribute(100, map[string]int{"a": 1, "b": 1, "c": 1})
+	assert.Equal(t, map[string]int64{"a": 33, "b": 34, "c": 33}, usage.Snapshot())
+
+	usage.attribute(100, map[string]int{})
+	assert.Equal(t, map[string]int64{"a": 33, "b": 34, "c": 33}, usage.Snapshot())
+}
+
+func TestTenantUsageWithoutReportedTokens(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, hook := test.NewNullLogger()
+	client := &fakeBatchClient{}
+	usage := NewTenantUsage()
+	v := New(client, 40*time.Second, logger, WithTenantUsage(usage))
+
+	tke, err := tokenEncoder(DefaultOpenAIModel)
+	require.NoError(t, err)
+	expected := int64(0)
+	for _, text := range []string{"first", "second object"} {
+		_, errs := v.ObjectBatch(context.Background(), []*models.Object{
+			{Class: "Car", Tenant: "a", Properties: map[string]interface{}{"test": text}},
+		}, []bool{false}, cfg)
+		require.Len(t, errs, 0)
+		expected += int64(clients.GetTokensCount(DefaultOpenAIModel, text, tke))
+	}
+
+	// the estimate is used instead and the missing usage is only logged once
+	assert.Equal(t, expected, usage.Tokens("a"))
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+}
+
+func TestVectorizerUsage(t *testing.T) {
+	cfg := &fakeClassConfig{classConfig: map[string]interface{}{"vectorizeClassName": false}}
+	logger, _ := test.NewNullLogger()
+	var statsLock sync.Mutex
+	var stats []BatchStats
+	v := New(&fakeBatchClient{}, 40*time.Second, logger, WithOverloadRetries(RetryConfig{MaxRetries: 2, BaseBackoff: time.Millisecond}),
+		WithOnBatchComplete(func(batch BatchStats) {
+			statsLock.Lock()
+			defer statsLock.Unlock()
+			stats = append(stats, batch)
+		}))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			objects := []*models.Object{
+				{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("first object of batch %d", i)}},
+				{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("second object of batch %d", i)}},
+				// one request of every batch is retried
+				{Class: "Car", Properties: map[string]interface{}{"test": fmt.Sprintf("overloaded 1 %d", i)}},
+			}
+			_, errs := v.ObjectBatch(context.Background(), objects, make([]bool, len(objects)), cfg)
+			assert.Len(t, errs, 0)
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, stats, 5)
+	var tokens, requests int64
+	for _, batch := range stats {
+		tokens += int64(batch.Tokens)
+		requests += int64(batch.Requests)
+	}
+	usedTokens, usedRequests := v.Usage()
+	assert.Equal(t, tokens, usedTokens)
+	assert.Equal(t, requests, usedRequests)
+	assert.Greater(t, usedRequests, int64(5))
+
+	resetTokens, resetRequests := v.ResetUsage()
+	assert.Equal(t, usedTokens, resetTokens)
+	assert.Equal(t, usedRequests, resetRequests)
+	usedTokens, usedRequests = v.Usage()
+	assert.Zero(t, usedTokens)
+	assert.Zero(t, usedRequests)
+}
@@ -0,0 +1,69 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// waitLogger logs the waits for rate limits. The first wait is always logged, afterwards only one in rate waits is
+// logged, together with the number and total duration of all waits since the previous log entry.
+type waitLogger struct {
+	logger logrus.FieldLogger
+	rate   int
+
+	sync.Mutex
+	logged bool
+	// waits and waited aggregate the waits since the last log entry
+	waits  int
+	waited time.Duration
+}
+
+func newWaitLogger(logger logrus.FieldLogger, rate int) *waitLogger {
+	if rate < 1 {
+		rate = 1
+	}
+	return &waitLogger{logger: logger, rate: rate}
+}
+
+// wait records a wait of a batch with the given job ID (see ContextWithJobID), which is part of the log entry if set
+func (w *waitLogger) wait(reason string, d time.Duration, jobID string) {
+	if w == nil || w.logger == nil {
+		return
+	}
+
+	w.Lock()
+	w.waits++
+	w.waited += d
+	if w.logged && w.waits < w.rate {
+		w.Unlock()
+		return
+	}
+	waits, waited := w.waits, w.waited
+	w.logged = true
+	w.waits = 0
+	w.waited = 0
+	w.Unlock()
+
+	logger := w.logger.WithField("action", "text2vec_openai_rate_limit_wait").
+		WithField("reason", reason).
+		WithField("wait", d).
+		WithField("waits", waits).
+		WithField("total_wait", waited)
+	if jobID != "" {
+		logger = logger.WithField("job_id", jobID)
+	}
+	logger.Info("waiting for the rate limit of the vectorizer")
+}
@@ -0,0 +1,51 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitLogSampling(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	w := newWaitLogger(logger, 100)
+
+	for i := 0; i < 1000; i++ {
+		w.wait("tokens", time.Second, "")
+	}
+
+	// the first wait and then one in 100
+	entries := hook.AllEntries()
+	require.Len(t, entries, 10)
+	assert.Equal(t, 1, entries[0].Data["waits"])
+	assert.Equal(t, time.Second, entries[0].Data["total_wait"])
+	for _, entry := range entries[1:] {
+		assert.Equal(t, 100, entry.Data["waits"])
+		assert.Equal(t, 100*time.Second, entry.Data["total_wait"])
+		assert.Equal(t, "tokens", entry.Data["reason"])
+	}
+
+	t.Run("every wait is logged by default", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		w := newWaitLogger(logger, 0)
+		for i := 0; i < 5; i++ {
+			w.wait("requests", time.Second, "")
+		}
+		require.Len(t, hook.AllEntries(), 5)
+		assert.Equal(t, 1, hook.LastEntry().Data["waits"])
+	})
+}
@@ -42,6 +42,12 @@ func (v *ObjectVectorizer) Texts(ctx context.Context, object *models.Object, ich
 }
 
 func (v *ObjectVectorizer) camelCaseToLower(in string) string {
+	return CamelCaseToLower(in)
+}
+
+// CamelCaseToLower splits a class or property name at its camel case boundaries and lowercases the parts, e.g.
+// "ProductName" becomes "product name"
+func CamelCaseToLower(in string) string {
 	parts := camelcase.Split(in)
 	var sb strings.Builder
 	for i, part := range parts {
@@ -61,12 +67,9 @@ func (v *ObjectVectorizer) camelCaseToLower(in string) string {
 
 func (v *ObjectVectorizer) TextsWithTitleProperty(ctx context.Context, object *models.Object, icheck ClassSettings, titlePropertyName string,
 ) (string, string) {
-	var corpi []string
+	var properties []PropertyInput
 	var titlePropertyValue []string
 
-	if icheck.VectorizeClassName() {
-		corpi = append(corpi, v.camelCaseToLower(object.Class))
-	}
 	if object.Properties != nil {
 		propMap := object.Properties.(map[string]interface{})
 		for _, propName := range moduletools.SortStringKeys(propMap) {
@@ -76,40 +79,93 @@ func (v *ObjectVectorizer) TextsWithTitleProperty(ctx context.Context, object *m
 			isTitleProperty := propName == titlePropertyName
 			isNameVectorizable := icheck.VectorizePropertyName(propName)
 
+			var values []string
 			switch val := propMap[propName].(type) {
 			case []string:
-				if len(val) > 0 {
-					lowerPropertyName := v.camelCaseToLower(propName)
-
-					for i := range val {
-						str := strings.ToLower(val[i])
-						if isTitleProperty {
-							titlePropertyValue = append(titlePropertyValue, str)
-						}
-						if isNameVectorizable {
-							str = fmt.Sprintf("%s %s", lowerPropertyName, str)
-						}
-						corpi = append(corpi, str)
-					}
+				for i := range val {
+					values = append(values, strings.ToLower(val[i]))
 				}
 			case string:
-				str := strings.ToLower(val)
-				if isTitleProperty {
-					titlePropertyValue = append(titlePropertyValue, str)
-				}
-				if icheck.VectorizePropertyName(propName) {
-					str = fmt.Sprintf("%s %s", v.camelCaseToLower(propName), str)
-				}
-				corpi = append(corpi, str)
+				values = []string{strings.ToLower(val)}
 			default:
 				// properties that are not part of the object
 			}
+			if isTitleProperty {
+				titlePropertyValue = append(titlePropertyValue, values...)
+			}
+			if isNameVectorizable {
+				lowerPropertyName := v.camelCaseToLower(propName)
+				for i := range values {
+					values[i] = fmt.Sprintf("%s %s", lowerPropertyName, values[i])
+				}
+			}
+			properties = append(properties, PropertyInput{Values: values})
 		}
 	}
+
+	return JoinInput(object.Class, icheck.VectorizeClassName(), properties), strings.Join(titlePropertyValue, " ")
+}
+
+// PropertyInput is the part of the input of an object that a single property contributes, see JoinInput
+type PropertyInput struct {
+	// Name is the property name of a header block, it is empty if the property name is not vectorized or is part of
+	// the values
+	Name   string
+	Values []string
+}
+
+// JoinInput joins the parts of the properties of an object and its class name into the input of the object. The class
+// name comes first if it is vectorized and is used as a fallback for objects without any values. Without any
+// property names the values are joined with spaces, otherwise the names are grouped in a header block that is
+// separated from the values by a newline, e.g. "body title\ny x".
+func JoinInput(className string, vectorizeClassName bool, properties []PropertyInput) string {
+	var header []string
+	var corpi []string
+	for _, property := range properties {
+		if property.Name != "" {
+			header = append(header, property.Name)
+		}
+		corpi = append(corpi, property.Values...)
+	}
+
+	if vectorizeClassName {
+		if len(header) > 0 {
+			header = append([]string{CamelCaseToLower(className)}, header...)
+		} else {
+			corpi = append([]string{CamelCaseToLower(className)}, corpi...)
+		}
+	}
+
 	if len(corpi) == 0 {
 		// fall back to using the class name
-		corpi = append(corpi, v.camelCaseToLower(object.Class))
+		return CamelCaseToLower(className)
+	}
+	if len(header) == 0 {
+		return strings.Join(corpi, " ")
+	}
+	return strings.Join(header, " ") + "\n" + strings.Join(corpi, " ")
+}
+
+// OrderedPropertyNames returns the names of the properties of an object in sorted order, or in the order of
+// schemaOrder if it is set. Properties that are not part of schemaOrder then come last in sorted order.
+func OrderedPropertyNames(propMap map[string]interface{}, schemaOrder []string) []string {
+	sorted := moduletools.SortStringKeys(propMap)
+	if schemaOrder == nil {
+		return sorted
 	}
 
-	return strings.Join(corpi, " "), strings.Join(titlePropertyValue, " ")
+	names := make([]string, 0, len(propMap))
+	inSchema := make(map[string]struct{}, len(propMap))
+	for _, name := range schemaOrder {
+		if _, ok := propMap[name]; ok {
+			names = append(names, name)
+			inSchema[name] = struct{}{}
+		}
+	}
+	for _, name := range sorted {
+		if _, ok := inSchema[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return names
 }
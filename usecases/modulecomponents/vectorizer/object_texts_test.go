@@ -0,0 +1,45 @@
+//                           _       _
+// __      _____  __ ___   ___  __ _| |_ ___
+// \ \ /\ / / _ \/ _` \ \ / / |/ _` | __/ _ \
+//  \ V  V /  __/ (_| |\ V /| | (_| | ||  __/
+//   \_/\_/ \___|\__,_| \_/ |_|\__,_|\__\___|
+//
+//  Copyright © 2016 - 2024 Weaviate B.V. All rights reserved.
+//
+//  CONTACT: hello@weaviate.io
+//
+
+package vectorizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinInput(t *testing.T) {
+	tests := []struct {
+		name               string
+		vectorizeClassName bool
+		properties         []PropertyInput
+		expected           string
+	}{
+		{name: "values only", properties: []PropertyInput{{Values: []string{"x"}}, {Values: []string{"y", "z"}}}, expected: "x y z"},
+		{name: "class name first", vectorizeClassName: true, properties: []PropertyInput{{Values: []string{"x"}}}, expected: "super car x"},
+		{name: "header block", vectorizeClassName: true, properties: []PropertyInput{{Name: "title", Values: []string{"x"}}, {Values: []string{"y"}}}, expected: "super car title\nx y"},
+		{name: "class name fallback", properties: []PropertyInput{{Name: "title"}}, expected: "super car"},
+		{name: "no properties", expected: "super car"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, JoinInput("SuperCar", tt.vectorizeClassName, tt.properties))
+		})
+	}
+}
+
+func TestOrderedPropertyNames(t *testing.T) {
+	propMap := map[string]interface{}{"title": "x", "body": "y", "author": "z"}
+
+	assert.Equal(t, []string{"author", "body", "title"}, OrderedPropertyNames(propMap, nil))
+	assert.Equal(t, []string{"title", "body", "author"}, OrderedPropertyNames(propMap, []string{"title", "missing", "body"}))
+}
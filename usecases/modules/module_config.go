@@ -82,6 +82,19 @@ func (cbmc *ClassBasedModuleConfig) getModuleConfig() interface{} {
 	return cbmc.class.ModuleConfig
 }
 
+// PropertyNames returns the names of all properties of the class in the order in which they were declared. Properties
+// that are added to a class later on come last.
+func (cbmc *ClassBasedModuleConfig) PropertyNames() []string {
+	if cbmc.class == nil {
+		return nil
+	}
+	names := make([]string, len(cbmc.class.Properties))
+	for i, prop := range cbmc.class.Properties {
+		names[i] = prop.Name
+	}
+	return names
+}
+
 func (cbmc *ClassBasedModuleConfig) Property(propName string) map[string]interface{} {
 	defaultConf := map[string]interface{}{}
 	prop, err := schema.GetPropertyByName(cbmc.class, propName)
@@ -90,4 +90,18 @@ func TestClassBasedModuleConfig(t *testing.T) {
 		assert.Equal(t, map[string]interface{}{"propLevel": "bar"},
 			cfg.Property("some-prop"))
 	})
+
+	t.Run("property names in declaration order", func(t *testing.T) {
+		class := &models.Class{
+			Class: "Test",
+			Properties: []*models.Property{
+				{Name: "title"},
+				{Name: "body"},
+				{Name: "abstract"},
+			},
+		}
+		cfg := NewClassBasedModuleConfig(class, "my-module", "tenant", "")
+		assert.Equal(t, []string{"title", "body", "abstract"}, cfg.PropertyNames())
+		assert.Nil(t, NewCrossClassModuleConfig().PropertyNames())
+	})
 }